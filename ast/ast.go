@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"victoria/token"
@@ -46,7 +48,7 @@ type TypeAnnotation struct {
 	Token       token.Token     // The type token (e.g., TYPE_INT, TYPE_STRING, or IDENT for custom types)
 	TypeName    string          // The type name as string (e.g., "int", "string", "MyStruct")
 	IsArray     bool            // True if this is an array type like []int
-	ElementType *TypeAnnotation // For arrays/maps, the element type
+	ElementType *TypeAnnotation // For arrays/maps/sets, the element type
 	KeyType     *TypeAnnotation // For maps, the key type
 }
 
@@ -60,6 +62,9 @@ func (ta *TypeAnnotation) String() string {
 	if ta.KeyType != nil && ta.ElementType != nil {
 		return "map[" + ta.KeyType.String() + "]" + ta.ElementType.String()
 	}
+	if ta.TypeName == "set" && ta.ElementType != nil {
+		return "set[" + ta.ElementType.String() + "]"
+	}
 	return ta.TypeName
 }
 
@@ -295,6 +300,7 @@ func (i *Identifier) String() string       { return i.Value }
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal does not fit in an int64
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
@@ -419,12 +425,17 @@ type FunctionLiteral struct {
 	TypedParameters []*TypedParameter // Parameters with type annotations
 	ReturnTypes     []*TypeAnnotation // Return type(s) - supports multiple return types like Go
 	Body            *BlockStatement
+	IsGenerator     bool         // The body contains a yield statement
+	Decorators      []Expression // @memo, @trace("x"): applied to the function, last first
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
+	for _, d := range fl.Decorators {
+		out.WriteString("@" + d.String() + " ")
+	}
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != "" {
 		out.WriteString(" " + fl.Name)
@@ -483,6 +494,25 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// PipeExpression - value |> f(args) calls f(value, args)
+type PipeExpression struct {
+	Token token.Token // The |> token
+	Left  Expression  // The value passed along
+	Right Expression  // A call, which receives Left as its first argument, or a function
+}
+
+func (pe *PipeExpression) expressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(" |> ")
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 // ArrayLiteral
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
@@ -503,11 +533,32 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// SetLiteral
+type SetLiteral struct {
+	Token    token.Token // the '#{' token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
 // IndexExpression
 type IndexExpression struct {
-	Token token.Token // The [ token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The [ token
+	Left     Expression
+	Index    Expression
+	Optional bool // a?.[i]: null when Left is null or the index is absent
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -516,6 +567,9 @@ func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -528,6 +582,9 @@ type SliceExpression struct {
 	Left  Expression  // The array/string being sliced
 	Start Expression  // Start index (can be nil for [:end])
 	End   Expression  // End index (can be nil for [start:])
+	Step  Expression  // Step (can be nil for [start:end])
+
+	Optional bool // a?.[i:j]: null when Left is null
 }
 
 func (se *SliceExpression) expressionNode()      {}
@@ -536,6 +593,9 @@ func (se *SliceExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	if se.Start != nil {
 		out.WriteString(se.Start.String())
@@ -544,6 +604,10 @@ func (se *SliceExpression) String() string {
 	if se.End != nil {
 		out.WriteString(se.End.String())
 	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
 	out.WriteString("])")
 	return out.String()
 }
@@ -565,7 +629,8 @@ func (se *SpreadExpression) String() string {
 
 // HashLiteral
 type HashLiteral struct {
-	Token token.Token // the '{' token
+	Token token.Token  // the '{' token
+	Keys  []Expression // keys in source order
 	Pairs map[Expression]Expression
 }
 
@@ -574,8 +639,8 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -583,6 +648,67 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// ComprehensionClause is one `for x in xs if cond` part of a comprehension.
+// Index is set for the two-variable form `for i, x in xs`.
+type ComprehensionClause struct {
+	Token      token.Token // the 'for' token
+	Index      *Identifier
+	Item       *Identifier
+	Iterable   Expression
+	Conditions []Expression
+}
+
+func (cc *ComprehensionClause) String() string {
+	var out bytes.Buffer
+	out.WriteString("for ")
+	if cc.Index != nil {
+		out.WriteString(cc.Index.String() + ", ")
+	}
+	out.WriteString(cc.Item.String())
+	out.WriteString(" in ")
+	out.WriteString(cc.Iterable.String())
+	for _, cond := range cc.Conditions {
+		out.WriteString(" if ")
+		out.WriteString(cond.String())
+	}
+	return out.String()
+}
+
+func comprehensionString(clauses []*ComprehensionClause) string {
+	parts := []string{}
+	for _, clause := range clauses {
+		parts = append(parts, clause.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// ListComprehension - [x * x for x in xs if x > 0]
+type ListComprehension struct {
+	Token   token.Token // the '[' token
+	Element Expression
+	Clauses []*ComprehensionClause
+}
+
+func (lc *ListComprehension) expressionNode()      {}
+func (lc *ListComprehension) TokenLiteral() string { return lc.Token.Literal }
+func (lc *ListComprehension) String() string {
+	return "[" + lc.Element.String() + " " + comprehensionString(lc.Clauses) + "]"
+}
+
+// HashComprehension - {k: len(k) for k in words}
+type HashComprehension struct {
+	Token   token.Token // the '{' token
+	Key     Expression
+	Value   Expression
+	Clauses []*ComprehensionClause
+}
+
+func (hc *HashComprehension) expressionNode()      {}
+func (hc *HashComprehension) TokenLiteral() string { return hc.Token.Literal }
+func (hc *HashComprehension) String() string {
+	return "{" + hc.Key.String() + ":" + hc.Value.String() + " " + comprehensionString(hc.Clauses) + "}"
+}
+
 // StructLiteral (Definition)
 type StructLiteral struct {
 	Token  token.Token // 'struct'
@@ -647,6 +773,7 @@ func (si *StructInstantiation) String() string {
 // WhileExpression
 type WhileExpression struct {
 	Token     token.Token
+	Label     string // set by "name:" before the loop, for break name
 	Condition Expression
 	Body      *BlockStatement
 }
@@ -655,6 +782,7 @@ func (we *WhileExpression) expressionNode()      {}
 func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
 func (we *WhileExpression) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, we.Label)
 	out.WriteString("while ")
 	out.WriteString(we.Condition.String())
 	out.WriteString(" ")
@@ -662,9 +790,16 @@ func (we *WhileExpression) String() string {
 	return out.String()
 }
 
+func writeLabel(out *bytes.Buffer, label string) {
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+}
+
 // ForExpression (Iterating over list/map)
 type ForExpression struct {
 	Token    token.Token
+	Label    string
 	Item     *Identifier
 	Iterable Expression
 	Body     *BlockStatement
@@ -674,6 +809,7 @@ func (fe *ForExpression) expressionNode()      {}
 func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
 func (fe *ForExpression) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, fe.Label)
 	out.WriteString("for ")
 	out.WriteString(fe.Item.String())
 	out.WriteString(" in ")
@@ -686,6 +822,7 @@ func (fe *ForExpression) String() string {
 // CForExpression
 type CForExpression struct {
 	Token     token.Token
+	Label     string
 	Init      Statement
 	Condition Expression
 	Update    Statement
@@ -696,6 +833,7 @@ func (cfe *CForExpression) expressionNode()      {}
 func (cfe *CForExpression) TokenLiteral() string { return cfe.Token.Literal }
 func (cfe *CForExpression) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, cfe.Label)
 	out.WriteString("for (")
 	out.WriteString(cfe.Init.String())
 	out.WriteString("; ")
@@ -716,6 +854,7 @@ type MethodDefinition struct {
 	TypedParameters []*TypedParameter // Parameters with type annotations
 	ReturnTypes     []*TypeAnnotation // Return type(s)
 	Body            *BlockStatement
+	IsGenerator     bool // The body contains a yield statement
 }
 
 func (md *MethodDefinition) statementNode()       {}
@@ -760,20 +899,94 @@ func (md *MethodDefinition) String() string {
 // BreakStatement
 type BreakStatement struct {
 	Token token.Token
+	Label string // the labeled loop to leave, or "" for the innermost
 }
 
 func (bs *BreakStatement) statementNode()       {}
 func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
-func (bs *BreakStatement) String() string       { return "break" }
+func (bs *BreakStatement) String() string {
+	if bs.Label != "" {
+		return "break " + bs.Label
+	}
+	return "break"
+}
 
 // ContinueStatement
 type ContinueStatement struct {
 	Token token.Token
+	Label string // the labeled loop to continue, or "" for the innermost
 }
 
 func (cs *ContinueStatement) statementNode()       {}
 func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
-func (cs *ContinueStatement) String() string       { return "continue" }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != "" {
+		return "continue " + cs.Label
+	}
+	return "continue"
+}
+
+// YieldStatement hands a value to the consumer of a generator: yield x
+type YieldStatement struct {
+	Token token.Token
+	Value Expression // nil for a bare yield
+}
+
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+func (ys *YieldStatement) String() string {
+	if ys.Value == nil {
+		return "yield"
+	}
+	return "yield " + ys.Value.String()
+}
+
+// AssertStatement is assert condition, "message". Start and End are the
+// first and last tokens of the condition, so a failure can point at all of it.
+type AssertStatement struct {
+	Token     token.Token // the 'assert' token
+	Condition Expression
+	Message   Expression // nil when no message is given
+	Start     token.Token
+	End       token.Token
+}
+
+func (as *AssertStatement) statementNode()       {}
+func (as *AssertStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssertStatement) String() string {
+	if as.Message == nil {
+		return "assert " + as.Condition.String()
+	}
+	return "assert " + as.Condition.String() + ", " + as.Message.String()
+}
+
+// TestBlock is test "name" { ... } at the top level of a file. The body only
+// runs under `victoria test`; running the file normally skips it.
+type TestBlock struct {
+	Token token.Token // the 'test' identifier
+	Name  string
+	Body  *BlockStatement
+}
+
+func (tb *TestBlock) statementNode()       {}
+func (tb *TestBlock) TokenLiteral() string { return tb.Token.Literal }
+func (tb *TestBlock) String() string {
+	return "test " + strconv.Quote(tb.Name) + " " + tb.Body.String()
+}
+
+// BenchBlock is bench "name" { ... } at the top level of a file. The body only
+// runs under `victoria bench`, which runs it many times and measures it.
+type BenchBlock struct {
+	Token token.Token // the 'bench' identifier
+	Name  string
+	Body  *BlockStatement
+}
+
+func (bb *BenchBlock) statementNode()       {}
+func (bb *BenchBlock) TokenLiteral() string { return bb.Token.Literal }
+func (bb *BenchBlock) String() string {
+	return "bench " + strconv.Quote(bb.Name) + " " + bb.Body.String()
+}
 
 // SwitchExpression
 type SwitchExpression struct {
@@ -843,9 +1056,11 @@ func (te *TernaryExpression) String() string {
 
 // RangeExpression
 type RangeExpression struct {
-	Token token.Token // The .. token
-	Start Expression
-	End   Expression
+	Token     token.Token // The .. or ..= token
+	Start     Expression
+	End       Expression
+	Inclusive bool       // ..= includes End
+	Step      Expression // Optional: 10..0 step -2
 }
 
 func (re *RangeExpression) expressionNode()      {}
@@ -853,14 +1068,23 @@ func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
 func (re *RangeExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(re.Start.String())
-	out.WriteString("..")
+	if re.Inclusive {
+		out.WriteString("..=")
+	} else {
+		out.WriteString("..")
+	}
 	out.WriteString(re.End.String())
+	if re.Step != nil {
+		out.WriteString(" step ")
+		out.WriteString(re.Step.String())
+	}
 	return out.String()
 }
 
 // ForInIndexExpression - for i, v in arr { }
 type ForInIndexExpression struct {
 	Token    token.Token
+	Label    string
 	Index    *Identifier
 	Value    *Identifier
 	Iterable Expression
@@ -871,6 +1095,7 @@ func (fe *ForInIndexExpression) expressionNode()      {}
 func (fe *ForInIndexExpression) TokenLiteral() string { return fe.Token.Literal }
 func (fe *ForInIndexExpression) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, fe.Label)
 	out.WriteString("for ")
 	out.WriteString(fe.Index.String())
 	out.WriteString(", ")
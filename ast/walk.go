@@ -0,0 +1,193 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order, calling f
+// for each node before its children. If f returns false the children of that
+// node are skipped. Missing optional parts, such as an absent else block, are
+// not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	expr := func(e Expression) {
+		if e != nil {
+			Inspect(e, f)
+		}
+	}
+	stmt := func(s Statement) {
+		if s != nil {
+			Inspect(s, f)
+		}
+	}
+	block := func(b *BlockStatement) {
+		if b != nil {
+			Inspect(b, f)
+		}
+	}
+	ident := func(i *Identifier) {
+		if i != nil {
+			Inspect(i, f)
+		}
+	}
+	exprs := func(list []Expression) {
+		for _, e := range list {
+			expr(e)
+		}
+	}
+	clauses := func(list []*ComprehensionClause) {
+		for _, c := range list {
+			ident(c.Index)
+			ident(c.Item)
+			expr(c.Iterable)
+			exprs(c.Conditions)
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			stmt(s)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			stmt(s)
+		}
+	case *ExpressionStatement:
+		expr(n.Expression)
+	case *LetStatement:
+		ident(n.Name)
+		expr(n.Value)
+	case *ConstStatement:
+		ident(n.Name)
+		expr(n.Value)
+	case *MakeStatement:
+		ident(n.Name)
+		expr(n.Value)
+	case *EnumStatement:
+		ident(n.Name)
+		for _, v := range n.Values {
+			ident(v.Name)
+			expr(v.Value)
+		}
+	case *ReturnStatement:
+		expr(n.ReturnValue)
+	case *YieldStatement:
+		expr(n.Value)
+	case *AssertStatement:
+		expr(n.Condition)
+		expr(n.Message)
+	case *TestBlock:
+		block(n.Body)
+	case *BenchBlock:
+		block(n.Body)
+	case *TryStatement:
+		block(n.Block)
+		ident(n.CatchVar)
+		block(n.CatchBlock)
+	case *PrefixExpression:
+		expr(n.Right)
+	case *InfixExpression:
+		expr(n.Left)
+		expr(n.Right)
+	case *PostfixExpression:
+		expr(n.Left)
+	case *IfExpression:
+		expr(n.Condition)
+		block(n.Consequence)
+		block(n.Alternative)
+	case *TernaryExpression:
+		expr(n.Condition)
+		expr(n.Consequence)
+		expr(n.Alternative)
+	case *SwitchExpression:
+		expr(n.Value)
+		for _, c := range n.Cases {
+			Inspect(c, f)
+		}
+		block(n.Default)
+	case *CaseExpression:
+		expr(n.Value)
+		block(n.Body)
+	case *FunctionLiteral:
+		exprs(n.Decorators)
+		for _, p := range n.Parameters {
+			ident(p)
+		}
+		block(n.Body)
+	case *MethodDefinition:
+		ident(n.StructName)
+		ident(n.MethodName)
+		for _, p := range n.Parameters {
+			ident(p)
+		}
+		block(n.Body)
+	case *ArrowFunction:
+		for _, p := range n.Parameters {
+			ident(p)
+		}
+		expr(n.Body)
+	case *CallExpression:
+		expr(n.Function)
+		exprs(n.Arguments)
+	case *PipeExpression:
+		expr(n.Left)
+		expr(n.Right)
+	case *ArrayLiteral:
+		exprs(n.Elements)
+	case *SetLiteral:
+		exprs(n.Elements)
+	case *HashLiteral:
+		for _, k := range n.Keys {
+			expr(k)
+			expr(n.Pairs[k])
+		}
+	case *ListComprehension:
+		clauses(n.Clauses)
+		expr(n.Element)
+	case *HashComprehension:
+		clauses(n.Clauses)
+		expr(n.Key)
+		expr(n.Value)
+	case *IndexExpression:
+		expr(n.Left)
+		expr(n.Index)
+	case *SliceExpression:
+		expr(n.Left)
+		expr(n.Start)
+		expr(n.End)
+		expr(n.Step)
+	case *SpreadExpression:
+		expr(n.Right)
+	case *RangeExpression:
+		expr(n.Start)
+		expr(n.End)
+		expr(n.Step)
+	case *StructLiteral:
+		ident(n.Name)
+		for _, field := range n.Fields {
+			ident(field)
+		}
+	case *StructInstantiation:
+		ident(n.Name)
+		for _, value := range n.Fields {
+			expr(value)
+		}
+	case *WhileExpression:
+		expr(n.Condition)
+		block(n.Body)
+	case *ForExpression:
+		ident(n.Item)
+		expr(n.Iterable)
+		block(n.Body)
+	case *ForInIndexExpression:
+		ident(n.Index)
+		ident(n.Value)
+		expr(n.Iterable)
+		block(n.Body)
+	case *CForExpression:
+		stmt(n.Init)
+		expr(n.Condition)
+		stmt(n.Update)
+		block(n.Body)
+	}
+}
@@ -2,21 +2,59 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"victoria/cover"
 	"victoria/errors"
 	"victoria/evaluator"
 	"victoria/lexer"
 	"victoria/object"
 	"victoria/parser"
 	"victoria/repl"
+	"victoria/tester"
 )
 
 func main() {
-	if len(os.Args) > 1 {
-		filename := os.Args[1]
-		runFile(filename)
+	defines, args, err := parseDefines(interpreterArgs(os.Args[1:]))
+	if err != nil {
+		fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+		os.Exit(1)
+	}
+
+	args = parseStrictFlag(args)
+
+	cov, args, err := parseCoverFlags(args)
+	if err != nil {
+		fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+		os.Exit(1)
+	}
+
+	if len(args) > 0 && args[0] == "test" {
+		status := runTests(args[1:], defines, cov)
+		if err := cov.write(); err != nil {
+			fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+			os.Exit(2)
+		}
+		os.Exit(status)
+	}
+
+	if len(args) > 0 && args[0] == "bench" {
+		os.Exit(runBenchmarks(args[1:], defines))
+	}
+
+	if len(args) > 0 {
+		filename := args[0]
+		runFile(filename, defines, cov.profile)
+		if err := cov.write(); err != nil {
+			fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+			os.Exit(2)
+		}
 	} else {
 		fmt.Printf("Victoria Programming Language\n")
 		fmt.Printf("Type in commands\n")
@@ -24,7 +62,161 @@ func main() {
 	}
 }
 
-func runFile(filename string) {
+// interpreterArgs returns the arguments that are meant for victoria itself:
+// everything up to and including the script name. What follows the script
+// is left to the script's os.args(), even when it looks like one of our
+// flags. test and bench take no script, so their flags may follow them.
+func interpreterArgs(args []string) []string {
+	i := 0
+	for i < len(args) {
+		switch arg := args[i]; {
+		case arg == "-D" || arg == "--cover-html" || arg == "--cover-lcov":
+			i += 2
+		case strings.HasPrefix(arg, "-"):
+			i++
+		default:
+			if arg == "test" || arg == "bench" {
+				return args
+			}
+			return args[:i+1]
+		}
+	}
+	return args
+}
+
+// define is a command-line preprocessor define (-D NAME=value)
+type define struct {
+	name  string
+	value string
+}
+
+// parseDefines extracts -D NAME[=value] and -DNAME[=value] flags from the
+// arguments. A define without a value is set to 1.
+func parseDefines(args []string) ([]define, []string, error) {
+	defines := []define{}
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-D") {
+			rest = append(rest, arg)
+			continue
+		}
+		spec := strings.TrimPrefix(arg, "-D")
+		if spec == "" {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("-D requires NAME or NAME=value")
+			}
+			i++
+			spec = args[i]
+		}
+		name, value, found := strings.Cut(spec, "=")
+		if !found {
+			value = "1"
+		}
+		if name == "" {
+			return nil, nil, fmt.Errorf("invalid define '%s', expected NAME or NAME=value", spec)
+		}
+		defines = append(defines, define{name: name, value: value})
+	}
+	return defines, rest, nil
+}
+
+// parseStrictFlag handles --strict-int, which makes integer overflow an error
+// instead of promoting to a big integer
+func parseStrictFlag(args []string) []string {
+	rest := []string{}
+	for _, arg := range args {
+		if arg == "--strict-int" {
+			evaluator.SetStrictIntegers(true)
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
+
+// coverage holds the --cover flags. Any of them turns coverage on, and
+// profile is nil when none is given.
+type coverage struct {
+	report  bool   // --cover: print the annotated source
+	html    string // --cover-html FILE
+	lcov    string // --cover-lcov FILE
+	profile *cover.Profile
+}
+
+// parseCoverFlags extracts --cover, --cover-html FILE and --cover-lcov FILE
+func parseCoverFlags(args []string) (*coverage, []string, error) {
+	cov := &coverage{}
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		switch flag {
+		case "--cover":
+			cov.report = true
+			continue
+		case "--cover-html", "--cover-lcov":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("%s requires a file name", flag)
+				}
+				i++
+				value = args[i]
+			}
+			if flag == "--cover-html" {
+				cov.html = value
+			} else {
+				cov.lcov = value
+			}
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+
+	if cov.report || cov.html != "" || cov.lcov != "" {
+		cov.profile = cover.NewProfile()
+	}
+	return cov, rest, nil
+}
+
+// write prints and saves the reports asked for once the program has run
+func (c *coverage) write() error {
+	if c.profile == nil {
+		return nil
+	}
+	if c.report {
+		fmt.Println()
+		if err := cover.WriteText(os.Stdout, c.profile); err != nil {
+			return err
+		}
+	}
+	save := func(name string, write func(io.Writer, *cover.Profile) error) error {
+		out, err := os.Create(name)
+		if err != nil {
+			return fmt.Errorf("could not write coverage report: %v", err)
+		}
+		err = write(out, c.profile)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("could not write coverage report: %v", err)
+		}
+		return nil
+	}
+	if c.html != "" {
+		if err := save(c.html, cover.WriteHTML); err != nil {
+			return err
+		}
+	}
+	if c.lcov != "" {
+		if err := save(c.lcov, cover.WriteLCOV); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runFile(filename string, defines []define, profile *cover.Profile) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Printf("%s%serror%s: could not read file '%s'\n", errors.Bold, errors.BrightRed, errors.Reset, filename)
@@ -41,6 +233,13 @@ func runFile(filename string) {
 	defer evaluator.ClearEvalContext()
 
 	l := lexer.New(source)
+	included := map[string]string{}
+	for _, d := range defines {
+		l.Define(d.name, d.value)
+		included[d.name] = d.value
+	}
+	evaluator.SetDefines(included)
+	defer evaluator.SetDefines(nil)
 	p := parser.New(l)
 	p.SetSource(source, absPath)
 
@@ -62,6 +261,15 @@ func runFile(filename string) {
 		}
 		return
 	}
+	for _, note := range p.Notes() {
+		fmt.Fprint(os.Stderr, note.Format())
+		fmt.Fprintln(os.Stderr)
+	}
+	if profile != nil {
+		profile.Program(absPath, source, program)
+		evaluator.SetTracer(profile)
+		defer evaluator.SetTracer(nil)
+	}
 
 	evaluated := evaluator.Eval(program, env)
 	if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
@@ -69,3 +277,184 @@ func runFile(filename string) {
 		fmt.Print(evaluator.FormatRichError(errObj))
 	}
 }
+
+// runTests implements `victoria test [--run PATTERN] [--junit FILE] [paths...]`
+// and returns the exit status: 0 when every test passed
+func runTests(args []string, defines []define, cov *coverage) int {
+	opts := tester.Options{Out: os.Stdout, Defines: map[string]string{}}
+	if cov.profile != nil {
+		// Coverage is about the code under test, not the tests
+		cov.profile.Exclude = func(filename string) bool {
+			return strings.HasSuffix(filename, "_test.vc")
+		}
+		opts.Tracer = cov.profile
+	}
+	for _, d := range defines {
+		opts.Defines[d.name] = d.value
+	}
+
+	var junitFile string
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if flag != "--run" && flag != "--junit" {
+			paths = append(paths, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				fmt.Printf("%s%serror%s: %s requires a value\n", errors.Bold, errors.BrightRed, errors.Reset, flag)
+				return 2
+			}
+			i++
+			value = args[i]
+		}
+		if flag == "--junit" {
+			junitFile = value
+			continue
+		}
+		filter, err := regexp.Compile(value)
+		if err != nil {
+			fmt.Printf("%s%serror%s: invalid --run pattern: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+			return 2
+		}
+		opts.Filter = filter
+	}
+
+	files, err := tester.Discover(paths)
+	if err != nil {
+		fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+		return 2
+	}
+	if len(files) == 0 {
+		fmt.Println("no test files found")
+		return 0
+	}
+
+	suites := tester.Run(files, opts)
+
+	if junitFile != "" {
+		out, err := os.Create(junitFile)
+		if err == nil {
+			err = tester.WriteJUnit(out, suites)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Printf("%s%serror%s: could not write JUnit report: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+			return 2
+		}
+	}
+
+	for _, suite := range suites {
+		if suite.Failed() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runBenchmarks implements `victoria bench [--run PATTERN] [--benchtime D]
+// [--baseline FILE] [--save FILE] [paths...]` and returns the exit status:
+// 0 when every benchmark ran
+func runBenchmarks(args []string, defines []define) int {
+	opts := tester.BenchOptions{Out: os.Stdout, Defines: map[string]string{}}
+	for _, d := range defines {
+		opts.Defines[d.name] = d.value
+	}
+
+	var saveFile string
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if flag != "--run" && flag != "--benchtime" && flag != "--baseline" && flag != "--save" {
+			paths = append(paths, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				fmt.Printf("%s%serror%s: %s requires a value\n", errors.Bold, errors.BrightRed, errors.Reset, flag)
+				return 2
+			}
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "--run":
+			filter, err := regexp.Compile(value)
+			if err != nil {
+				fmt.Printf("%s%serror%s: invalid --run pattern: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+				return 2
+			}
+			opts.Filter = filter
+		case "--benchtime":
+			// Either a duration such as 500ms, or a fixed count such as 100x
+			if count, ok := strings.CutSuffix(value, "x"); ok {
+				n, err := strconv.Atoi(count)
+				if err != nil || n <= 0 {
+					fmt.Printf("%s%serror%s: invalid --benchtime %q\n", errors.Bold, errors.BrightRed, errors.Reset, value)
+					return 2
+				}
+				opts.Iterations = n
+				continue
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				fmt.Printf("%s%serror%s: invalid --benchtime %q\n", errors.Bold, errors.BrightRed, errors.Reset, value)
+				return 2
+			}
+			opts.Time = d
+		case "--baseline":
+			f, err := os.Open(value)
+			if err != nil {
+				fmt.Printf("%s%serror%s: could not read baseline: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+				return 2
+			}
+			opts.Baseline, err = tester.ReadBaseline(f)
+			f.Close()
+			if err != nil {
+				fmt.Printf("%s%serror%s: %s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, value, err)
+				return 2
+			}
+		case "--save":
+			saveFile = value
+		}
+	}
+
+	files, err := tester.DiscoverBenchmarks(paths)
+	if err != nil {
+		fmt.Printf("%s%serror%s: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+		return 2
+	}
+	if len(files) == 0 {
+		fmt.Println("no benchmark files found")
+		return 0
+	}
+
+	suites := tester.RunBenchmarks(files, opts)
+
+	if saveFile != "" {
+		out, err := os.Create(saveFile)
+		if err == nil {
+			err = tester.NewBaseline(suites).Write(out)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Printf("%s%serror%s: could not save baseline: %v\n", errors.Bold, errors.BrightRed, errors.Reset, err)
+			return 2
+		}
+	}
+
+	for _, suite := range suites {
+		if suite.Failed() {
+			return 1
+		}
+	}
+	return 0
+}
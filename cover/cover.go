@@ -0,0 +1,271 @@
+// Package cover records which statements and branches of a Victoria program
+// run, for `--cover`, and writes the result as an annotated terminal report,
+// an HTML page or an LCOV file.
+//
+// A Profile is an evaluator.Tracer. Statements and branches are keyed by
+// file and source position rather than by AST node, so a file that is parsed
+// again, as included modules are for every test, adds to the same counts.
+package cover
+
+import (
+	"sort"
+
+	"victoria/ast"
+	"victoria/token"
+)
+
+// Statement is one statement of a file and the number of times it ran
+type Statement struct {
+	Line   int
+	Column int
+	Count  int
+}
+
+// Branch is a decision point, such as an if or a switch, with a count for
+// each of its arms
+type Branch struct {
+	Line   int
+	Column int
+	Kind   string   // "if", "?:", "switch", "&&", "||" or "??"
+	Arms   []string // a label for each arm, such as "then" and "else"
+	Counts []int
+}
+
+// Covered returns the number of arms that were taken at least once
+func (b *Branch) Covered() int {
+	n := 0
+	for _, c := range b.Counts {
+		if c > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// File is the coverage of one source file
+type File struct {
+	Name       string
+	Source     string
+	Statements []*Statement // in source order
+	Branches   []*Branch    // in source order
+}
+
+// Summary returns the covered and total counts of statements and branch arms
+func (f *File) Summary() (stmtHit, stmtTotal, armHit, armTotal int) {
+	for _, s := range f.Statements {
+		if s.Count > 0 {
+			stmtHit++
+		}
+	}
+	for _, b := range f.Branches {
+		armHit += b.Covered()
+		armTotal += len(b.Arms)
+	}
+	return stmtHit, len(f.Statements), armHit, armTotal
+}
+
+type position struct {
+	line, column int
+}
+
+type fileIndex struct {
+	file       *File
+	statements map[position]*Statement
+	branches   map[position]*Branch
+}
+
+// Profile collects coverage for every file it is given
+type Profile struct {
+	files      map[string]*fileIndex
+	order      []string
+	statements map[ast.Statement]*Statement
+	branches   map[ast.Node]*Branch
+	// Exclude reports files to leave out of the profile, such as test files
+	Exclude func(filename string) bool
+}
+
+// NewProfile returns an empty profile
+func NewProfile() *Profile {
+	return &Profile{
+		files:      make(map[string]*fileIndex),
+		statements: make(map[ast.Statement]*Statement),
+		branches:   make(map[ast.Node]*Branch),
+	}
+}
+
+// Files returns the covered files in the order they were first seen
+func (p *Profile) Files() []*File {
+	files := make([]*File, 0, len(p.order))
+	for _, name := range p.order {
+		files = append(files, p.files[name].file)
+	}
+	return files
+}
+
+// Summary returns the covered and total counts across all files
+func (p *Profile) Summary() (stmtHit, stmtTotal, armHit, armTotal int) {
+	for _, f := range p.Files() {
+		sh, st, ah, at := f.Summary()
+		stmtHit, stmtTotal, armHit, armTotal = stmtHit+sh, stmtTotal+st, armHit+ah, armTotal+at
+	}
+	return
+}
+
+// Program registers the statements and branches of program, which was
+// parsed from filename. Test and bench blocks are left out, since they are
+// not part of the code under test.
+func (p *Profile) Program(filename, source string, program *ast.Program) {
+	if p.Exclude != nil && p.Exclude(filename) {
+		return
+	}
+	idx, ok := p.files[filename]
+	if !ok {
+		idx = &fileIndex{
+			file:       &File{Name: filename, Source: source},
+			statements: make(map[position]*Statement),
+			branches:   make(map[position]*Branch),
+		}
+		p.files[filename] = idx
+		p.order = append(p.order, filename)
+	}
+
+	// The init and update of a C-style for loop are run directly rather
+	// than as statements of a block, so they are not traced
+	untraced := map[ast.Statement]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.TestBlock, *ast.BenchBlock:
+			return false
+		case *ast.CForExpression:
+			untraced[n.Init] = true
+			untraced[n.Update] = true
+		}
+
+		if stmt, ok := node.(ast.Statement); ok {
+			if _, isBlock := stmt.(*ast.BlockStatement); isBlock || untraced[stmt] {
+				return true
+			}
+			tok := statementToken(stmt)
+			pos := position{tok.Line, tok.Column}
+			s, ok := idx.statements[pos]
+			if !ok {
+				s = &Statement{Line: tok.Line, Column: tok.Column}
+				idx.statements[pos] = s
+				idx.file.Statements = append(idx.file.Statements, s)
+			}
+			p.statements[stmt] = s
+		}
+
+		if tok, kind, arms := branchOf(node); kind != "" {
+			pos := position{tok.Line, tok.Column}
+			b, ok := idx.branches[pos]
+			if !ok {
+				b = &Branch{Line: tok.Line, Column: tok.Column, Kind: kind, Arms: arms, Counts: make([]int, len(arms))}
+				idx.branches[pos] = b
+				idx.file.Branches = append(idx.file.Branches, b)
+			}
+			p.branches[node] = b
+		}
+		return true
+	})
+
+	sort.SliceStable(idx.file.Statements, func(i, j int) bool {
+		return before(idx.file.Statements[i].Line, idx.file.Statements[i].Column, idx.file.Statements[j].Line, idx.file.Statements[j].Column)
+	})
+	sort.SliceStable(idx.file.Branches, func(i, j int) bool {
+		return before(idx.file.Branches[i].Line, idx.file.Branches[i].Column, idx.file.Branches[j].Line, idx.file.Branches[j].Column)
+	})
+}
+
+// Statement counts a run of stmt
+func (p *Profile) Statement(stmt ast.Statement) {
+	if s, ok := p.statements[stmt]; ok {
+		s.Count++
+	}
+}
+
+// Branch counts a pass through arm of the decision at node
+func (p *Profile) Branch(node ast.Node, arm int) {
+	if b, ok := p.branches[node]; ok && arm < len(b.Counts) {
+		b.Counts[arm]++
+	}
+}
+
+func before(line1, col1, line2, col2 int) bool {
+	if line1 != line2 {
+		return line1 < line2
+	}
+	return col1 < col2
+}
+
+// statementToken returns the token a statement is reported at
+func statementToken(stmt ast.Statement) token.Token {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		// define f() {} is a let statement whose own token has no column
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok && s.Token.Column == 0 {
+			return fn.Token
+		}
+		return s.Token
+	case *ast.ConstStatement:
+		return s.Token
+	case *ast.MakeStatement:
+		return s.Token
+	case *ast.EnumStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.IncludeStatement:
+		return s.Token
+	case *ast.TryStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.StructLiteral:
+		return s.Token
+	case *ast.MethodDefinition:
+		return s.Token
+	case *ast.BreakStatement:
+		return s.Token
+	case *ast.ContinueStatement:
+		return s.Token
+	case *ast.YieldStatement:
+		return s.Token
+	case *ast.AssertStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
+
+// branchOf describes node if it is a decision point the evaluator traces.
+// The arms are in the order the evaluator numbers them.
+func branchOf(node ast.Node) (token.Token, string, []string) {
+	switch n := node.(type) {
+	case *ast.IfExpression:
+		return n.Token, "if", []string{"then", "else"}
+	case *ast.TernaryExpression:
+		return n.Token, "?:", []string{"true", "false"}
+	case *ast.SwitchExpression:
+		arms := make([]string, 0, len(n.Cases)+1)
+		for _, c := range n.Cases {
+			arms = append(arms, "case "+c.Value.String())
+		}
+		if n.Default != nil {
+			arms = append(arms, "default")
+		} else {
+			arms = append(arms, "no case matched")
+		}
+		return n.Token, "switch", arms
+	case *ast.InfixExpression:
+		switch n.Operator {
+		case "&&", "and":
+			return n.Token, "&&", []string{"right side evaluated", "short-circuited"}
+		case "||", "or":
+			return n.Token, "||", []string{"right side evaluated", "short-circuited"}
+		case "??":
+			return n.Token, "??", []string{"fallback used", "left side used"}
+		}
+	}
+	return token.Token{}, "", nil
+}
@@ -0,0 +1,214 @@
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"victoria/evaluator"
+	"victoria/lexer"
+	"victoria/object"
+	"victoria/parser"
+)
+
+const gradeSource = `define grade(score) {
+    if (score >= 90) {
+        return "A"
+    } else if (score >= 80) {
+        return "B"
+    }
+    let passed = score >= 50 && score <= 100
+    return passed ? "C" : "F"
+}
+
+define describe(n) {
+    switch (n) {
+        case 1: { return "one" }
+        default: { return "many" }
+    }
+}
+
+grade(95)
+grade(60)
+describe(2)
+
+test "not counted" {
+    grade(85)
+}
+`
+
+// run evaluates source under a fresh profile and returns it
+func run(t *testing.T, source string) *Profile {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	profile := NewProfile()
+	profile.Program("grade.vc", source, program)
+	evaluator.SetTracer(profile)
+	defer evaluator.SetTracer(nil)
+
+	if result := evaluator.Eval(program, object.NewEnvironment()); result != nil && result.Type() == object.ERROR_OBJ {
+		t.Fatalf("evaluation failed: %s", result.Inspect())
+	}
+	return profile
+}
+
+func TestProfile(t *testing.T) {
+	profile := run(t, gradeSource)
+
+	files := profile.Files()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file. got=%d", len(files))
+	}
+	f := files[0]
+
+	counts := map[int]int{}
+	for _, s := range f.Statements {
+		counts[s.Line] = s.Count
+	}
+	expectedCounts := map[int]int{1: 1, 2: 2, 3: 1, 4: 1, 5: 0, 7: 1, 8: 1, 11: 1, 12: 1, 13: 0, 14: 1, 18: 1}
+	for line, want := range expectedCounts {
+		if got, ok := counts[line]; !ok || got != want {
+			t.Errorf("line %d: expected count %d. got=%d (registered=%t)", line, want, got, ok)
+		}
+	}
+	if _, ok := counts[23]; ok {
+		t.Errorf("statements inside test blocks should not be registered")
+	}
+
+	expectedBranches := []struct {
+		line   int
+		kind   string
+		counts []int
+	}{
+		{2, "if", []int{1, 1}},
+		{4, "if", []int{0, 1}},
+		{7, "&&", []int{1, 0}},
+		{8, "?:", []int{1, 0}},
+		{12, "switch", []int{0, 1}},
+	}
+	if len(f.Branches) != len(expectedBranches) {
+		t.Fatalf("expected %d branches. got=%d", len(expectedBranches), len(f.Branches))
+	}
+	for i, tt := range expectedBranches {
+		b := f.Branches[i]
+		if b.Line != tt.line || b.Kind != tt.kind || len(b.Counts) != len(tt.counts) {
+			t.Errorf("branch %d: expected %s at line %d, got %s at line %d with %v", i, tt.kind, tt.line, b.Kind, b.Line, b.Counts)
+			continue
+		}
+		for arm, c := range tt.counts {
+			if b.Counts[arm] != c {
+				t.Errorf("branch %d (%s): arm %q expected %d. got=%d", i, tt.kind, b.Arms[arm], c, b.Counts[arm])
+			}
+		}
+	}
+
+	stmtHit, stmtTotal, armHit, armTotal := profile.Summary()
+	if stmtHit != 12 || stmtTotal != 14 || armHit != 6 || armTotal != 10 {
+		t.Errorf("wrong summary: statements %d/%d, branches %d/%d", stmtHit, stmtTotal, armHit, armTotal)
+	}
+}
+
+func TestProfileReparsedFile(t *testing.T) {
+	source := "let x = 1\nif (x > 0) { x = 2 }\n"
+	profile := NewProfile()
+	evaluator.SetTracer(profile)
+	defer evaluator.SetTracer(nil)
+
+	// Included modules are parsed again for every test, so the counts of
+	// each parse add up under the same file
+	for i := 0; i < 2; i++ {
+		program := parser.New(lexer.New(source)).ParseProgram()
+		profile.Program("mod.vc", source, program)
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+
+	f := profile.Files()[0]
+	if len(f.Statements) != 3 || len(f.Branches) != 1 {
+		t.Fatalf("a reparsed file should not add statements. got %d statements, %d branches", len(f.Statements), len(f.Branches))
+	}
+	if f.Statements[0].Count != 2 || f.Branches[0].Counts[0] != 2 {
+		t.Errorf("counts should add up across parses. got statement=%d then=%d", f.Statements[0].Count, f.Branches[0].Counts[0])
+	}
+
+	excluded := NewProfile()
+	excluded.Exclude = func(name string) bool { return strings.HasSuffix(name, "_test.vc") }
+	excluded.Program("mod_test.vc", source, parser.New(lexer.New(source)).ParseProgram())
+	if len(excluded.Files()) != 0 {
+		t.Errorf("excluded files should not be profiled")
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	profile := run(t, gradeSource)
+
+	var buf bytes.Buffer
+	if err := WriteLCOV(&buf, profile); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"SF:grade.vc\n",
+		"DA:2,2\n",
+		"DA:5,0\n",
+		"BRDA:2,0,1,1\n",
+		"BRDA:7,2,1,0\n",
+		"BRF:10\nBRH:6\n",
+		"LF:14\nLH:12\n",
+		"end_of_record\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("LCOV output should contain %q. got=\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteTextAndHTML(t *testing.T) {
+	profile := run(t, gradeSource)
+
+	var text bytes.Buffer
+	if err := WriteText(&text, profile); err != nil {
+		t.Fatal(err)
+	}
+	plain := strings.Join(strings.Fields(stripColors(text.String())), " ")
+	for _, want := range []string{
+		"grade.vc: statements 85.7% (12/14), branches 60.0% (6/10)",
+		"^ && never ran: short-circuited",
+		"^ switch never ran: case 1",
+	} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("text report should contain %q. got=\n%s", want, text.String())
+		}
+	}
+
+	var page bytes.Buffer
+	if err := WriteHTML(&page, profile); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<span class="line uncovered"><span class="num">5</span><span class="count">0</span>        return &#34;B&#34;</span>`,
+		`<span class="branch">?: never ran: false</span>`,
+	} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("HTML report should contain %q", want)
+		}
+	}
+}
+
+func stripColors(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,272 @@
+package cover
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"victoria/errors"
+)
+
+// lineInfo gathers what a report needs to know about one source line
+type lineInfo struct {
+	count    int // the highest count of a statement starting on the line
+	hit      int // statements on the line that ran
+	total    int // statements starting on the line
+	branches []*Branch
+}
+
+// state is "covered", "partial" or "uncovered" for lines with statements or
+// branches, and "" for the rest
+func (l *lineInfo) state() string {
+	if l == nil || (l.total == 0 && len(l.branches) == 0) {
+		return ""
+	}
+	missed := l.hit < l.total
+	for _, b := range l.branches {
+		if b.Covered() < len(b.Arms) {
+			missed = true
+		}
+	}
+	switch {
+	case !missed:
+		return "covered"
+	case l.hit == 0 && l.total > 0:
+		return "uncovered"
+	default:
+		return "partial"
+	}
+}
+
+func linesOf(f *File) map[int]*lineInfo {
+	lines := make(map[int]*lineInfo)
+	get := func(n int) *lineInfo {
+		if lines[n] == nil {
+			lines[n] = &lineInfo{}
+		}
+		return lines[n]
+	}
+	for _, s := range f.Statements {
+		l := get(s.Line)
+		l.total++
+		if s.Count > 0 {
+			l.hit++
+		}
+		if s.Count > l.count {
+			l.count = s.Count
+		}
+	}
+	for _, b := range f.Branches {
+		l := get(b.Line)
+		l.branches = append(l.branches, b)
+	}
+	return lines
+}
+
+// missedArms lists the arms of b that never ran
+func missedArms(b *Branch) []string {
+	var missed []string
+	for i, arm := range b.Arms {
+		if b.Counts[i] == 0 {
+			missed = append(missed, arm)
+		}
+	}
+	return missed
+}
+
+func percent(hit, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(hit)/float64(total))
+}
+
+func summaryLine(stmtHit, stmtTotal, armHit, armTotal int) string {
+	return fmt.Sprintf("statements %s (%d/%d), branches %s (%d/%d)",
+		percent(stmtHit, stmtTotal), stmtHit, stmtTotal, percent(armHit, armTotal), armHit, armTotal)
+}
+
+// WriteText writes each file's source with the run count of every line,
+// colored by whether it was covered, and the branch arms that never ran
+// marked under their line. It ends with the totals.
+func WriteText(w io.Writer, p *Profile) error {
+	var sb strings.Builder
+	for _, f := range p.Files() {
+		lines := linesOf(f)
+		sb.WriteString(fmt.Sprintf("%scoverage%s: %s: %s\n", errors.Bold, errors.Reset, f.Name, summaryLine(f.Summary())))
+
+		source := strings.Split(strings.TrimRight(f.Source, "\n"), "\n")
+		width := len(fmt.Sprint(len(source)))
+		for i, text := range source {
+			n := i + 1
+			info := lines[n]
+
+			count := ""
+			color := ""
+			switch info.state() {
+			case "covered":
+				color = errors.Green
+			case "partial":
+				color = errors.Yellow
+			case "uncovered":
+				color = errors.BrightRed
+			}
+			if info != nil && info.total > 0 {
+				count = fmt.Sprint(info.count)
+			}
+			sb.WriteString(fmt.Sprintf("%s%*d%s %s%6s%s %s|%s %s\n",
+				errors.Cyan, width, n, errors.Reset, color, count, errors.Reset, errors.Cyan, errors.Reset, text))
+
+			if info == nil {
+				continue
+			}
+			for _, b := range info.branches {
+				missed := missedArms(b)
+				if len(missed) == 0 {
+					continue
+				}
+				pad := strings.Repeat(" ", width+8)
+				caret := strings.Repeat(" ", caretOffset(text, b.Column))
+				sb.WriteString(fmt.Sprintf("%s%s|%s %s%s^ %s never ran: %s%s\n",
+					pad, errors.Cyan, errors.Reset, caret, errors.Yellow, b.Kind, strings.Join(missed, ", "), errors.Reset))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("%stotal%s: %s\n", errors.Bold, errors.Reset, summaryLine(p.Summary())))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// caretOffset is the number of characters before column col of line, which
+// counts from 1
+func caretOffset(line string, col int) int {
+	if col < 1 {
+		return 0
+	}
+	n := 0
+	for range line {
+		if n == col-1 {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Victoria coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+.summary { color: #555; }
+pre { background: #fafafa; border: 1px solid #ddd; padding: 0.5em 0; }
+.line { display: block; padding: 0 0.5em; }
+.num, .count { display: inline-block; text-align: right; color: #999; margin-right: 1em; }
+.num { width: 3em; }
+.count { width: 4em; }
+.covered { background: #e6ffed; }
+.partial { background: #fff5d6; }
+.uncovered { background: #ffe3e3; }
+.branch { display: block; padding: 0 0.5em 0 9.5em; color: #8a6d00; }
+</style>
+</head>
+<body>
+<h1>Victoria coverage</h1>
+`
+
+// WriteHTML writes a self-contained HTML page with each file's source,
+// shaded by coverage, with counts per line and the branch arms that never ran
+func WriteHTML(w io.Writer, p *Profile) error {
+	var sb strings.Builder
+	sb.WriteString(htmlHead)
+	sb.WriteString(fmt.Sprintf("<p class=\"summary\">Total: %s</p>\n", html.EscapeString(summaryLine(p.Summary()))))
+
+	for _, f := range p.Files() {
+		lines := linesOf(f)
+		sb.WriteString(fmt.Sprintf("<h2>%s</h2>\n", html.EscapeString(f.Name)))
+		sb.WriteString(fmt.Sprintf("<p class=\"summary\">%s</p>\n<pre>", html.EscapeString(summaryLine(f.Summary()))))
+
+		for i, text := range strings.Split(strings.TrimRight(f.Source, "\n"), "\n") {
+			n := i + 1
+			info := lines[n]
+			count := ""
+			if info != nil && info.total > 0 {
+				count = fmt.Sprint(info.count)
+			}
+			class := "line"
+			if state := info.state(); state != "" {
+				class += " " + state
+			}
+			sb.WriteString(fmt.Sprintf("<span class=\"%s\"><span class=\"num\">%d</span><span class=\"count\">%s</span>%s</span>",
+				class, n, count, html.EscapeString(text)))
+
+			if info == nil {
+				continue
+			}
+			for _, b := range info.branches {
+				if missed := missedArms(b); len(missed) > 0 {
+					sb.WriteString(fmt.Sprintf("<span class=\"branch\">%s never ran: %s</span>",
+						html.EscapeString(b.Kind), html.EscapeString(strings.Join(missed, ", "))))
+				}
+			}
+		}
+		sb.WriteString("</pre>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteLCOV writes the profile in the LCOV tracefile format read by genhtml,
+// editors and CI coverage services. Each line with statements gets a DA
+// record with its highest count, so a line is hit when any statement on it
+// ran, and each branch arm a BRDA record numbered in the order of b.Arms.
+func WriteLCOV(w io.Writer, p *Profile) error {
+	var sb strings.Builder
+	for _, f := range p.Files() {
+		lines := linesOf(f)
+		sb.WriteString("TN:\n")
+		sb.WriteString(fmt.Sprintf("SF:%s\n", f.Name))
+
+		for block, b := range f.Branches {
+			ran := 0
+			for _, c := range b.Counts {
+				ran += c
+			}
+			for arm, c := range b.Counts {
+				taken := "-"
+				if ran > 0 {
+					taken = fmt.Sprint(c)
+				}
+				sb.WriteString(fmt.Sprintf("BRDA:%d,%d,%d,%s\n", b.Line, block, arm, taken))
+			}
+		}
+		_, _, armHit, armTotal := f.Summary()
+		sb.WriteString(fmt.Sprintf("BRF:%d\nBRH:%d\n", armTotal, armHit))
+
+		found, hit := 0, 0
+		for n := 1; n <= strings.Count(f.Source, "\n")+1; n++ {
+			info := lines[n]
+			if info == nil || info.total == 0 {
+				continue
+			}
+			found++
+			if info.count > 0 {
+				hit++
+			}
+			sb.WriteString(fmt.Sprintf("DA:%d,%d\n", n, info.count))
+		}
+		sb.WriteString(fmt.Sprintf("LF:%d\nLH:%d\n", found, hit))
+		sb.WriteString("end_of_record\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
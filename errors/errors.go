@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"unicode"
 )
 
 // Programming jokes to lighten the mood when errors occur
@@ -253,6 +254,62 @@ func countDigits(n int) int {
 	return count
 }
 
+// caretPadding returns the whitespace that lines a caret up under the given
+// (1-indexed, character-counted) column. Tabs are kept and wide characters
+// take two cells, so the caret lands under the right character in a terminal.
+func caretPadding(line string, col int) string {
+	var sb strings.Builder
+	for i, r := range []rune(line) {
+		if i >= col-1 {
+			break
+		}
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteString(strings.Repeat(" ", runeWidth(r)))
+		}
+	}
+	if missing := col - 1 - len([]rune(line)); missing > 0 {
+		sb.WriteString(strings.Repeat(" ", missing))
+	}
+	return sb.String()
+}
+
+// spanWidth returns the terminal width of the characters in [col, endCol)
+func spanWidth(line string, col, endCol int) int {
+	runes := []rune(line)
+	width := 0
+	for i := col - 1; i < endCol-1; i++ {
+		if i >= 0 && i < len(runes) {
+			width += runeWidth(runes[i])
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// runeWidth approximates how many terminal cells a character occupies
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F, // CJK, Kana, Yi
+		r >= 0xAC00 && r <= 0xD7A3,                // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF,                // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F,                // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60,                // Fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F300 && r <= 0x1F64F, // Emoji
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions
+		return 2
+	default:
+		return 1
+	}
+}
+
 // Format returns the formatted error message with colors and source snippets
 func (e *VictoriaError) Format() string {
 	var sb strings.Builder
@@ -349,10 +406,10 @@ func (e *VictoriaError) Format() string {
 					}
 
 					// Spaces before the caret
-					spaces := strings.Repeat(" ", col-1)
+					spaces := caretPadding(line, col)
 
 					// The caret/underline
-					underlineLen := endCol - col
+					underlineLen := spanWidth(line, col, endCol)
 					if underlineLen < 1 {
 						underlineLen = 1
 					}
@@ -809,14 +866,10 @@ func IndexOutOfBoundsError(index, length int64, loc SourceLocation, source strin
 		err.Help = "check if the collection is empty with len() before accessing"
 	} else {
 		err.Notes = []string{
-			fmt.Sprintf("valid indices are 0 to %d (inclusive)", length-1),
+			fmt.Sprintf("valid indices are 0 to %d, or -%d to -1 counting from the end", length-1, length),
 			"Victoria uses zero-based indexing",
 		}
-		if index < 0 {
-			err.Help = "negative indices are not supported; use len(arr) - 1 for the last element"
-		} else {
-			err.Help = fmt.Sprintf("use an index between 0 and %d", length-1)
-		}
+		err.Help = fmt.Sprintf("use an index between 0 and %d, or -1 for the last element", length-1)
 	}
 
 	return err
@@ -938,6 +991,8 @@ func InvalidArgumentError(funcName string, expected, got int, loc SourceLocation
 		"type":     "type(value) - returns the type of a value as a string",
 		"keys":     "keys(hash) - returns array of hash keys",
 		"values":   "values(hash) - returns array of hash values",
+		"delete":   "delete(hash, key) - removes key and returns whether it was present",
+		"set":      "set([iterable]) - creates a set from an array, set, string or range",
 		"print":    "print(...values) - prints values to stdout",
 		"input":    "input([prompt]) - reads a line from stdin",
 	}
@@ -1429,9 +1484,9 @@ func MemoizationSuggestion(funcName string, loc SourceLocation, source string) *
 		Notes: []string{
 			"memoization stores results of expensive function calls",
 			"it can dramatically improve performance for recursive algorithms",
-			"DSA tip: use a hash map to cache results",
+			"it calls itself more than once on shrinking arguments, so the same calls are repeated",
 		},
-		Help: "add a cache: let memo = {}; if memo[key] != null { return memo[key] }; ... memo[key] = result",
+		Help: fmt.Sprintf("put @memo on the line before 'define %s' to cache its results", funcName),
 	}
 }
 
@@ -1563,22 +1618,30 @@ func IntegerOverflowWarning(operation string, loc SourceLocation, source string)
 	}
 }
 
-// NegativeIndexError creates an error for negative array indices
-func NegativeIndexError(index int64, loc SourceLocation, source string) *VictoriaError {
-	return &VictoriaError{
+// NegativeIndexError creates an error for a negative index that reaches past the start
+func NegativeIndexError(index, length int64, loc SourceLocation, source string) *VictoriaError {
+	err := &VictoriaError{
 		Kind:       KindError,
 		Code:       "E0046",
-		Message:    fmt.Sprintf("negative index: %d", index),
+		Message:    fmt.Sprintf("negative index %d is out of range for length %d", index, length),
 		SourceCode: source,
 		Labels: []Label{
-			{Location: loc, Message: "negative indices not supported", Primary: true},
+			{Location: loc, Message: "counts back past the first element", Primary: true},
 		},
 		Notes: []string{
-			fmt.Sprintf("index %d is negative", index),
-			"Victoria arrays use zero-based positive indexing",
+			"negative indices count from the end: -1 is the last element",
 		},
-		Help: "to access from the end, use: arr[len(arr) - 1] for the last element",
 	}
+
+	if length == 0 {
+		err.Notes = append(err.Notes, "the array/string is empty (length 0)")
+		err.Help = "check if the collection is empty with len() before accessing"
+	} else {
+		err.Notes = append(err.Notes, fmt.Sprintf("the furthest an index can reach back is -%d, the first element", length))
+		err.Help = fmt.Sprintf("use an index between -%d and -1", length)
+	}
+
+	return err
 }
 
 // ConstantReassignmentError creates an error for reassigning constants
@@ -1675,6 +1738,21 @@ func ModuloWithNegativeError(loc SourceLocation, source string) *VictoriaError {
 	}
 }
 
+// AssertionError creates an error for a failed assert. The details, such as
+// the two sides of a comparison and where they differ, become notes.
+func AssertionError(message string, details []string, loc SourceLocation, source string) *VictoriaError {
+	return &VictoriaError{
+		Kind:       KindError,
+		Code:       "E0056",
+		Message:    fmt.Sprintf("assertion failed: %s", message),
+		SourceCode: source,
+		Labels: []Label{
+			{Location: loc, Message: "this assertion is false", Primary: true},
+		},
+		Notes: details,
+	}
+}
+
 // MakeDirectiveError creates an error for invalid #make directive
 func MakeDirectiveError(message string, loc SourceLocation, source string) *VictoriaError {
 	return &VictoriaError{
@@ -1692,3 +1770,21 @@ func MakeDirectiveError(message string, loc SourceLocation, source string) *Vict
 		Help: "example: #make MOD 1000000007 or #make MAX_N 100005",
 	}
 }
+
+// ConditionalDirectiveError creates an error for invalid #if/#else/#endif directives
+func ConditionalDirectiveError(message string, loc SourceLocation, source string) *VictoriaError {
+	return &VictoriaError{
+		Kind:       KindError,
+		Code:       "E0051",
+		Message:    fmt.Sprintf("conditional directive error: %s", message),
+		SourceCode: source,
+		Labels: []Label{
+			{Location: loc, Message: "invalid conditional directive", Primary: true},
+		},
+		Notes: []string{
+			"every #if must be closed by a matching #endif, with at most one #else",
+			"names that are not defined by #make or -D evaluate to 0",
+		},
+		Help: "example: #if DEBUG ... #else ... #endif",
+	}
+}
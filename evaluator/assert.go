@@ -0,0 +1,232 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"victoria/ast"
+	"victoria/object"
+)
+
+// maxAssertDiffs caps the differences listed for a failed assert, so that
+// comparing two long arrays does not bury the first mismatch
+const maxAssertDiffs = 8
+
+// evalAssertStatement evaluates assert condition, "message". When the
+// condition is a comparison both sides are kept, so a failure can show what
+// they were and, for containers, where they differ. The failure is an
+// ordinary error and can be caught with try/catch.
+func evalAssertStatement(node *ast.AssertStatement, env *object.Environment) object.Object {
+	var passed bool
+	var details []string
+
+	if infix, ok := node.Condition.(*ast.InfixExpression); ok && isComparisonOperator(infix.Operator) {
+		left := Eval(infix.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(infix.Right, env)
+		if isError(right) {
+			return right
+		}
+		result := evalInfixExpression(infix.Operator, left, right)
+		if isError(result) {
+			return result
+		}
+		passed = isTruthy(result)
+		if !passed {
+			details = comparisonDetails(infix, left, right)
+		}
+	} else {
+		value := Eval(node.Condition, env)
+		if isError(value) {
+			return value
+		}
+		passed = isTruthy(value)
+		if !passed {
+			details = []string{fmt.Sprintf("%s evaluated to %s", node.Condition.String(), assertValue(value))}
+		}
+	}
+
+	if passed {
+		return NULL
+	}
+
+	message := node.Condition.String()
+	if node.Message != nil {
+		msg := Eval(node.Message, env)
+		if isError(msg) {
+			return msg
+		}
+		message = msg.Inspect()
+	}
+
+	endColumn := node.Start.EndColumn
+	if node.End.Line == node.Start.Line {
+		endColumn = node.End.EndColumn
+	}
+	err := newErrorWithLocation("assertion failed: %s", node.Start.Line, node.Start.Column, endColumn, message)
+	err.Details = details
+	return err
+}
+
+func isComparisonOperator(operator string) bool {
+	switch operator {
+	case "==", "!=", "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+// comparisonDetails describes both sides of a failed comparison and, when
+// they are containers of the same kind, each place where they differ
+func comparisonDetails(infix *ast.InfixExpression, left, right object.Object) []string {
+	details := []string{
+		"left:  " + describeOperand(infix.Left, left),
+		"right: " + describeOperand(infix.Right, right),
+	}
+	if infix.Operator != "==" {
+		return details
+	}
+
+	var diffs []string
+	diffValues("", left, right, &diffs, 0)
+	if len(diffs) > maxAssertDiffs {
+		more := len(diffs) - maxAssertDiffs
+		diffs = append(diffs[:maxAssertDiffs], fmt.Sprintf("... and %d more differences", more))
+	}
+	return append(details, diffs...)
+}
+
+// describeOperand shows one side of a comparison as "expression is value",
+// or just the value when the expression is a literal that says the same
+func describeOperand(expr ast.Expression, value object.Object) string {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.CharLiteral,
+		*ast.Boolean, *ast.NullLiteral, *ast.ArrayLiteral, *ast.HashLiteral, *ast.SetLiteral,
+		*ast.StructInstantiation:
+		return assertValue(value)
+	}
+	return fmt.Sprintf("%s is %s", expr.String(), assertValue(value))
+}
+
+// diffValues appends a line to diffs for each place where left and right
+// differ, naming the path to it such as [2]["name"]. Scalars and values of
+// different kinds are reported whole; it stops once there are more
+// differences than will be shown.
+func diffValues(path string, left, right object.Object, diffs *[]string, depth int) {
+	if len(*diffs) > maxAssertDiffs || objectsEqual(left, right) {
+		return
+	}
+	at := path
+	if at == "" {
+		at = "the top level"
+	}
+	differ := func() {
+		*diffs = append(*diffs, fmt.Sprintf("at %s: left has %s, right has %s", at, assertValue(left), assertValue(right)))
+	}
+	if depth > 32 {
+		differ()
+		return
+	}
+
+	switch l := left.(type) {
+	case *object.Array:
+		r, ok := right.(*object.Array)
+		if !ok {
+			differ()
+			return
+		}
+		if len(l.Elements) != len(r.Elements) {
+			*diffs = append(*diffs, fmt.Sprintf("at %s: left has %d elements, right has %d", at, len(l.Elements), len(r.Elements)))
+		}
+		for i := 0; i < len(l.Elements) || i < len(r.Elements); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(r.Elements):
+				*diffs = append(*diffs, fmt.Sprintf("at %s: only the left has %s", elemPath, assertValue(l.Elements[i])))
+			case i >= len(l.Elements):
+				*diffs = append(*diffs, fmt.Sprintf("at %s: only the right has %s", elemPath, assertValue(r.Elements[i])))
+			default:
+				diffValues(elemPath, l.Elements[i], r.Elements[i], diffs, depth+1)
+			}
+		}
+
+	case *object.Hash:
+		r, ok := right.(*object.Hash)
+		if !ok {
+			differ()
+			return
+		}
+		for _, pair := range l.Pairs() {
+			keyPath := fmt.Sprintf("%s[%s]", path, assertValue(pair.Key))
+			key, _ := object.HashKeyOf(pair.Key)
+			if other, ok := r.Get(pair.Key, key); ok {
+				diffValues(keyPath, pair.Value, other.Value, diffs, depth+1)
+			} else {
+				*diffs = append(*diffs, fmt.Sprintf("at %s: only the left has %s", keyPath, assertValue(pair.Value)))
+			}
+		}
+		for _, pair := range r.Pairs() {
+			key, _ := object.HashKeyOf(pair.Key)
+			if _, ok := l.Get(pair.Key, key); !ok {
+				keyPath := fmt.Sprintf("%s[%s]", path, assertValue(pair.Key))
+				*diffs = append(*diffs, fmt.Sprintf("at %s: only the right has %s", keyPath, assertValue(pair.Value)))
+			}
+		}
+
+	case *object.Set:
+		r, ok := right.(*object.Set)
+		if !ok {
+			differ()
+			return
+		}
+		for _, elem := range l.Elements() {
+			if key, _ := object.HashKeyOf(elem); !r.Has(elem, key) {
+				*diffs = append(*diffs, fmt.Sprintf("in %s: only the left has %s", at, assertValue(elem)))
+			}
+		}
+		for _, elem := range r.Elements() {
+			if key, _ := object.HashKeyOf(elem); !l.Has(elem, key) {
+				*diffs = append(*diffs, fmt.Sprintf("in %s: only the right has %s", at, assertValue(elem)))
+			}
+		}
+
+	case *object.StructInstance:
+		r, ok := right.(*object.StructInstance)
+		if !ok || l.Struct.Name != r.Struct.Name {
+			differ()
+			return
+		}
+		if _, custom := l.Struct.Methods["__eq"]; custom {
+			differ()
+			return
+		}
+		for _, name := range l.Struct.Fields {
+			lv, lok := l.Fields[name]
+			rv, rok := r.Fields[name]
+			switch {
+			case lok && rok:
+				diffValues(path+"."+name, lv, rv, diffs, depth+1)
+			case lok:
+				*diffs = append(*diffs, fmt.Sprintf("at %s.%s: only the left has %s", path, name, assertValue(lv)))
+			case rok:
+				*diffs = append(*diffs, fmt.Sprintf("at %s.%s: only the right has %s", path, name, assertValue(rv)))
+			}
+		}
+
+	default:
+		differ()
+	}
+}
+
+// assertValue shows a value in an assertion report. Strings are quoted so
+// that "1" and 1, or a trailing space, are told apart.
+func assertValue(obj object.Object) string {
+	if obj == nil {
+		return "null"
+	}
+	if s, ok := obj.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
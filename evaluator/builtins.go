@@ -3,30 +3,18 @@ package evaluator
 import (
 	"bufio"
 	"fmt"
+	"math/big"
+	"math/bits"
 	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 	"victoria/object"
 )
 
 // builtins is a map of built-in functions available in the Victoria language
 var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
+	"len": nil, // initialized in init()
 	"print": {
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
@@ -93,12 +81,7 @@ var builtins = map[string]*object.Builtin{
 				return newError("argument 1 to `format` must be STRING, got %s", args[0].Type())
 			}
 
-			var fmtArgs []interface{}
-			for _, arg := range args[1:] {
-				fmtArgs = append(fmtArgs, unwrapObject(arg))
-			}
-
-			return &object.String{Value: fmt.Sprintf(formatStr.Value, fmtArgs...)}
+			return formatTemplate(formatStr.Value, args[1:])
 		},
 	},
 	"input": {
@@ -120,16 +103,23 @@ var builtins = map[string]*object.Builtin{
 	},
 	"int": {
 		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 2 {
+				return parseIntWithBase(args[0], args[1])
+			}
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
 			}
 
 			switch arg := args[0].(type) {
-			case *object.Integer:
+			case *object.Integer, *object.BigInteger:
 				return arg
 			case *object.String:
 				val, err := strconv.ParseInt(arg.Value, 0, 64)
 				if err != nil {
+					// Fall back to an arbitrary-precision integer for large values
+					if bigVal, ok := new(big.Int).SetString(arg.Value, 0); ok {
+						return object.NewBigInteger(bigVal)
+					}
 					return newError("could not parse %q as integer", arg.Value)
 				}
 				return &object.Integer{Value: val}
@@ -143,6 +133,22 @@ var builtins = map[string]*object.Builtin{
 			}
 		},
 	},
+	"toBase": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			value, ok := object.ToBigInt(args[0])
+			if !ok {
+				return newError("first argument to `toBase` must be INTEGER, got %s", args[0].Type())
+			}
+			base, errObj := baseArgument("toBase", args[1])
+			if errObj != nil {
+				return errObj
+			}
+			return &object.String{Value: value.Text(base)}
+		},
+	},
 	"char": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -437,6 +443,14 @@ var builtins = map[string]*object.Builtin{
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
+			// Big integers are an implementation detail of int, and a
+			// memoized function is still a function
+			if args[0].Type() == object.BIG_INTEGER_OBJ {
+				return &object.String{Value: object.INTEGER_OBJ}
+			}
+			if args[0].Type() == object.MEMOIZED_OBJ {
+				return &object.String{Value: object.FUNCTION_OBJ}
+			}
 			return &object.String{Value: string(args[0].Type())}
 		},
 	},
@@ -531,11 +545,11 @@ var builtins = map[string]*object.Builtin{
 			if args[0].Type() != object.STRING_OBJ {
 				return newError("argument 1 to `split` must be STRING, got %s", args[0].Type())
 			}
-			if args[1].Type() != object.STRING_OBJ {
+			sep, ok := textArgument(args[1])
+			if !ok {
 				return newError("argument 2 to `split` must be STRING, got %s", args[1].Type())
 			}
 			str := args[0].(*object.String).Value
-			sep := args[1].(*object.String).Value
 			parts := strings.Split(str, sep)
 			elements := make([]object.Object, len(parts))
 			for i, p := range parts {
@@ -583,15 +597,18 @@ var builtins = map[string]*object.Builtin{
 				}
 				return FALSE
 			case *object.String:
-				if args[1].Type() != object.STRING_OBJ {
+				substr, ok := textArgument(args[1])
+				if !ok {
 					return newError("argument 2 to `contains` on string must be STRING")
 				}
-				if strings.Contains(container.Value, args[1].(*object.String).Value) {
+				if strings.Contains(container.Value, substr) {
 					return TRUE
 				}
 				return FALSE
+			case *object.Range:
+				return nativeBoolToBooleanObject(rangeContains(container, args[1]))
 			default:
-				return newError("argument 1 to `contains` must be ARRAY or STRING, got %s", args[0].Type())
+				return newError("argument 1 to `contains` must be ARRAY, STRING or RANGE, got %s", args[0].Type())
 			}
 		},
 	},
@@ -609,16 +626,54 @@ var builtins = map[string]*object.Builtin{
 				}
 				return &object.Integer{Value: -1}
 			case *object.String:
-				if args[1].Type() != object.STRING_OBJ {
+				substr, ok := textArgument(args[1])
+				if !ok {
 					return newError("argument 2 to `index` on string must be STRING")
 				}
-				idx := strings.Index(container.Value, args[1].(*object.String).Value)
-				return &object.Integer{Value: int64(idx)}
+				// Report the position in code points, matching s[i]
+				idx := strings.Index(container.Value, substr)
+				if idx < 0 {
+					return &object.Integer{Value: -1}
+				}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(container.Value[:idx]))}
 			default:
 				return newError("argument 1 to `index` must be ARRAY or STRING, got %s", args[0].Type())
 			}
 		},
 	},
+	"bytes": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
+			}
+			elements := make([]object.Object, len(str.Value))
+			for i := 0; i < len(str.Value); i++ {
+				elements[i] = &object.Byte{Value: str.Value[i]}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"runes": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `runes` must be STRING, got %s", args[0].Type())
+			}
+			runes := []rune(str.Value)
+			elements := make([]object.Object, len(runes))
+			for i, r := range runes {
+				elements[i] = &object.Rune{Value: r}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
 	"upper": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -651,12 +706,53 @@ var builtins = map[string]*object.Builtin{
 			}
 			hash := args[0].(*object.Hash)
 			elements := []object.Object{}
-			for _, pair := range hash.Pairs {
+			for _, pair := range hash.Pairs() {
 				elements = append(elements, pair.Key)
 			}
 			return &object.Array{Elements: elements}
 		},
 	},
+	"delete": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != object.HASH_OBJ {
+				return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := object.HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			return nativeBoolToBooleanObject(args[0].(*object.Hash).Delete(args[1], key))
+		},
+	},
+	"set": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 {
+				return object.NewSet()
+			}
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return newSetFrom(arg.Elements)
+			case *object.Set:
+				return newSetFrom(arg.Elements())
+			case *object.String:
+				elements := []object.Object{}
+				for _, ch := range arg.Value {
+					elements = append(elements, &object.String{Value: string(ch)})
+				}
+				return newSetFrom(elements)
+			case *object.Range:
+				return newSetFrom(rangeElements(arg))
+			default:
+				return newError("argument to `set` must be ARRAY, SET, STRING or RANGE, got %s", args[0].Type())
+			}
+		},
+	},
 	"values": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -667,18 +763,105 @@ var builtins = map[string]*object.Builtin{
 			}
 			hash := args[0].(*object.Hash)
 			elements := []object.Object{}
-			for _, pair := range hash.Pairs {
+			for _, pair := range hash.Pairs() {
 				elements = append(elements, pair.Value)
 			}
 			return &object.Array{Elements: elements}
 		},
 	},
+	"popcount": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, err := bitArgument("popcount", args[0])
+			if err != nil {
+				return err
+			}
+			return &object.Integer{Value: int64(popcount(n))}
+		},
+	},
+	"clz": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, err := bitArgument("clz", args[0])
+			if err != nil {
+				return err
+			}
+			if !n.IsUint64() {
+				return newError("argument to `clz` must fit in 64 bits, got %s", n)
+			}
+			return &object.Integer{Value: int64(bits.LeadingZeros64(n.Uint64()))}
+		},
+	},
+	"ctz": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, err := bitArgument("ctz", args[0])
+			if err != nil {
+				return err
+			}
+			if n.Sign() == 0 {
+				return &object.Integer{Value: 64}
+			}
+			return &object.Integer{Value: int64(n.TrailingZeroBits())}
+		},
+	},
+	"bit": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			n, err := bitArgument("bit", args[0])
+			if err != nil {
+				return err
+			}
+			i, err := bitArgument("bit", args[1])
+			if err != nil {
+				return err
+			}
+			if !i.IsInt64() || i.Int64() > maxShiftAmount {
+				return newError("shift amount too large: %s (maximum is %d)", i, maxShiftAmount)
+			}
+			return nativeBoolToBooleanObject(n.Bit(int(i.Int64())) == 1)
+		},
+	},
+	"memo":   memoBuiltin,
 	"map":    nil, // initialized in init()
 	"filter": nil, // initialized in init()
 	"reduce": nil, // initialized in init()
 }
 
 func init() {
+	builtins["len"] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(arg.Len())}
+			case *object.Set:
+				return &object.Integer{Value: int64(arg.Len())}
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
+			case *object.StructInstance:
+				return evalLenMethod(arg)
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	}
+
 	builtins["map"] = &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
@@ -781,3 +964,18 @@ func init() {
 		},
 	}
 }
+
+// textArgument accepts a STRING or a single CHAR/RUNE where a substring or
+// separator is expected
+func textArgument(arg object.Object) (string, bool) {
+	switch arg := arg.(type) {
+	case *object.String:
+		return arg.Value, true
+	case *object.Char:
+		return string(arg.Value), true
+	case *object.Rune:
+		return string(arg.Value), true
+	default:
+		return "", false
+	}
+}
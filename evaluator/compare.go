@@ -0,0 +1,269 @@
+package evaluator
+
+import (
+	"math/big"
+	"strings"
+	"victoria/object"
+)
+
+// objectsEqual reports whether a and b are structurally equal. Numbers compare
+// by value across int and float, arrays element by element, hashes and sets
+// by membership regardless of order, and struct instances with __eq or else
+// field by field. Functions and other reference types are equal only to
+// themselves.
+func objectsEqual(a, b object.Object) bool {
+	return equalValues(a, b, make(map[[2]object.Object]bool))
+}
+
+// equalValues is objectsEqual with a record of the container pairs being
+// compared, so that a self-referencing array does not recurse forever
+func equalValues(a, b object.Object, inProgress map[[2]object.Object]bool) bool {
+	if a == b {
+		return true
+	}
+	if isNumber(a) && isNumber(b) {
+		cmp, _ := compareNumbers(a, b)
+		return cmp == 0 && !isNaN(a) && !isNaN(b)
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Char:
+		return a.Value == b.(*object.Char).Value
+	case *object.Rune:
+		return a.Value == b.(*object.Rune).Value
+	case *object.Byte:
+		return a.Value == b.(*object.Byte).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.EnumValue:
+		other := b.(*object.EnumValue)
+		return a.EnumName == other.EnumName && a.ValueName == other.ValueName
+	case *object.Range:
+		// Ranges are equal when they produce the same elements
+		other := b.(*object.Range)
+		n := a.Len()
+		if a.IsChar != other.IsChar || n != other.Len() {
+			return false
+		}
+		return n == 0 || (a.Start == other.Start && (n == 1 || a.StepSize() == other.StepSize()))
+	}
+
+	pair := [2]object.Object{a, b}
+	if inProgress[pair] {
+		return true
+	}
+	inProgress[pair] = true
+	defer delete(inProgress, pair)
+
+	switch a := a.(type) {
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, elem := range a.Elements {
+			if !equalValues(elem, other.Elements[i], inProgress) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if a.Len() != other.Len() {
+			return false
+		}
+		for _, pair := range a.Pairs() {
+			key, _ := object.HashKeyOf(pair.Key)
+			otherPair, ok := other.Get(pair.Key, key)
+			if !ok || !equalValues(pair.Value, otherPair.Value, inProgress) {
+				return false
+			}
+		}
+		return true
+	case *object.Set:
+		other := b.(*object.Set)
+		if a.Len() != other.Len() {
+			return false
+		}
+		for _, elem := range a.Elements() {
+			key, _ := object.HashKeyOf(elem)
+			if !other.Has(elem, key) {
+				return false
+			}
+		}
+		return true
+	case *object.StructInstance:
+		if result, ok := callStructMethod(a, "__eq", b); ok {
+			return !isError(result) && isTruthy(result)
+		}
+		other := b.(*object.StructInstance)
+		if a.Struct.Name != other.Struct.Name || len(a.Fields) != len(other.Fields) {
+			return false
+		}
+		for name, value := range a.Fields {
+			otherValue, ok := other.Fields[name]
+			if !ok || !equalValues(value, otherValue, inProgress) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// compareValues orders a and b, returning -1, 0 or 1. Numbers compare by
+// value, strings by code point, chars, runes and bytes by value, and arrays
+// lexicographically. Struct instances are ordered by their compare method.
+func compareValues(a, b object.Object) (int, *object.Error) {
+	if isNumber(a) && isNumber(b) {
+		return compareNumbers(a, b)
+	}
+
+	switch a := a.(type) {
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return strings.Compare(a.Value, b.Value), nil
+		}
+	case *object.Char:
+		if b, ok := b.(*object.Char); ok {
+			return compareInt64(int64(a.Value), int64(b.Value)), nil
+		}
+	case *object.Rune:
+		if b, ok := b.(*object.Rune); ok {
+			return compareInt64(int64(a.Value), int64(b.Value)), nil
+		}
+	case *object.Byte:
+		if b, ok := b.(*object.Byte); ok {
+			return compareInt64(int64(a.Value), int64(b.Value)), nil
+		}
+	case *object.Array:
+		if b, ok := b.(*object.Array); ok {
+			for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+				cmp, err := compareValues(a.Elements[i], b.Elements[i])
+				if err != nil || cmp != 0 {
+					return cmp, err
+				}
+			}
+			return compareInt64(int64(len(a.Elements)), int64(len(b.Elements))), nil
+		}
+	case *object.StructInstance:
+		if b, ok := b.(*object.StructInstance); ok && a.Struct.Name == b.Struct.Name {
+			return compareStructs(a, b)
+		}
+	}
+
+	if a.Type() != b.Type() {
+		return 0, newError("cannot compare %s with %s", object.TypeName(a), object.TypeName(b))
+	}
+	return 0, newError("no ordering defined for %s", object.TypeName(a))
+}
+
+// compareStructs orders two instances of the same struct with the struct's
+// compare(other) method, which must return a negative, zero or positive int.
+// Structs that only define __lt are ordered with it instead.
+func compareStructs(a, b *object.StructInstance) (int, *object.Error) {
+	result, ok := callStructMethod(a, "compare", b)
+	if !ok {
+		if _, ok := a.Struct.Methods["__lt"]; ok {
+			return compareWithLess(a, b)
+		}
+		return 0, newError("no ordering defined for %s: define %s.compare(other) returning an int", a.Struct.Name, a.Struct.Name)
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return 0, errObj
+	}
+	n, ok := result.(*object.Integer)
+	if !ok {
+		return 0, newError("%s.compare must return an int, got %s", a.Struct.Name, object.TypeName(result))
+	}
+	return compareInt64(n.Value, 0), nil
+}
+
+func compareWithLess(a, b *object.StructInstance) (int, *object.Error) {
+	less, _ := callStructMethod(a, "__lt", b)
+	if errObj, ok := less.(*object.Error); ok {
+		return 0, errObj
+	}
+	if isTruthy(less) {
+		return -1, nil
+	}
+	greater, _ := callStructMethod(b, "__lt", a)
+	if errObj, ok := greater.(*object.Error); ok {
+		return 0, errObj
+	}
+	if isTruthy(greater) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// evalComparison applies an ordering operator using compareValues
+func evalComparison(operator string, left, right object.Object) object.Object {
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return err
+	}
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(cmp > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(cmp <= 0)
+	default:
+		return nativeBoolToBooleanObject(cmp >= 0)
+	}
+}
+
+func isOrderingOperator(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+func isNumber(obj object.Object) bool {
+	return isIntegral(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func isNaN(obj object.Object) bool {
+	f, ok := obj.(*object.Float)
+	return ok && f.Value != f.Value
+}
+
+// compareNumbers orders two ints or floats. Floats are compared exactly
+// against big integers rather than by converting the integer to a float.
+func compareNumbers(a, b object.Object) (int, *object.Error) {
+	if isIntegral(a) && isIntegral(b) {
+		aVal, _ := object.ToBigInt(a)
+		bVal, _ := object.ToBigInt(b)
+		return aVal.Cmp(bVal), nil
+	}
+	if isNaN(a) || isNaN(b) {
+		return 0, nil
+	}
+	return toBigFloat(a).Cmp(toBigFloat(b)), nil
+}
+
+func toBigFloat(obj object.Object) *big.Float {
+	if f, ok := obj.(*object.Float); ok {
+		return big.NewFloat(f.Value)
+	}
+	n, _ := object.ToBigInt(obj)
+	return new(big.Float).SetInt(n)
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
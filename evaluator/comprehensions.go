@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"victoria/ast"
+	"victoria/object"
+)
+
+func evalListComprehension(node *ast.ListComprehension, env *object.Environment) object.Object {
+	elements := []object.Object{}
+
+	errObj := evalComprehensionClauses(node.Clauses, env, func(scope *object.Environment) object.Object {
+		elem := Eval(node.Element, scope)
+		if isError(elem) {
+			return elem
+		}
+		elements = append(elements, elem)
+		return nil
+	})
+	if errObj != nil {
+		return errObj
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func evalHashComprehension(node *ast.HashComprehension, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	errObj := evalComprehensionClauses(node.Clauses, env, func(scope *object.Environment) object.Object {
+		key := Eval(node.Key, scope)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := object.HashKeyOf(key)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		value := Eval(node.Value, scope)
+		if isError(value) {
+			return value
+		}
+		hash.Set(key, hashKey, value)
+		return nil
+	})
+	if errObj != nil {
+		return errObj
+	}
+
+	return hash
+}
+
+// evalComprehensionClauses runs the nested loops described by clauses and
+// calls emit in the innermost scope for every combination that passes the
+// filters. Loop variables live in their own scope and do not leak. A non-nil
+// result from emit or from evaluating a clause stops the loops.
+func evalComprehensionClauses(clauses []*ast.ComprehensionClause, env *object.Environment, emit func(*object.Environment) object.Object) object.Object {
+	if len(clauses) == 0 {
+		return emit(env)
+	}
+	clause := clauses[0]
+
+	iterable := Eval(clause.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	iterable = iterableOf(iterable)
+	if isError(iterable) {
+		return iterable
+	}
+	_, isHash := iterable.(*object.Hash)
+
+	return forEachPair(iterable, func(key, value object.Object) object.Object {
+		scope := object.NewEnclosedEnvironment(env)
+		switch {
+		case clause.Index != nil:
+			scope.Set(clause.Index.Value, key)
+			scope.Set(clause.Item.Value, value)
+		case isHash:
+			scope.Set(clause.Item.Value, key)
+		default:
+			scope.Set(clause.Item.Value, value)
+		}
+
+		for _, cond := range clause.Conditions {
+			keep := Eval(cond, scope)
+			if isError(keep) {
+				return keep
+			}
+			if !isTruthy(keep) {
+				return nil
+			}
+		}
+
+		return evalComprehensionClauses(clauses[1:], scope, emit)
+	})
+}
+
+// forEachPair calls fn with the position and element of every item of
+// iterable, or the key and value for hashes. It stops at the first non-nil
+// result of fn and returns it.
+func forEachPair(iterable object.Object, fn func(key, value object.Object) object.Object) object.Object {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, elem := range iterable.Elements {
+			if result := fn(&object.Integer{Value: int64(i)}, elem); result != nil {
+				return result
+			}
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			if result := fn(pair.Key, pair.Value); result != nil {
+				return result
+			}
+		}
+	case *object.String:
+		for i, char := range []rune(iterable.Value) {
+			if result := fn(&object.Integer{Value: int64(i)}, &object.String{Value: string(char)}); result != nil {
+				return result
+			}
+		}
+	case *object.Set:
+		for i, elem := range iterable.Elements() {
+			if result := fn(&object.Integer{Value: int64(i)}, elem); result != nil {
+				return result
+			}
+		}
+	case *object.Range:
+		for i := int64(0); i < iterable.Len(); i++ {
+			if result := fn(&object.Integer{Value: i}, iterable.Element(i)); result != nil {
+				return result
+			}
+		}
+	case *object.Iterator:
+		if iterable.Close != nil {
+			defer iterable.Close()
+		}
+		for i := int64(0); ; i++ {
+			value, ok := iterable.Next()
+			if !ok {
+				break
+			}
+			if isError(value) {
+				return value
+			}
+			if result := fn(&object.Integer{Value: i}, value); result != nil {
+				return result
+			}
+		}
+	default:
+		return newError("not iterable: %s", iterable.Type())
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"unicode/utf8"
 	"victoria/ast"
 	"victoria/lexer"
 	"victoria/object"
@@ -44,7 +45,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if node.Type != nil {
 			if !object.CheckType(val, node.Type) {
 				return newErrorWithLocation("type mismatch: cannot assign %s to variable of type %s",
-					node.Token.Line, node.Token.Column, node.Token.EndColumn+len(node.Name.Value),
+					node.Token.Line, node.Token.Column, node.Token.EndColumn+utf8.RuneCountInString(node.Name.Value),
 					object.TypeName(val), node.Type.String())
 			}
 		}
@@ -59,7 +60,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if node.Type != nil {
 			if !object.CheckType(val, node.Type) {
 				return newErrorWithLocation("type mismatch: cannot assign %s to constant of type %s",
-					node.Token.Line, node.Token.Column, node.Token.EndColumn+len(node.Name.Value),
+					node.Token.Line, node.Token.Column, node.Token.EndColumn+utf8.RuneCountInString(node.Name.Value),
 					object.TypeName(val), node.Type.String())
 			}
 		}
@@ -110,6 +111,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		env.SetConst(node.Name.Value, enumObj)
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
 	case *ast.FloatLiteral:
@@ -119,7 +123,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Char{Value: node.Value}
 
 	case *ast.StringLiteral:
-		return evalStringLiteral(node.Value, env)
+		result := evalStringLiteral(node.Value, env)
+		if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+			errObj.Line = node.Token.Line
+			errObj.Column = node.Token.Column
+			errObj.EndColumn = node.Token.EndColumn
+		}
+		return result
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
@@ -147,14 +157,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPostfixExpression(node, env)
 
 	case *ast.InfixExpression:
-		if node.Operator == "=" || node.Operator == "+=" || node.Operator == "-=" || node.Operator == "*=" || node.Operator == "/=" || node.Operator == "%=" {
+		if _, isCompound := compoundOperators[node.Operator]; isCompound || node.Operator == "=" {
 			return evalAssignmentExpression(node, env)
 		}
 
-		if node.Operator == "." {
+		if node.Operator == "." || node.Operator == "?." {
 			return evalDotExpression(node, env)
 		}
 
+		// ?? falls back to the right side only when the left side is null
+		if node.Operator == "??" {
+			left := Eval(node.Left, env)
+			if left != NULL {
+				traceBranch(node, 1)
+				return left
+			}
+			traceBranch(node, 0)
+			return Eval(node.Right, env)
+		}
+
 		// Short-circuit evaluation for && and ||
 		if node.Operator == "&&" || node.Operator == "and" {
 			left := Eval(node.Left, env)
@@ -162,8 +183,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 				return left
 			}
 			if !isTruthy(left) {
+				traceBranch(node, 1)
 				return FALSE
 			}
+			traceBranch(node, 0)
 			right := Eval(node.Right, env)
 			if isError(right) {
 				return right
@@ -177,8 +200,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 				return left
 			}
 			if isTruthy(left) {
+				traceBranch(node, 1)
 				return TRUE
 			}
+			traceBranch(node, 0)
 			right := Eval(node.Right, env)
 			if isError(right) {
 				return right
@@ -216,13 +241,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{
+		fn := &object.Function{
 			Parameters:      params,
 			TypedParameters: node.TypedParameters,
 			ReturnTypes:     node.ReturnTypes,
 			Env:             env,
 			Body:            body,
+			IsGenerator:     node.IsGenerator,
+		}
+		if len(node.Decorators) > 0 {
+			return applyDecorators(fn, node.Decorators, env)
 		}
+		return fn
 
 	case *ast.ArrowFunction:
 		params := node.Parameters
@@ -234,6 +264,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(function) {
 			return function
 		}
+		if function == NULL && isOptionalCall(node.Function) {
+			return NULL
+		}
 
 		args := evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
@@ -248,6 +281,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return result
 
+	case *ast.PipeExpression:
+		return evalPipeExpression(node, env)
+
 	case *ast.ArrayLiteral:
 		elements := evalArrayElements(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -255,16 +291,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 
+	case *ast.ListComprehension:
+		return evalListComprehension(node, env)
+
+	case *ast.HashComprehension:
+		return evalHashComprehension(node, env)
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Optional && left == NULL {
+			return NULL
+		}
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		result := evalIndexExpression(left, index)
+		var result object.Object
+		if node.Optional {
+			result = evalOptionalIndex(left, index)
+		} else {
+			result = evalIndexExpression(left, index)
+		}
 		if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
 			errObj.Line = node.Token.Line
 			errObj.Column = node.Token.Column
@@ -281,6 +331,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
+	case *ast.SetLiteral:
+		return evalSetLiteral(node, env)
+
 	case *ast.StructLiteral:
 		s := &object.Struct{Name: node.Name.Value}
 		for _, f := range node.Fields {
@@ -293,9 +346,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalStructInstantiation(node, env)
 
 	case *ast.MethodDefinition:
-		fn := &object.Function{Parameters: node.Parameters, Env: env, Body: node.Body}
+		fn := &object.Function{Parameters: node.Parameters, Env: env, Body: node.Body, IsGenerator: node.IsGenerator}
 		key := node.StructName.Value + "." + node.MethodName.Value
 		env.Set(key, fn)
+		if s, ok := env.Get(node.StructName.Value); ok {
+			if s, ok := s.(*object.Struct); ok {
+				if s.Methods == nil {
+					s.Methods = make(map[string]*object.Function)
+				}
+				s.Methods[node.MethodName.Value] = fn
+			}
+		}
 		return NULL
 
 	case *ast.WhileExpression:
@@ -311,10 +372,24 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalCForExpression(node, env)
 
 	case *ast.BreakStatement:
-		return &object.Break{}
+		return &object.Break{Label: node.Label}
+
+	case *ast.YieldStatement:
+		return evalYieldStatement(node, env)
+
+	case *ast.AssertStatement:
+		return evalAssertStatement(node, env)
+
+	case *ast.TestBlock:
+		// Tests only run under `victoria test`
+		return NULL
+
+	case *ast.BenchBlock:
+		// Benchmarks only run under `victoria bench`
+		return NULL
 
 	case *ast.ContinueStatement:
-		return &object.Continue{}
+		return &object.Continue{Label: node.Label}
 
 	case *ast.SwitchExpression:
 		return evalSwitchExpression(node, env)
@@ -333,6 +408,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
+		traceStatement(statement)
 		result = Eval(statement, env)
 
 		switch result := result.(type) {
@@ -352,6 +428,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	blockEnv := object.NewEnclosedEnvironment(env)
 
 	for _, statement := range block.Statements {
+		traceStatement(statement)
 		result = Eval(statement, blockEnv)
 
 		if result != nil {
@@ -398,7 +475,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 }
 
 func evalStringLiteral(s string, env *object.Environment) object.Object {
-	s = processEscapeSequences(s)
+	s = lexer.Unescape(s)
 
 	result := ""
 	i := 0
@@ -415,7 +492,7 @@ func evalStringLiteral(s string, env *object.Environment) object.Object {
 				j++
 			}
 			if depth == 0 {
-				exprStr := s[i+2 : j-1]
+				exprStr, spec, hasSpec := splitInterpolation(s[i+2 : j-1])
 				l := lexer.New(exprStr)
 				p := parser.New(l)
 				program := p.ParseProgram()
@@ -429,55 +506,25 @@ func evalStringLiteral(s string, env *object.Environment) object.Object {
 					if isError(val) {
 						return val
 					}
-					if val != nil {
+					if val != nil && hasSpec {
+						text, errObj := formatValue(val, spec)
+						if errObj != nil {
+							return errObj
+						}
+						result += text
+					} else if val != nil {
 						result += val.Inspect()
 					}
 				}
 				i = j
 			} else {
-				result += string(s[i])
+				result += s[i : i+1]
 				i++
 			}
 		} else {
-			result += string(s[i])
+			result += s[i : i+1]
 			i++
 		}
 	}
 	return &object.String{Value: result}
 }
-
-func processEscapeSequences(s string) string {
-	result := ""
-	i := 0
-	for i < len(s) {
-		if s[i] == '\\' && i+1 < len(s) {
-			switch s[i+1] {
-			case 'n':
-				result += "\n"
-				i += 2
-			case 't':
-				result += "\t"
-				i += 2
-			case 'r':
-				result += "\r"
-				i += 2
-			case '\\':
-				result += "\\"
-				i += 2
-			case '"':
-				result += "\""
-				i += 2
-			case '$':
-				result += "$"
-				i += 2
-			default:
-				result += string(s[i])
-				i++
-			}
-		} else {
-			result += string(s[i])
-			i++
-		}
-	}
-	return result
-}
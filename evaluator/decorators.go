@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"victoria/ast"
+	"victoria/object"
+)
+
+// applyDecorators wraps fn in the decorators written above its declaration,
+// starting with the one nearest the function, and returns the result:
+// @a @b define f() {} binds f to a(b(f)). A decorator with arguments, like
+// @retry(3), is called first and must return the decorator to apply.
+func applyDecorators(fn object.Object, decorators []ast.Expression, env *object.Environment) object.Object {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		decorator := Eval(decorators[i], env)
+		if isError(decorator) {
+			return decorator
+		}
+		if !isCallable(decorator) {
+			return newError("decorator @%s is not a function: %s", decorators[i].String(), decorator.Type())
+		}
+
+		wrapped := applyFunction(decorator, []object.Object{fn})
+		if isError(wrapped) {
+			return wrapped
+		}
+		if !isCallable(wrapped) {
+			return newError("decorator @%s must return a function, got %s", decorators[i].String(), object.TypeName(wrapped))
+		}
+		fn = wrapped
+	}
+	return fn
+}
+
+// memoBuiltin implements @memo, which caches a function's results
+var memoBuiltin = &object.Builtin{
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `memo`. got=%d, want=1", len(args))
+		}
+		if !isCallable(args[0]) {
+			return newError("argument to `memo` must be FUNCTION, got %s", args[0].Type())
+		}
+		return &object.Memoized{Fn: args[0], Cache: object.NewHash()}
+	},
+}
+
+// callMemoized returns the cached result for args, calling the wrapped
+// function on a miss. Errors are not cached.
+func callMemoized(m *object.Memoized, args []object.Object) object.Object {
+	argList := &object.Array{Elements: args}
+	key, ok := object.HashKeyOf(argList)
+	if !ok {
+		for i, arg := range args {
+			if _, ok := object.HashKeyOf(arg); !ok {
+				return newError("cannot memoize a call with argument %d of type %s: arguments must be usable as hash keys", i+1, object.TypeName(arg))
+			}
+		}
+		return newError("cannot memoize a call with these arguments: arguments must be usable as hash keys")
+	}
+
+	if cached, ok := m.Cache.Get(argList, key); ok {
+		return cached.Value
+	}
+	result := applyFunction(m.Fn, args)
+	if !isError(result) {
+		// A copy, so the cache neither freezes the caller's arrays nor
+		// changes when they do
+		m.Cache.Set(object.CopyKey(argList), key, result)
+	}
+	return result
+}
+
+// memoMethod returns the method name bound to m, for calls like fib.cacheSize()
+func memoMethod(m *object.Memoized, name string) object.Object {
+	switch name {
+	case "cacheClear":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments to `cacheClear`. got=%d, want=0", len(args))
+			}
+			m.Cache = object.NewHash()
+			return NULL
+		}}
+
+	case "cacheSize":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments to `cacheSize`. got=%d, want=0", len(args))
+			}
+			return &object.Integer{Value: int64(m.Cache.Len())}
+		}}
+	}
+
+	return newError("memoized function has no method %s", name)
+}
@@ -24,9 +24,11 @@ func SetEvalContext(source string, filename string) {
 	}
 }
 
-// ClearEvalContext clears the evaluation context
+// ClearEvalContext clears the evaluation context at the end of a run and
+// closes the generators the run left suspended
 func ClearEvalContext() {
 	currentContext = nil
+	closeSuspendedGenerators()
 }
 
 func newError(format string, a ...interface{}) *object.Error {
@@ -63,6 +65,28 @@ func FormatRichError(err *object.Error) string {
 		Filename:  currentContext.Filename,
 	}
 
+	// Overflow in strict integer mode is reported with the dedicated warning
+	if strings.HasPrefix(err.Message, "integer overflow in ") {
+		operation := strings.TrimPrefix(err.Message, "integer overflow in ")
+		return errors.IntegerOverflowWarning(operation, loc, currentContext.SourceCode).
+			WithNote("strict integer mode is on; without it the result is promoted to a big integer").
+			Format()
+	}
+
+	// Index errors carry the index and length the dedicated constructors need
+	var index, length int64
+	if n, _ := fmt.Sscanf(err.Message, "index out of bounds: index is %d but length is %d", &index, &length); n == 2 {
+		return errors.IndexOutOfBoundsError(index, length, loc, currentContext.SourceCode).Format()
+	}
+	if n, _ := fmt.Sscanf(err.Message, "negative index %d is out of range for length %d", &index, &length); n == 2 {
+		return errors.NegativeIndexError(index, length, loc, currentContext.SourceCode).Format()
+	}
+
+	if strings.HasPrefix(err.Message, "assertion failed: ") {
+		message := strings.TrimPrefix(err.Message, "assertion failed: ")
+		return errors.AssertionError(message, err.Details, loc, currentContext.SourceCode).Format()
+	}
+
 	richErr := errors.NewRuntimeError(err.Message, loc, currentContext.SourceCode)
 
 	// Add context-specific help and notes based on error message
@@ -168,7 +192,6 @@ func FormatRichError(err *object.Error) string {
 			"append":    "use 'push' instead - Victoria uses push(array, element)",
 			"add":       "use 'push' instead - Victoria uses push(array, element)",
 			"remove":    "use 'pop' instead - Victoria uses pop(array) to remove last element",
-			"delete":    "use filter() to create a new array without elements",
 			"substr":    "use string slicing instead: str[start:end]",
 			"substring": "use string slicing instead: str[start:end]",
 			"forEach":   "use a for-in loop: for item in array { ... }",
@@ -217,6 +240,21 @@ func FormatRichError(err *object.Error) string {
 			_ = richErr.WithHelp("only arrays, strings, and hashes support [] indexing")
 		}
 
+	} else if strings.HasPrefix(msg, "index out of bounds: ") || strings.HasPrefix(msg, "negative index ") {
+		// Only a big integer index gets here; smaller ones are parsed above
+		if strings.HasPrefix(msg, "negative index ") {
+			_ = richErr.WithCode("E0046")
+		} else {
+			_ = richErr.WithCode("E0006")
+		}
+		_ = richErr.WithNote("the index is a big integer, beyond the length of any array or string")
+		_ = richErr.WithHelp("check the arithmetic that produced the index")
+
+	} else if strings.HasPrefix(msg, "cannot pipe into") {
+		_ = richErr.WithCode("E0005")
+		_ = richErr.WithNote("the value on the left of |> is passed as the first argument of the call on the right")
+		_ = richErr.WithHelp("write the next stage as a call, like xs |> map(f), or as a function, like xs |> (x) => x * 2")
+
 	} else if strings.Contains(msg, "not a function") {
 		_ = richErr.WithCode("E0005")
 
@@ -292,16 +330,61 @@ func FormatRichError(err *object.Error) string {
 			_ = richErr.WithNote("spread operator must be used inside array literals")
 		}
 
-	} else if strings.Contains(msg, "unusable as hash key") {
+	} else if strings.Contains(msg, "unusable as hash key") || strings.Contains(msg, "unusable as set element") {
 		_ = richErr.WithCode("E0013")
-		_ = richErr.WithNote("hash keys must be hashable types: strings, integers, or booleans")
-		_ = richErr.WithHelp("use a string, integer, or boolean as the hash key")
+		_ = richErr.WithNote("hash keys must be strings, numbers, booleans, chars, enum values, or arrays and structs made of those")
+		_ = richErr.WithHelp("hashes and functions cannot be keys; use a field of the value instead")
+
+	} else if strings.HasPrefix(msg, "cannot memoize") {
+		_ = richErr.WithCode("E0013")
+		_ = richErr.WithNote("@memo caches results by their arguments, so every argument must be usable as a hash key")
+		_ = richErr.WithHelp("pass the parts of the value the result depends on, or drop @memo and keep your own cache")
+
+	} else if strings.Contains(msg, "it is used as a hash key") {
+		_ = richErr.WithCode("E0055")
+		_ = richErr.WithNote("an array stays frozen while a hash or set holds it as a key, since changing it would change the key's hash")
+		_ = richErr.WithHelp("modify a copy instead (let copy = [...arr]), or delete the key first")
 
 	} else if strings.Contains(msg, "reduce of empty array with no initial value") {
 		_ = richErr.WithCode("E0021")
 		_ = richErr.WithNote("reduce() needs an initial value when the array is empty")
 		_ = richErr.WithHelp("provide an initial value: reduce([], fn, 0)")
 
+	} else if strings.Contains(msg, "shift amount") || strings.Contains(msg, "cannot shift negative value") || strings.Contains(msg, "must be a non-negative integer") {
+		_ = richErr.WithCode("E0052")
+		_ = richErr.WithNote("bit operations work on the binary representation of non-negative integers")
+		if strings.Contains(msg, "negative shift amount") {
+			_ = richErr.WithHelp("shift amounts must be >= 0; use >> instead of a negative <<")
+		} else if strings.Contains(msg, "shift amount too large") {
+			_ = richErr.WithHelp("check the shift amount; for bitmasks over n items use 1 << n with small n")
+		} else {
+			_ = richErr.WithHelp("check the sign first, or take math.abs(x) after include \"math\"; masks are usually built from non-negative values")
+		}
+
+	} else if strings.Contains(msg, "negative exponent in integer power") || strings.Contains(msg, "integer power too large") {
+		_ = richErr.WithCode("E0053")
+		if strings.Contains(msg, "negative exponent") {
+			_ = richErr.WithNote("`**` on integers always produces an integer, and a negative exponent would need a fraction")
+			_ = richErr.WithHelp("use a float base for fractional results: 2.0 ** -1 == 0.5")
+		} else {
+			_ = richErr.WithNote(fmt.Sprintf("integer powers are limited to %d bits", maxPowerBits))
+			_ = richErr.WithHelp("for modular exponentiation, square and reduce by the modulus at each step")
+		}
+
+	} else if strings.Contains(msg, "format spec") || strings.Contains(msg, "invalid format string") || strings.HasPrefix(msg, "format: ") {
+		_ = richErr.WithCode("E0054")
+		if strings.Contains(msg, "is not valid for a value of type") {
+			_ = richErr.WithNote("d, b, o, x and c need an integer; f, e, g and % need a number; s works for any value")
+		} else {
+			_ = richErr.WithNote("format specs follow [[fill]align][sign][#][0][width][,][.precision][type]")
+		}
+		_ = richErr.WithHelp("examples: ${price:.2f}, ${name:>10}, ${n:08b}, format(\"{:,}\", total)")
+
+	} else if strings.Contains(msg, "as integer in base") || strings.Contains(msg, "invalid base") {
+		_ = richErr.WithCode("E0017")
+		_ = richErr.WithNote("digits must be valid for the base, e.g. 0-9 and a-f for base 16")
+		_ = richErr.WithHelp("bases range from 2 to 36: int(\"ff\", 16), int(\"1010\", 2), toBase(255, 16)")
+
 	} else if strings.Contains(msg, "division by zero") {
 		_ = richErr.WithCode("E0023")
 		_ = richErr.WithNote("cannot divide by zero")
@@ -1,7 +1,12 @@
 package evaluator
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 	"victoria/lexer"
 	"victoria/object"
 	"victoria/parser"
@@ -425,8 +430,11 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{"let myArray = [1, 2, 3]; myArray[2];", 3},
 		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
 		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
-		{"[1, 2, 3][3]", nil},
-		{"[1, 2, 3][-1]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", "index out of bounds: index is 3 but length is 3"},
+		{"[1, 2, 3][-4]", "negative index -4 is out of range for length 3"},
+		{"[][0]", "index out of bounds: index is 0 but length is 0"},
 	}
 
 	for _, tt := range tests {
@@ -434,8 +442,8 @@ func TestArrayIndexExpressions(t *testing.T) {
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+		} else if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong result for %q. expected error %q, got=%v", tt.input, tt.expected, evaluated)
 		}
 	}
 }
@@ -457,21 +465,22 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := map[object.Object]int64{
+		&object.String{Value: "one"}:   1,
+		&object.String{Value: "two"}:   2,
+		&object.String{Value: "three"}: 3,
+		&object.Integer{Value: 4}:      4,
+		TRUE:                           5,
+		FALSE:                          6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		hashKey, _ := object.HashKeyOf(expectedKey)
+		pair, ok := result.Get(expectedKey, hashKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -857,3 +866,1386 @@ func TestHigherOrderFunctions(t *testing.T) {
 		}
 	}
 }
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"#make SQ(x) ((x)*(x))\nSQ(3 + 1)", 16},
+		{"#make SQ(x) ((x)*(x))\n#make ADD(a, b) (a + b)\nADD(SQ(2), SQ(3))", 13},
+		{"#make MOD 1000000007\n#make NORM(x) ((x) % MOD)\nNORM(MOD + 5)", 5},
+		{"#make DEBUG 1\nlet x = 0;\n#if DEBUG\nx = 1;\n#else\nx = 2;\n#endif\nx", 1},
+		{"#make DEBUG 0\nlet x = 0;\n#if DEBUG\nx = 1;\n#else\nx = 2;\n#endif\nx", 2},
+		{"let x = 0;\n#if defined(DEBUG)\nx = 1;\n#endif\nx", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegerPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"let f = 1; for i in 1..26 { f *= i }; f", "15511210043330985984000000"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"100000000000000000000 / 7", "14285714285714285714"},
+		{"100000000000000000000 % 7", "2"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"string(99999999999999999999)", "99999999999999999999"},
+		{"let x: int = 99999999999999999999; x", "99999999999999999999"},
+		{"let h = {}; h[99999999999999999999] = 1; h[99999999999999999998 + 1]", "1"},
+		{"99999999999999999999 > 9223372036854775807", "true"},
+		{"99999999999999999999 == 99999999999999999999", "true"},
+		{`include "json"; json.stringify([99999999999999999999])`, "[99999999999999999999]"},
+		{`include "json"; json.parse("99999999999999999999") + 1`, "100000000000000000000"},
+		{"[1, 2, 3]?.[2 ** 70]", "null"},
+		{"[1, 2, 3][1:2 ** 70]", "[2, 3]"},
+		{"[1, 2, 3][-(2 ** 70):2]", "[1, 2]"},
+		{"[1, 2, 3][::-(2 ** 70)]", "[3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	// Results that fit in int64 are demoted back to Integer
+	testIntegerObject(t, testEval("(9223372036854775807 + 10) - 20"), 9223372036854775797)
+
+	// A big integer index is out of range for every sequence
+	errTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"[1, 2, 3][2 ** 70]", "index out of bounds: index is 1180591620717411303424 but length is 3"},
+		{"[1, 2, 3][-(2 ** 70)]", "negative index -1180591620717411303424 is out of range for length 3"},
+		{`"abc"[2 ** 70]`, "index out of bounds: index is 1180591620717411303424 but length is 3"},
+		{"(0..5)[2 ** 70]", "index out of bounds: index is 1180591620717411303424 but length is 5"},
+		{"let a = [1, 2, 3]; a[2 ** 70] = 0", "index out of bounds: index is 1180591620717411303424 but length is 3"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestStrictIntegerOverflow(t *testing.T) {
+	SetStrictIntegers(true)
+	defer SetStrictIntegers(false)
+
+	evaluated := testEval("9223372036854775807 * 2")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := "integer overflow in multiplication (9223372036854775807 * 2)"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+
+	evaluated = testEval(`let r = "ok"; try { 9223372036854775807 + 1 } catch (e) { r = e }; r`)
+	if evaluated.Inspect() != "integer overflow in addition (9223372036854775807 + 1)" {
+		t.Errorf("overflow should be catchable. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"12 & -12", 4},
+		{"2 | 1 ^ 3 & 1", 2},
+		{"1 + 2 << 1", 6},
+		{"let m = 0; m |= 1 << 3; m ^= 1; m <<= 2; m >>= 1; m &= 255; m", 18},
+		{"let a = [5]; a[0] &= 4; a[0]", 4},
+		{"(1 << 70) >> 69", 2},
+		{"popcount(255)", 8},
+		{"popcount(1 << 100)", 1},
+		{"clz(1)", 63},
+		{"ctz(8)", 3},
+		{"ctz(0)", 64},
+		{"let c = 0; for mask in 0..(1 << 4) { if (popcount(mask) == 2) { c += 1 } }; c", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	testBooleanObject(t, testEval("bit(5, 0)"), true)
+	testBooleanObject(t, testEval("bit(5, 1)"), false)
+
+	if result := testEval("1 << 64"); result.Inspect() != "18446744073709551616" {
+		t.Errorf("left shift should promote to a big integer. got=%s", result.Inspect())
+	}
+}
+
+func TestBitwiseErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 << -1", "negative shift amount: -1"},
+		{"1 << 100000", "shift amount too large: 100000 (maximum is 65536)"},
+		{"-8 >> 1", "cannot shift negative value: -8"},
+		{"popcount(-1)", "argument to `popcount` must be a non-negative integer, got -1"},
+		{"bit(5, -1)", "argument to `bit` must be a non-negative integer, got -1"},
+		{"1.5 & 2.5", "unknown operator: FLOAT & FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0b1010", 10},
+		{"0o755", 493},
+		{"1_000_000_007", 1000000007},
+		{"0xff & 0b1111", 15},
+		{`int("ff", 16)`, 255},
+		{`int("0xff", 16)`, 255},
+		{`int("-1010", 2)`, -10},
+		{`int("zz", 36)`, 1295},
+		{`int("1_000")`, 1000},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"1e9", 1e9},
+		{"2.5e-3", 0.0025},
+		{"1_000.5", 1000.5},
+	}
+
+	for _, tt := range floats {
+		evaluated := testEval(tt.input)
+		f, ok := evaluated.(*object.Float)
+		if !ok || f.Value != tt.expected {
+			t.Errorf("%s: expected float %g. got=%T(%+v)", tt.input, tt.expected, evaluated, evaluated)
+		}
+	}
+
+	strs := []struct {
+		input    string
+		expected string
+	}{
+		{"toBase(255, 16)", "ff"},
+		{"toBase(10, 2)", "1010"},
+		{"toBase(-493, 8)", "-755"},
+		{"toBase(1 << 64, 16)", "10000000000000000"},
+	}
+
+	for _, tt := range strs {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%s: expected %q. got=%T(%+v)", tt.input, tt.expected, evaluated, evaluated)
+		}
+	}
+
+	errs := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`int("fg", 16)`, `could not parse "fg" as integer in base 16`},
+		{`int("1", 1)`, "invalid base 1 for `int`: base must be between 2 and 36"},
+		{"toBase(10, 37)", "invalid base 37 for `toBase`: base must be between 2 and 36"},
+	}
+
+	for _, tt := range errs {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestPowerAndFloorDivision(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"(-2) ** 63", minInt64},
+		{"5 ** 0", 1},
+		{"(-1) ** (1 << 80)", 1},
+		{"let x = 3; x **= 4; x", 81},
+		{"(2 ** 100) div (2 ** 98)", 4},
+		{"7 div 2", 3},
+		{"-7 div 2", -4},
+		{"7 div -2", -4},
+		{"-7 div -2", 3},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 % -3", -1},
+		{"(-7 / 3) * 3 + -7 % 3", -7},
+		{"-(1 << 70) % 7", -2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.0 ** -1", 0.5},
+		{"9 ** 0.5", 3},
+		{"-7.5 div 2", -4},
+		{"-7.5 % 2", -1.5},
+	}
+
+	for _, tt := range floats {
+		evaluated := testEval(tt.input)
+		f, ok := evaluated.(*object.Float)
+		if !ok || f.Value != tt.expected {
+			t.Errorf("%s: expected float %g. got=%T(%+v)", tt.input, tt.expected, evaluated, evaluated)
+		}
+	}
+
+	if result := testEval("2 ** 64"); result.Inspect() != "18446744073709551616" {
+		t.Errorf("power should promote to a big integer. got=%s", result.Inspect())
+	}
+
+	errs := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"2 ** -1", "negative exponent in integer power: 2 ** -1"},
+		{"10 ** (10 ** 10)", "integer power too large: 10 ** 10000000000"},
+		{"1 div 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+	}
+
+	for _, tt := range errs {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	SetStrictIntegers(true)
+	defer SetStrictIntegers(false)
+	evaluated := testEval("3 ** 40")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "integer overflow in exponentiation (3 ** 40)" {
+		t.Errorf("expected strict overflow error. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	ints := []struct {
+		input    string
+		expected int64
+	}{
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`len(bytes("héllo"))`, 6},
+		{`len(runes("héllo"))`, 5},
+		{`index("héllo wörld", "w")`, 6},
+		{`index("héllo", "z")`, -1},
+		{`let n = 0; for c in "añb" { n += 1 }; n`, 3},
+		{`let last = 0; for i, c in "añb" { last = i }; last`, 2},
+	}
+
+	for _, tt := range ints {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	strs := []struct {
+		input    string
+		expected string
+	}{
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-1]`, "o"},
+		{`"héllo"[1:3]`, "él"},
+		{`"wörld"[-4:]`, "örld"},
+		{`join(split("añb", ""), "-")`, "a-ñ-b"},
+		{`join(split("a→b→c", "→"), ",")`, "a,b,c"},
+		{`let out = ""; for c in "日本" { out = c + out }; out`, "本日"},
+		{`"café"`, `café`},
+	}
+
+	for _, tt := range strs {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%s: expected %q. got=%T(%+v)", tt.input, tt.expected, evaluated, evaluated)
+		}
+	}
+
+	testBooleanObject(t, testEval(`contains("wörld", "ö")`), true)
+	testBooleanObject(t, testEval(`contains("world", 'w')`), true)
+
+	if result := testEval(`bytes("é")`); result.Inspect() != "[0xC3, 0xA9]" {
+		t.Errorf("bytes() wrong. got=%s", result.Inspect())
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let größe = 180; größe", 180},
+		{"let 名前 = 5; let x2 = 名前 * 2; x2", 10},
+		{"define flächeninhalt(a, b) { return a * b }; flächeninhalt(3, 4)", 12},
+		{"let c = 'ö'; ord(c)", 246},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFormatSpecs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let price = 3.14159; "${price:.2f}"`, "3.14"},
+		{`let name = "Ada"; "[${name:>10}]"`, "[       Ada]"},
+		{`let name = "Ada"; "[${name:<5}]"`, "[Ada  ]"},
+		{`let name = "Ada"; "[${name:*^7}]"`, "[**Ada**]"},
+		{`let n = 5; "${n:08b}"`, "00000101"},
+		{`"${255:#x} ${255:X} ${8:o}"`, "0xff FF 10"},
+		{`"${-42:06}"`, "-00042"},
+		{`"${7:+d}"`, "+7"},
+		{`"${1234567:,}"`, "1,234,567"},
+		{`"${65535:_x}"`, "ffff"},
+		{`"${1048575:_b}"`, "1111_1111_1111_1111_1111"},
+		{`"${0.256:.1%}"`, "25.6%"},
+		{`"${1234.5:,.2f}"`, "1,234.50"},
+		{`"${1e6:e}"`, "1.000000e+06"},
+		{`"${2:.3f}"`, "2.000"},
+		{`"${65:c}"`, "A"},
+		{`let s = "hello"; "${s:.3}"`, "hel"},
+		{`let x = 3; "${x > 2 ? 1.5 : 2:.1f}"`, "1.5"},
+		{`let a = [1, 2, 3]; "${a[0:2]}"`, "[1, 2]"},
+		{`let h = {"n": null}; "${h.n ?? 2.5:.1f}"`, "2.5"},
+		{`let h = {"n": 1}; "${h?.n > 0 ? 1 : 2:03}"`, "001"},
+		{`"${2 ** 70:,}"`, "1,180,591,620,717,411,303,424"},
+		{`format("{:.2f} and {:>5}!", 3.14159, "Ada")`, "3.14 and   Ada!"},
+		{`format("{1} {0} {1}", "a", "b")`, "b a b"},
+		{`format("{{}} {}", 1)`, "{} 1"},
+		{`format("%.2f|%5d|%-5s|%s|%x|%05.1f", 3.14159, 5, "Ada", [1, 2], 255, 2.5)`, "3.14|    5|Ada  |[1, 2]|ff|002.5"},
+		{`format("100%% of %s", "tests")`, "100% of tests"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%s: expected string. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%s: expected %q. got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestFormatSpecErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`let p = 1.5; "${p:d}"`, `format spec "d" is not valid for a value of type float`},
+		{`let s = "a"; "${s:+}"`, `invalid format spec "+": sign, '#', grouping and '=' alignment are only allowed for numbers`},
+		{`"${1:.2}"`, `invalid format spec ".2": precision is not allowed for integers`},
+		{`"${1:q}"`, `invalid format spec "q": unknown format type 'q'`},
+		{`"${1.5:.}"`, `invalid format spec ".": missing precision after '.'`},
+		{`format("%d", 1.5)`, `format spec "%d" is not valid for a value of type float`},
+		{`format("{} {}", 1)`, "format: field {} has no matching argument (got 1 arguments)"},
+		{`format("{} {0}", 1)`, "invalid format string: cannot mix automatic {} and numbered {0} fields"},
+		{`format("%d %d", 1)`, "format: %d has no matching argument (got 1 arguments)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"z": 1, "a": 2, "m": 3}`, "{z: 1, a: 2, m: 3}"},
+		{`let h = {"z": 1, "a": 2}; h["b"] = 3; h["z"] = 9; h`, "{z: 9, a: 2, b: 3}"},
+		{`keys({"z": 1, "a": 2, "m": 3})`, "[z, a, m]"},
+		{`values({"z": 1, "a": 2, "m": 3})`, "[1, 2, 3]"},
+		{`let out = []; for k, v in {"z": 1, "a": 2, "m": 3} { out = push(out, k) }; out`, "[z, a, m]"},
+		{`let h = {"a": 1, "b": 2, "c": 3}; delete(h, "a"); h["a"] = 4; h`, "{b: 2, c: 3, a: 4}"},
+		{`let h = {"a": 1}; [delete(h, "a"), delete(h, "a"), len(h)]`, "[true, false, 0]"},
+		{`let h = {}; for i in 0..100 { h[i] = i }; for i in 0..99 { delete(h, i) }; h["x"] = 1; h`, "{99: 99, x: 1}"},
+		{`include "json"; json.stringify({"z": 1, "a": [1, {"y": 2, "b": 3}]})`, `{"z":1,"a":[1,{"y":2,"b":3}]}`},
+		{`include "json"; json.stringify(json.parse("{\"z\": 1, \"a\": {\"y\": 2, \"b\": 3}}"))`, `{"z":1,"a":{"y":2,"b":3}}`},
+		{`include "json"; json.stringify({"z": 1, "a": 2}, 2)`, "{\n  \"z\": 1,\n  \"a\": 2\n}"},
+		{`include "json"; keys(json)`, "[parse, stringify, valid]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let memo = {}; memo[[1, 2]] = "a"; memo[[1, 2]]`, "a"},
+		{`let memo = {}; memo[[1, 2]] = "a"; memo[[2, 1]]`, "null"},
+		{`let k = [1, 2]; let memo = {k: 1}; memo[[1, 2]] += 1; memo`, "{[1, 2]: 2}"},
+		{`let memo = {[1, [2, "x"]]: true}; memo[[1, [2, "x"]]]`, "true"},
+		{`let memo = {[]: 0}; memo[[]]`, "0"},
+		{`let h = {}; h[[1]] = 1; h[["1"]] = 2; len(h)`, "2"},
+		{`struct P { x, y }; let h = {}; h[P { x: 1, y: 2 }] = "p"; h[P { y: 2, x: 1 }]`, "p"},
+		{`struct P { x, y }; struct Q { x, y }; let h = {}; h[P { x: 1, y: 2 }] = "p"; h[Q { x: 1, y: 2 }]`, "null"},
+		{`struct P { x, y }; {P { y: 2, x: 1 }: 1}`, "{P { x: 1, y: 2 }: 1}"},
+		{`let h = {1.5: "a"}; h[1.5]`, "a"},
+		{`let h = {1: "int"}; h[1.0]`, "int"},
+		{`let h = {0.0: "zero"}; h[-0.0]`, "zero"},
+		{`let h = {}; h[[1, 2.0]] = 1; h[[1.0, 2]]`, "1"},
+		{`let h = {[1, 2]: "a"}; delete(h, [1, 2]); len(h)`, "0"},
+		{`let k = [1, 2]; let h = {k: 1}; let c = [...k]; c[0] = 9; c`, "[9, 2]"},
+		{`let a = [1]; let h = {}; h[a] = 1; delete(h, a); a[0] = 5; a`, "[5]"},
+		{`let a = [1]; let s = #{a}; s.remove(a); a[0] = 2; a`, "[2]"},
+		{`let a = [1]; let h = {a: 1}; let g = {a: 2}; delete(h, a); delete(g, [1]); a[0] = 3; a`, "[3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let k = [1, 2]; let h = {}; h[k] = 1; k[0] = 5`, "cannot modify array [1, 2]: it is used as a hash key"},
+		{`let inner = [1]; let h = {[inner, 2]: 1}; inner[0] += 1`, "cannot modify array [1]: it is used as a hash key"},
+		{`let a = [1]; let s = #{}; s.add(a); a[0] = 2`, "cannot modify array [1]: it is used as a hash key"},
+		{`let a = [1]; let h = {a: 1}; let g = {a: 2}; delete(h, a); a[0] = 3`, "cannot modify array [1]: it is used as a hash key"},
+		{`let k = [1, 2]; let h = {k: 1}; k[0:1] = [9]`, "cannot modify array [1, 2]: it is used as a hash key"},
+		{`let h = {[1, 2]: 1}; for k in h { k[0] = 5 }`, "cannot modify array [1, 2]: it is used as a hash key"},
+		{`let h = {[[1], 2]: 1}; keys(h)[0][0][0] += 1`, "cannot modify array [1]: it is used as a hash key"},
+		{`let h = {}; h[[1, {"a": 1}]] = 1`, "unusable as hash key: ARRAY"},
+		{`let f = x => x; {[f]: 1}`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+		if strings.HasPrefix(tt.expected, "cannot modify") && errObj.Line == 0 {
+			t.Errorf("the error for %q should point at the assignment", tt.input)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{1, 2, 3, 2, 1}`, "#{1, 2, 3}"},
+		{`#{}`, "#{}"},
+		{`set()`, "#{}"},
+		{`set([3, 1, 3])`, "#{3, 1}"},
+		{`set("hello")`, "#{h, e, l, o}"},
+		{`set(0..4)`, "#{0, 1, 2, 3}"},
+		{`let a = [2, 3]; #{1, ...a}`, "#{1, 2, 3}"},
+		{`len(#{1, 2, 2})`, "2"},
+		{`let s = #{1}; [s.add(2), s.add(1), s]`, "[true, false, #{1, 2}]"},
+		{`let s = #{1, 2}; [s.remove(1), s.remove(1), s]`, "[true, false, #{2}]"},
+		{`let s = #{[1, 2], "x"}; [s.has([1, 2]), s.has("y")]`, "[true, false]"},
+		{`#{1, 2}.union(#{2, 3})`, "#{1, 2, 3}"},
+		{`#{1, 2, 3}.intersection(#{3, 2, 5})`, "#{2, 3}"},
+		{`#{1, 2, 3}.difference(#{2})`, "#{1, 3}"},
+		{`[#{1, 2}.isSubset(#{1, 2, 3}), #{1, 4}.isSubset(#{1, 2, 3}), #{}.isSubset(#{})]`, "[true, false, true]"},
+		{`let sum = 0; for x in #{1, 2, 3} { sum += x }; sum`, "6"},
+		{`let r = []; for i, x in #{"a", "b", "a"} { r = push(r, [i, x]) }; r`, "[[0, a], [1, b]]"},
+		{`let n = 0; for i, x in #{3, 4, 5} { if (i == 1) { break }; n += x }; n`, "3"},
+		{`let s = #{1, 2}; let t = set(s); t.add(3); [s, t]`, "[#{1, 2}, #{1, 2, 3}]"},
+		{`include "json"; json.stringify({"tags": #{"a", "b"}})`, `{"tags":["a","b"]}`},
+		{`let s: set[int] = #{1, 2}; s`, "#{1, 2}"},
+		{`let s: set = #{"a"}; s`, "#{a}"},
+		{`type(#{})`, "SET"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{1, {"a": 1}}`, "unusable as set element: HASH"},
+		{`#{1}.add({})`, "unusable as set element: HASH"},
+		{`#{1}.union([1])`, "argument to `union` must be SET, got ARRAY"},
+		{`#{1}.push(2)`, "set has no method push"},
+		{`set(1)`, "argument to `set` must be ARRAY, SET, STRING or RANGE, got INTEGER"},
+		{`let s: set[int] = #{1, "x"}`, "type mismatch: cannot assign set to variable of type set[int]"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, 2, [3, "x"]] == [1, 2, [3, "x"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`[1, 2.0] == [1.0, 2]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`#{1, 2, 3} == #{3, 2, 1}`, true},
+		{`#{1, 2} == #{1, 3}`, false},
+		{`'a' == 'a'`, true},
+		{`'a' != 'b'`, true},
+		{`null == null`, true},
+		{`[null] == [false]`, false},
+		{`struct P { x, y }; P { x: 1, y: [2] } == P { y: [2], x: 1 }`, true},
+		{`struct P { x, y }; P { x: 1, y: 2 } == P { x: 1, y: 3 }`, false},
+		{`struct P { x }; struct Q { x }; P { x: 1 } == Q { x: 1 }`, false},
+		{`enum Color { RED, GREEN }; [Color.RED] == [Color.RED]`, true},
+		{`let a = [1]; a == a`, true},
+		{`let f = x => x; let g = x => x; [f == f, f == g] == [true, false]`, true},
+		{`switch ([1, 2]) { case [1, 2]: { true } default: { false } }`, true},
+		{`"apple" < "banana"`, true},
+		{`"b" > "abc"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"ab" < "abc"`, true},
+		{`"Z" < "a"`, true},
+		{`'a' < 'b'`, true},
+		{`'z' >= 'a'`, true},
+		{`[1, 2, 3] < [1, 2, 4]`, true},
+		{`[1, 2] < [1, 2, 0]`, true},
+		{`[2] > [1, 9, 9]`, true},
+		{`[[1, "b"], [1, "a"]][0] > [1, "a"]`, true},
+		{`[] <= []`, true},
+		{`[1, 2.5] < [1, 3]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStructOrdering(t *testing.T) {
+	input := `
+struct Version { major, minor }
+define Version.compare(other) {
+    if (self.major != other.major) { return self.major - other.major }
+    return self.minor - other.minor
+}
+let a = Version { major: 1, minor: 2 }
+let b = Version { major: 1, minor: 10 }
+let c = Version { major: 2, minor: 0 }
+let results = [a < b, b < c, c > a, a <= a, a >= b, [a, c] < [b, a]]
+results
+`
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[true, true, true, true, false, true]" {
+		t.Errorf("wrong struct ordering. got=%s", evaluated.Inspect())
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct P { x }; P { x: 1 } < P { x: 2 }`, "no ordering defined for P: define P.compare(other) returning an int"},
+		{`struct P { x }; define P.compare(o) { "bigger" }; P { x: 1 } < P { x: 2 }`, "P.compare must return an int, got string"},
+		{`[1, "a"] < [1, 2]`, "cannot compare string with int"},
+		{`{"a": 1} < {"a": 2}`, "no ordering defined for map"},
+		{`true < false`, "no ordering defined for bool"},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	prelude := `
+struct Frac { n, d }
+define Frac.__add(o) { return Frac { n: self.n * o.d + o.n * self.d, d: self.d * o.d } }
+define Frac.__sub(o) { return Frac { n: self.n * o.d - o.n * self.d, d: self.d * o.d } }
+define Frac.__mul(o) { return Frac { n: self.n * o.n, d: self.d * o.d } }
+define Frac.__eq(o) { return self.n * o.d == o.n * self.d }
+define Frac.__lt(o) { return self.n * o.d < o.n * self.d }
+define Frac.__str() { return "${self.n}/${self.d}" }
+struct Bag { items }
+define Bag.__len() { return len(self.items) }
+define Bag.__index(i) { return self.items[len(self.items) - 1 - i] }
+define Bag.__iter() { return self.items }
+let half = Frac { n: 1, d: 2 }
+let third = Frac { n: 1, d: 3 }
+let bag = Bag { items: ["a", "b", "c"] }
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"half + third", "5/6"},
+		{"half - third", "1/6"},
+		{"half * third", "1/6"},
+		{"half == Frac { n: 2, d: 4 }", "true"},
+		{"half != Frac { n: 2, d: 4 }", "false"},
+		{"let r = [half] == [Frac { n: 3, d: 6 }]; r", "true"},
+		{"let r = [third < half, half < third, half > third, third >= half, half <= half]; r", "[true, false, true, false, true]"},
+		{"struct V { x }; define V.__lt(o) { if (self.x < o.x) { return self.x }; return null }; let r = [V { x: 2 } > V { x: 1 }, V { x: 1 } > V { x: 2 }]; r", "[true, false]"},
+		{"let r = [half, third]; r", "[1/2, 1/3]"},
+		{`let h = {"x": half}; h`, "{x: 1/2}"},
+		{"string(third)", "1/3"},
+		{`"${half}"`, "1/2"},
+		{"len(bag)", "3"},
+		{"bag[0]", "c"},
+		{`let s = ""; for x in bag { s = s + x }; s`, "abc"},
+		{`let s = ""; for i, x in bag { s = s + string(i) + x }; s`, "0a1b2c"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(prelude + tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"half / third", "unknown operator: STRUCT_INSTANCE / STRUCT_INSTANCE"},
+		{"len(half)", "argument to `len` not supported, got Frac: define Frac.__len()"},
+		{"for x in half { x }", "not iterable: Frac: define Frac.__iter() or Frac.next()"},
+		{"half[0]", "index operator not supported: STRUCT_INSTANCE"},
+		{"struct L { }; define L.__len() { \"long\" }; len(L { })", "L.__len must return an int, got string"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(prelude + tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	prelude := `
+define naturals() {
+	let n = 0
+	while (true) {
+		yield n
+		n = n + 1
+	}
+}
+define take(it, n) {
+	let out = []
+	for x in it {
+		if (len(out) == n) { break }
+		out = push(out, x)
+	}
+	return out
+}
+define walk(node) {
+	if (node == null) { return null }
+	for x in walk(node["left"]) { yield x }
+	yield node["value"]
+	for x in walk(node["right"]) { yield x }
+}
+let tree = {"value": 2, "left": {"value": 1, "left": null, "right": null}, "right": {"value": 3, "left": null, "right": null}}
+struct Countdown { state }
+define Countdown.next() {
+	let v = self.state["n"]
+	if (v == 0) { return {"done": true} }
+	self.state["n"] = v - 1
+	return {"value": v, "done": false}
+}
+struct Evens { limit }
+define Evens.__iter() {
+	let limit = self.limit
+	return (define() {
+		let i = 0
+		while (i < limit) { yield i; i = i + 2 }
+	})()
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"take(naturals(), 5)", "[0, 1, 2, 3, 4]"},
+		{"let r = [...walk(tree)]; r", "[1, 2, 3]"},
+		{"let g = naturals(); g.next(); g.next()", "{value: 1, done: false}"},
+		{"define one() { yield 1 }; let g = one(); g.next(); g.next()", "{value: null, done: true}"},
+		{"let s = \"\"; for i, x in walk(tree) { s = s + string(i) + string(x) }; s", "011223"},
+		{`let r = [...Countdown { state: {"n": 3} }]; r`, "[3, 2, 1]"},
+		{`let c = Countdown { state: {"n": 4} }; let sum = 0; for x in c { sum = sum + x }; sum`, "10"},
+		{"let e = Evens { limit: 7 }; let r = []; for x in e { r = push(r, x) }; r", "[0, 2, 4, 6]"},
+		{"define f() { for x in naturals() { if (x == 3) { return x * 10 } } }; f()", "30"},
+		{"define g() { try { yield 1; yield 2 } catch (e) { yield 99 } }; take(g(), 1)", "[1]"},
+		{"naturals()", "<generator>"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(prelude + tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"define bad() { yield 1; yield missing }; take(bad(), 5)", "identifier not found: missing"},
+		{"define bad() { yield 1 / 0 }; let g = bad(); g.next()", "division by zero"},
+		{"struct S { }; define S.next() { return 1 }; let s = S { }; for x in s { x }", "S.next must return {\"value\": v, \"done\": bool}, got int"},
+		{"naturals().rewind()", "iterator has no method rewind"},
+		{"define bad() -> int { yield 1 }; bad()", "return type mismatch: expected int, got iterator"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(prelude + tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestAbandonedGeneratorsAreClosed(t *testing.T) {
+	prelude := "define naturals() { let n = 0; while (true) { yield n; n = n + 1 } }; "
+
+	// waitForGoroutines collects garbage until at most want goroutines are
+	// left, reporting whether that happened within a second
+	waitForGoroutines := func(want int) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			runtime.GC()
+			if runtime.NumGoroutine() <= want {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	// Unreachable generators are closed by the garbage collector
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		testEval(prelude + "naturals().next(); naturals().next()")
+	}
+	if !waitForGoroutines(before) {
+		t.Errorf("unreachable generators leaked goroutines. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+
+	// A generator still bound in the body's own scope stays reachable from
+	// its goroutine, so it is closed when the run ends
+	before = runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		testEval(prelude + "let g = naturals(); g.next(); g.next()")
+	}
+	ClearEvalContext()
+	if !waitForGoroutines(before) {
+		t.Errorf("suspended generators leaked goroutines after the run. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+}
+
+func TestReadLinesStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(path, []byte("alpha\nbeta\ngamma\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `include "os"
+let first = ""
+for i, line in os.readLines("` + path + `") {
+	if (i == 1) { break }
+	first = line
+}
+let all = [...os.readLines("` + path + `")]
+let r = [first, all]; r`
+	evaluated := testEval(input)
+	if evaluated == nil || evaluated.Inspect() != "[alpha, [alpha, beta, gamma]]" {
+		t.Errorf("wrong result. got=%v", evaluated)
+	}
+}
+
+func TestLazyRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let r = []; for i in 0..=3 { r = push(r, i) }; r", "[0, 1, 2, 3]"},
+		{"let r = []; for i in 10..0 step -3 { r = push(r, i) }; r", "[10, 7, 4, 1]"},
+		{"let r = []; for c in 'a'..='e' step 2 { r = push(r, c) }; r", "['a', 'c', 'e']"},
+		{"let r = []; for i, c in 'x'..='z' { r = push(r, [i, c]) }; r", "[[0, 'x'], [1, 'y'], [2, 'z']]"},
+		{"let r = [...(0..5).reversed()]; r", "[4, 3, 2, 1, 0]"},
+		{"(0..5).reversed()", "4..=0 step -1"},
+		{"len(0..1000000000000)", "1000000000000"},
+		{"len(0..=100 step 7)", "15"},
+		{"len(5..0)", "0"},
+		{"(0..1000000000000)[999999999999]", "999999999999"},
+		{"(0..10 step 2)[-1]", "8"},
+		{"(0..3)[-3]", "0"},
+		{"('a'..='z')[25]", "'z'"},
+		{"(0..1000000000000)[10:13]", "10..=12"},
+		{"let r = [...(0..10 step 3)[1:]]; r", "[3, 6, 9]"},
+		{"(0..10)[5:2]", "5..5"},
+		{"(0..1000000000000 step 5).contains(999999999995)", "true"},
+		{"(0..10 step 5).contains(10)", "false"},
+		{"(0..=10 step 5).contains(10)", "true"},
+		{"('a'..='z').contains('q')", "true"},
+		{"('a'..='z').contains(5)", "false"},
+		{"contains(10..0 step -2, 4)", "true"},
+		{"0..=4 == 0..5", "true"},
+		{"(0..5).reversed() == 4..=0 step -1", "true"},
+		{"set(1..=3)", "#{1, 2, 3}"},
+		{"define f() { for i in 0..1000000000000 { if (i == 2) { return i } } }; f()", "2"},
+		// range() builds an array, unlike a..b; union-find and JSON rely on it
+		{"let parent = range(4); parent[2] = 0; parent", "[0, 1, 0, 3]"},
+		{`include "json"; json.stringify(range(3))`, "[0,1,2]"},
+		{"type(range(3))", "ARRAY"},
+		{"range(10, 0, -3)", "[10, 7, 4, 1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"0..10 step 0", "range step cannot be zero"},
+		{"0..10 step 1.5", "range step must be an integer, got FLOAT"},
+		{"'a'..10", "range end must be a char to match the start, got INTEGER"},
+		{"\"a\"..\"z\"", "range start must be an integer or char, got STRING"},
+		{"(0..3).shuffle()", "range has no method shuffle"},
+		{"(0..3)[3]", "index out of bounds: index is 3 but length is 3"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let xs = [1, 2, 3, 4, 5, 6]; [x * x for x in xs if x % 2 == 0]", "[4, 16, 36]"},
+		{"let g = [[0 for j in 0..3] for i in 0..2]; g[0][1] = 5; g", "[[0, 5, 0], [0, 0, 0]]"},
+		{"let r = [[i, j] for i in 0..3 for j in 0..3 if i < j]; r", "[[0, 1], [0, 2], [1, 2]]"},
+		{`let words = ["a", "bb", "ccc"]; {k: len(k) for k in words}`, "{a: 1, bb: 2, ccc: 3}"},
+		{`let h = {"a": 1, "b": 2}; {v: k for k, v in h}`, "{1: a, 2: b}"},
+		{`let h = {"a": 1, "b": 2}; [k for k in h]`, "[a, b]"},
+		{`[c for i, c in "hey" if i != 1]`, "[h, y]"},
+		{"[x for x in #{3, 1} if x > 1]", "[3]"},
+		{"define upTo(n) { let i = 0; while (i < n) { yield i; i = i + 1 } }; [x * 10 for x in upTo(4) if x % 2 == 1]", "[10, 30]"},
+		{"[x for x in []]", "[]"},
+		{"let x = 10; let r = [x for x in 0..3]; x", "10"},
+		{"let n = 3; [i * n for i in 0..n]", "[0, 3, 6]"},
+		{"{i % 2: i for i in 0..5}", "{0: 4, 1: 3}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x for x in 5]", "not iterable: INTEGER"},
+		{"[y for x in [1]]", "identifier not found: y"},
+		{"{[1] + 1: x for x in [1]}", "type mismatch: ARRAY + INTEGER"},
+		{"{f: 1 for f in [x => x]}", "unusable as hash key: ARROW_FUNCTION"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestSteppedSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][1:10:2]", "[2, 4]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-2]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-100:100]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"héllo"[1:10:2]`, "él"},
+		{"(0..10)[::-3]", "9..=0 step -3"},
+		{"let a = [1, 2, 3, 4, 5]; a[1:3] = [9]; a", "[1, 9, 4, 5]"},
+		{"let a = [1, 2]; a[1:1] = [7, 8, 9]; a", "[1, 7, 8, 9, 2]"},
+		{"let a = [1, 2, 3, 4, 5]; a[::2] = [0, 0, 0]; a", "[0, 2, 0, 4, 0]"},
+		{"let a = [1, 2, 3]; a[:] = 5..=6; a", "[5, 6]"},
+		{"let a = [1, 2, 3]; a[-1] = 30; a", "[1, 2, 30]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][::0]", "slice step cannot be zero"},
+		{"[1, 2, 3][::1.5]", "slice step must be an integer, got FLOAT"},
+		{`[1, 2, 3]["a":]`, "slice index must be an integer, got STRING"},
+		{"[1, 2, 3][-4]", "negative index -4 is out of range for length 3"},
+		{"let a = [1, 2, 3]; a[5] = 1", "index out of bounds: index is 5 but length is 3"},
+		{"let a = [1, 2, 3, 4]; a[::2] = [0]", "cannot assign 1 elements to a stepped slice of 2 elements"},
+		{`let s = "abc"; s[0:1] = "z"`, "cannot assign to a slice of a string: strings are immutable"},
+		{"let a = [1, 2, 3]; a[0:1] = 5", "can only assign an array to a slice, got INTEGER"},
+		{"let a = [1, 2, 3]; a[0:1] += [5]", "operator += is not supported on a slice; use ="},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	// Assignment errors point at the brackets, as read errors do
+	located := []struct {
+		input  string
+		column int
+	}{
+		{"let a = [1, 2, 3]; a[5] = 1", 21},
+		{"let a = [1, 2, 3]; a[-4] += 1", 21},
+		{"let a = [1, 2, 3, 4]; a[::2] = [0, 0, 0]", 24},
+		{"let a = [1, 2, 3]; a[0:1] = 5", 21},
+	}
+
+	for _, tt := range located {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Line != 1 || errObj.Column != tt.column {
+			t.Errorf("wrong position for %q. expected=1:%d, got=%d:%d", tt.input, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let cfg = {"db": {"host": "local"}}; cfg?.db?.host`, "local"},
+		{`let cfg = {"db": {"host": "local"}}; cfg?.cache?.size`, "null"},
+		{`let cfg = null; cfg?.db`, "null"},
+		{`let xs = [1, 2, 3]; xs?.[-1]`, "3"},
+		{`let xs = [1, 2, 3]; xs?.[3]`, "null"},
+		{`let s = "hey"; s?.[5]`, "null"},
+		{`let xs = null; xs?.[0]`, "null"},
+		{`let xs = null; xs?.[1:]`, "null"},
+		{`let h = {"a": [1]}; h?.b?.[0]`, "null"},
+		{`let h = null; h?.size()`, "null"},
+		{`let calls = 0; define f() { calls = calls + 1; return 0 }; let h = null; h?.[f()]; calls`, "0"},
+		{`struct P { x }; let p = P { x: 1 }; [p?.x, p?.y]`, "[1, null]"},
+		{`null ?? "default"`, "default"},
+		{`0 ?? 1`, "0"},
+		{`false ?? true`, "false"},
+		{`"" ?? "x"`, ""},
+		{`null ?? null ?? 3`, "3"},
+		{`let calls = 0; define f() { calls = calls + 1; return 2 }; 1 ?? f(); calls`, "0"},
+		{`let h = {"port": null}; h?.port ?? 8080`, "8080"},
+		{`let a = null; a ?? 1 ? "yes" : "no"`, "yes"},
+		{`let x = 2; x > 1 ? x ?? 0 : -1`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {}; h.missing`, "property not found in hash: missing"},
+		{`let h = {"a": null}; h?.a.b`, "dot operator not supported for: NULL"},
+		{`undefinedName ?? 1`, "identifier not found: undefinedName"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5] |> map((x) => x * x) |> filter((x) => x % 2 == 1) |> reduce((a, b) => a + b, 0)", "35"},
+		{"[1, 2, 3] |> len()", "3"},
+		{"[1, 2, 3] |> len", "3"},
+		{"[1, 2, 3] |> len() > 2", "true"},
+		{"define add(a, b) { return a + b }; 1 + 1 |> add(10)", "12"},
+		{"define sub(a, b) { return a - b }; 10 |> sub(3)", "7"},
+		{"3 |> (n) => n * 2", "6"},
+		{"3 |> n => n + 1 |> (m) => m * 10", "40"},
+		{"let double = (x) => x * 2; 5 |> double |> double", "20"},
+		{`"a,b" |> split(",") |> len()`, "2"},
+		{"0..4 |> len()", "4"},
+		{"struct Acc { total }; let a = Acc { total: 2 }; define Acc.plus(x, y) { return self.total + x + y }; 1 |> a.plus(4)", "7"},
+		{"let calls = []; define log(x, tag) { calls = push(calls, tag); return x }; 1 |> log(\"a\") |> log(\"b\"); calls", "[a, b]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 |> 3", "cannot pipe into INTEGER: the right side of |> must be a call or a function"},
+		{"5 |> [1]()", "cannot pipe into ARRAY: the right side of |> must be a call or a function"},
+		{"[1] |> map(5)", "argument 2 to `map` must be FUNCTION, got INTEGER"},
+		{"1 |> nope()", "identifier not found: nope"},
+		{"define two(a, b) { return a }; two(1)", "wrong number of arguments: expected 2, got 1"},
+		{"define two(a: int, b: int) { return a }; 1 |> two(2, 3)", "wrong number of arguments: expected 2, got 3"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let grid = [[1, 2], [3, 4]]; let found = null; outer: for i, row in grid { for j, v in row { if (v == 3) { found = [i, j]; break outer } } }; found", "[1, 0]"},
+		{"let seen = []; outer: for i in 0..3 { for j in 0..3 { if (j == 1) { continue outer }; seen = push(seen, [i, j]) } }; seen", "[[0, 0], [1, 0], [2, 0]]"},
+		{"let seen = []; rows: for (let i = 0; i < 3; i++) { let j = 0; while (j < 3) { if (j == 1) { continue rows }; seen = push(seen, j); j++ } }; seen", "[0, 0, 0]"},
+		{"let k = 0; w: while (k < 10) { k++; for x in [1, 2, 3] { if (x == 2) { continue w } } }; k", "10"},
+		{"let n = 0; a: for x in [1, 2] { b: for y in [1, 2] { for z in [1, 2] { n++; if (z == 1) { continue b } } } }; n", "4"},
+		{"let n = 0; a: for x in 0..5 { for y in [1] { n++; break a } }; n", "1"},
+		{"define upTo(k) { let i = 0; while (i < k) { yield i; i++ } }; let n = 0; outer: for x in upTo(5) { for y in upTo(5) { if (y == 2) { continue outer }; n++ } }; n", "10"},
+		{"define f() { let out = 0; for x in [1, 2, 3] { if (x == 2) { break }; out = out + x }; return out }; f()", "1"},
+		{"define f() { let n = 0; for x in [1, 2, 3] { n++; continue }; return n }; f()", "3"},
+		{"define f() { let i = 0; while (true) { i++; if (i > 2) { break } }; return i }; f()", "3"},
+		{"define f() { outer: for x in [1] { for y in [1] { return 7 } }; return 0 }; f()", "7"},
+		{"for x in [1, 2] { break }", "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@memo define fib(n) { if (n < 2) { return n }; return fib(n - 1) + fib(n - 2) }; fib(90)", "2880067194370816120"},
+		{"@memo define fib(n) { if (n < 2) { return n }; return fib(n - 1) + fib(n - 2) }; fib(10); fib.cacheSize()", "11"},
+		{"@memo define fib(n) { if (n < 2) { return n }; return fib(n - 1) + fib(n - 2) }; fib(10); fib.cacheClear(); fib.cacheSize()", "0"},
+		{"let calls = 0; @memo define sq(x) { calls++; x * x }; sq(3); sq(3); sq(4); calls", "2"},
+		{"let calls = 0; @memo define len2(xs) { calls++; len(xs) }; len2([1, [2]]); len2([1, [2]]); calls", "1"},
+		{"let calls = 0; @memo define head(xs) { calls++; xs[0] }; head([1, 2]); head([1, 2]); head([2, 1]); [calls, head.cacheSize()]", "[2, 2]"},
+		{"@memo define head(xs) { xs[0] }; let a = [1]; head(a); a[0] = 3; [head(a), a]", "[3, [3]]"},
+		{"@memo define id(x) { x }; [id(1), id(1.0), id(\"1\"), id.cacheSize()]", "[1, 1, 1, 2]"},
+		{"@memo define paths(r, c) { if (r == 0 || c == 0) { return 1 }; paths(r - 1, c) + paths(r, c - 1) }; paths(16, 16)", "601080390"},
+		{"@memo define f(n) { n }; type(f)", "FUNCTION"},
+		{"@memo define double(n) { n * 2 }; 21 |> double", "42"},
+		{"@memo define double(n) { n * 2 }; map([1, 2], double)", "[2, 4]"},
+		{"define twice(f) { return x => f(f(x)) }; @twice define inc(n) { n + 1 }; inc(0)", "2"},
+		{"define times(k) { return f => (x => f(x) * k) }; define plus(n) { return f => (x => f(x) + n) }; @times(10) @plus(1) define id(x) { x }; id(2)", "30"},
+		{"let log = []; define trace(f) { define wrapper(x) { log = push(log, x); return f(x) }; return wrapper }; @trace define sq(x) { x * x }; sq(3); sq(4); log", "[3, 4]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let d = 1; @d define f() { 1 }", "decorator @d is not a function: INTEGER"},
+		{"define bad(f) { 5 }; @bad define f() { 1 }", "decorator @bad must return a function, got int"},
+		{"@memo define f(h) { 1 }; f({\"a\": 1})", "cannot memoize a call with argument 1 of type map: arguments must be usable as hash keys"},
+		{"@memo define f(n) { n }; f.cacheGet()", "memoized function has no method cacheGet"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert 1 + 1 == 2, \"math\"", "null"},
+		{"define f() { assert true; 7 }; f()", "7"},
+		{"let r = try { assert 1 > 2, \"order\" } catch (e) { e }; r", "assertion failed: order"},
+		{"let r = try { assert [1, 2] == [1, 3] } catch (e) { e }; r", "assertion failed: ([1, 2] == [1, 3])"},
+		{"let n = 0; try { assert false; n = 1 } catch (e) { n = 2 }; n", "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	detailTests := []struct {
+		input    string
+		message  string
+		expected []string
+	}{
+		{
+			"let xs = [3, 1]; assert xs[0] < xs[1]",
+			"assertion failed: ((xs[0]) < (xs[1]))",
+			[]string{"left:  (xs[0]) is 3", "right: (xs[1]) is 1"},
+		},
+		{
+			"let got = [1, 2, [3, 4]]; assert got == [1, 5, [3, 4, 5]], \"lists\"",
+			"assertion failed: lists",
+			[]string{
+				"left:  got is [1, 2, [3, 4]]",
+				"right: [1, 5, [3, 4, 5]]",
+				"at [1]: left has 2, right has 5",
+				"at [2]: left has 2 elements, right has 3",
+				"at [2][2]: only the right has 5",
+			},
+		},
+		{
+			"let h = {\"a\": 1, \"b\": \"x\"}; assert h == {\"a\": 1, \"b\": \"y\", \"c\": 3}",
+			"assertion failed: (h == {a:1, b:y, c:3})",
+			[]string{
+				"left:  h is {a: 1, b: x}",
+				"right: {a: 1, b: y, c: 3}",
+				"at [\"b\"]: left has \"x\", right has \"y\"",
+				"at [\"c\"]: only the right has 3",
+			},
+		},
+		{
+			"struct P { x, y }; let p = P { x: 1, y: 2 }; let q = P { x: 1, y: 3 }; assert p == q, \"points\"",
+			"assertion failed: points",
+			[]string{"left:  p is P { x: 1, y: 2 }", "right: q is P { x: 1, y: 3 }", "at .y: left has 2, right has 3"},
+		},
+		{
+			"let found = null; assert found, \"found it\"",
+			"assertion failed: found it",
+			[]string{"found evaluated to null"},
+		},
+	}
+
+	for _, tt := range detailTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.message {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.message, errObj.Message)
+		}
+		if strings.Join(errObj.Details, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong details for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, errObj.Details)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"math"
+	"math/big"
 	"victoria/ast"
 	"victoria/object"
 )
@@ -11,6 +13,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitNotExpression(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -32,8 +36,17 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() == object.INTEGER_OBJ {
 		value := right.(*object.Integer).Value
+		if value == minInt64 {
+			if strictIntegers {
+				return newError("integer overflow in negation (-(%d))", value)
+			}
+			return object.NewBigInteger(new(big.Int).Neg(big.NewInt(value)))
+		}
 		return &object.Integer{Value: -value}
 	}
+	if right.Type() == object.BIG_INTEGER_OBJ {
+		return object.NewBigInteger(new(big.Int).Neg(right.(*object.BigInteger).Value))
+	}
 	if right.Type() == object.FLOAT_OBJ {
 		value := right.(*object.Float).Value
 		return &object.Float{Value: -value}
@@ -42,9 +55,19 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	if result, ok := evalOperatorMethod(operator, left, right); ok {
+		return result
+	}
+
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isIntegral(left) && isIntegral(right):
+		return evalBigIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.BIG_INTEGER_OBJ && right.Type() == object.FLOAT_OBJ:
+		return evalFloatInfixExpression(operator, bigToFloat(left.(*object.BigInteger)), right)
+	case left.Type() == object.FLOAT_OBJ && right.Type() == object.BIG_INTEGER_OBJ:
+		return evalFloatInfixExpression(operator, left, bigToFloat(right.(*object.BigInteger)))
 	case left.Type() == object.FLOAT_OBJ && right.Type() == object.FLOAT_OBJ:
 		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.FLOAT_OBJ:
@@ -54,11 +77,13 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case isOrderingOperator(operator):
+		return evalComparison(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -70,21 +95,65 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		if result, overflow := addInt64(leftVal, rightVal); !overflow {
+			return &object.Integer{Value: result}
+		}
+		return integerOverflow(operator, leftVal, rightVal, new(big.Int).Add(big.NewInt(leftVal), big.NewInt(rightVal)))
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		if result, overflow := subInt64(leftVal, rightVal); !overflow {
+			return &object.Integer{Value: result}
+		}
+		return integerOverflow(operator, leftVal, rightVal, new(big.Int).Sub(big.NewInt(leftVal), big.NewInt(rightVal)))
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		if result, overflow := mulInt64(leftVal, rightVal); !overflow {
+			return &object.Integer{Value: result}
+		}
+		return integerOverflow(operator, leftVal, rightVal, new(big.Int).Mul(big.NewInt(leftVal), big.NewInt(rightVal)))
 	case "/":
 		if rightVal == 0 {
 			return newError("division by zero")
 		}
+		if leftVal == minInt64 && rightVal == -1 {
+			return integerOverflow(operator, leftVal, rightVal, new(big.Int).Neg(big.NewInt(leftVal)))
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "div":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == minInt64 && rightVal == -1 {
+			return integerOverflow(operator, leftVal, rightVal, new(big.Int).Neg(big.NewInt(leftVal)))
+		}
+		quotient := leftVal / rightVal
+		if leftVal%rightVal != 0 && (leftVal < 0) != (rightVal < 0) {
+			quotient--
+		}
+		return &object.Integer{Value: quotient}
 	case "%":
 		if rightVal == 0 {
 			return newError("division by zero")
 		}
 		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		return evalPowerExpression(left, right)
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		// Fast path for in-range shifts; everything else (errors, promotion)
+		// is handled by evalShiftExpression
+		if leftVal >= 0 && rightVal >= 0 && rightVal < 63 {
+			if operator == ">>" {
+				return &object.Integer{Value: leftVal >> rightVal}
+			}
+			if leftVal <= math.MaxInt64>>rightVal {
+				return &object.Integer{Value: leftVal << rightVal}
+			}
+		}
+		return evalShiftExpression(operator, left, right)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -118,6 +187,18 @@ func evalFloatInfixExpression(operator string, left, right object.Object) object
 			return newError("division by zero")
 		}
 		return &object.Float{Value: leftVal / rightVal}
+	case "div":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: math.Floor(leftVal / rightVal)}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -146,6 +227,8 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<", ">", "<=", ">=":
+		return evalComparison(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -158,18 +241,20 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 
 	if isTruthy(condition) {
+		traceBranch(ie, 0)
 		return Eval(ie.Consequence, env)
-	} else if ie.Alternative != nil {
+	}
+	traceBranch(ie, 1)
+	if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
-	} else {
-		return NULL
 	}
+	return NULL
 }
 
 func evalTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
 	result := Eval(node.Block, env)
 
-	if isError(result) {
+	if isError(result) && result != errGeneratorClosed {
 		if node.CatchBlock != nil {
 			catchEnv := object.NewEnclosedEnvironment(env)
 			if node.CatchVar != nil {
@@ -204,11 +289,23 @@ func evalArrayElements(exps []ast.Expression, env *object.Environment) []object.
 	for _, e := range exps {
 		if spread, ok := e.(*ast.SpreadExpression); ok {
 			evaluated := Eval(spread.Right, env)
+			if !isError(evaluated) {
+				evaluated = iterableOf(evaluated)
+			}
 			if isError(evaluated) {
 				return []object.Object{evaluated}
 			}
 			if arr, ok := evaluated.(*object.Array); ok {
 				result = append(result, arr.Elements...)
+			} else if r, ok := evaluated.(*object.Range); ok {
+				result = append(result, rangeElements(r)...)
+			} else if it, ok := evaluated.(*object.Iterator); ok {
+				for value, ok := it.Next(); ok; value, ok = it.Next() {
+					if isError(value) {
+						return []object.Object{value}
+					}
+					result = append(result, value)
+				}
 			} else {
 				return []object.Object{newError("spread operator requires an array, got %s", evaluated.Type())}
 			}
@@ -224,146 +321,35 @@ func evalArrayElements(exps []ast.Expression, env *object.Environment) []object.
 	return result
 }
 
-func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
-	left := Eval(node.Left, env)
-	if isError(left) {
-		return left
-	}
-
-	var startIdx, endIdx int64
-
-	switch obj := left.(type) {
-	case *object.Array:
-		length := int64(len(obj.Elements))
-
-		if node.Start != nil {
-			startVal := Eval(node.Start, env)
-			if isError(startVal) {
-				return startVal
-			}
-			if intVal, ok := startVal.(*object.Integer); ok {
-				startIdx = intVal.Value
-				if startIdx < 0 {
-					startIdx = length + startIdx
-				}
-			} else {
-				return newError("slice index must be an integer, got %s", startVal.Type())
-			}
-		} else {
-			startIdx = 0
-		}
-
-		if node.End != nil {
-			endVal := Eval(node.End, env)
-			if isError(endVal) {
-				return endVal
-			}
-			if intVal, ok := endVal.(*object.Integer); ok {
-				endIdx = intVal.Value
-				if endIdx < 0 {
-					endIdx = length + endIdx
-				}
-			} else {
-				return newError("slice index must be an integer, got %s", endVal.Type())
-			}
-		} else {
-			endIdx = length
-		}
-
-		if startIdx < 0 {
-			startIdx = 0
-		}
-		if endIdx > length {
-			endIdx = length
-		}
-		if startIdx > endIdx {
-			return &object.Array{Elements: []object.Object{}}
-		}
-
-		newElements := make([]object.Object, endIdx-startIdx)
-		copy(newElements, obj.Elements[startIdx:endIdx])
-		return &object.Array{Elements: newElements}
-
-	case *object.String:
-		length := int64(len(obj.Value))
-
-		if node.Start != nil {
-			startVal := Eval(node.Start, env)
-			if isError(startVal) {
-				return startVal
-			}
-			if intVal, ok := startVal.(*object.Integer); ok {
-				startIdx = intVal.Value
-				if startIdx < 0 {
-					startIdx = length + startIdx
-				}
-			} else {
-				return newError("slice index must be an integer, got %s", startVal.Type())
-			}
-		} else {
-			startIdx = 0
-		}
-
-		if node.End != nil {
-			endVal := Eval(node.End, env)
-			if isError(endVal) {
-				return endVal
-			}
-			if intVal, ok := endVal.(*object.Integer); ok {
-				endIdx = intVal.Value
-				if endIdx < 0 {
-					endIdx = length + endIdx
-				}
-			} else {
-				return newError("slice index must be an integer, got %s", endVal.Type())
-			}
-		} else {
-			endIdx = length
-		}
-
-		if startIdx < 0 {
-			startIdx = 0
-		}
-		if endIdx > length {
-			endIdx = length
-		}
-		if startIdx > endIdx {
-			return &object.String{Value: ""}
+func evalIndexExpression(left, index object.Object) object.Object {
+	if idx, ok := index.(*object.BigInteger); ok {
+		if length, ok := sequenceLength(left); ok {
+			return bigIndexError(idx, length)
 		}
-
-		return &object.String{Value: obj.Value[startIdx:endIdx]}
-
-	default:
-		return newError("slice operator not supported for: %s", left.Type())
 	}
-}
 
-func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalStringIndexExpression(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalRangeIndexExpression(left.(*object.Range), index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
+		if result, ok := callStructMethod(left, "__index", index); ok {
+			return result
+		}
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
 func evalStringIndexExpression(str, index object.Object) object.Object {
-	strObject := str.(*object.String)
-	idx := index.(*object.Integer).Value
-	runes := []rune(strObject.Value)
-	max := int64(len(runes) - 1)
-
-	// Handle negative indices
-	if idx < 0 {
-		idx = int64(len(runes)) + idx
-	}
-
-	if idx < 0 || idx > max {
-		return NULL
+	runes := []rune(str.(*object.String).Value)
+	idx, errObj := resolveIndex(index.(*object.Integer).Value, int64(len(runes)))
+	if errObj != nil {
+		return errObj
 	}
 
 	return &object.String{Value: string(runes[idx])}
@@ -371,11 +357,9 @@ func evalStringIndexExpression(str, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-
-	if idx < 0 || idx > max {
-		return NULL
+	idx, errObj := resolveIndex(index.(*object.Integer).Value, int64(len(arrayObject.Elements)))
+	if errObj != nil {
+		return errObj
 	}
 
 	return arrayObject.Elements[idx]
@@ -384,12 +368,12 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(index, key)
 	if !ok {
 		return NULL
 	}
@@ -398,15 +382,16 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(key)
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
@@ -416,11 +401,10 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(key, hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalStructInstantiation(node *ast.StructInstantiation, env *object.Environment) object.Object {
@@ -447,12 +431,19 @@ func evalStructInstantiation(node *ast.StructInstantiation, env *object.Environm
 	return instance
 }
 
+// evalDotExpression evaluates a.b, and a?.b which is null instead of an
+// error when a is null or is a hash or struct instance without b
 func evalDotExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
 	left := Eval(node.Left, env)
 	if isError(left) {
 		return left
 	}
 
+	optional := node.Operator == "?."
+	if optional && left == NULL {
+		return NULL
+	}
+
 	ident, ok := node.Right.(*ast.Identifier)
 	if !ok {
 		return newError("expected identifier after dot")
@@ -473,15 +464,32 @@ func evalDotExpression(node *ast.InfixExpression, env *object.Environment) objec
 
 	if left.Type() == object.HASH_OBJ {
 		hash := left.(*object.Hash)
-		key := &object.String{Value: ident.Value}
-		hashed := key.HashKey()
-		pair, ok := hash.Pairs[hashed]
+		pair, ok := hash.GetString(ident.Value)
 		if ok {
 			return pair.Value
 		}
+		if optional {
+			return NULL
+		}
 		return newError("property not found in hash: %s", ident.Value)
 	}
 
+	if set, ok := left.(*object.Set); ok {
+		return setMethod(set, ident.Value)
+	}
+
+	if it, ok := left.(*object.Iterator); ok {
+		return iteratorMethod(it, ident.Value)
+	}
+
+	if r, ok := left.(*object.Range); ok {
+		return rangeMethod(r, ident.Value)
+	}
+
+	if m, ok := left.(*object.Memoized); ok {
+		return memoMethod(m, ident.Value)
+	}
+
 	if left.Type() == object.INSTANCE_OBJ {
 		instance := left.(*object.StructInstance)
 
@@ -495,9 +503,12 @@ func evalDotExpression(node *ast.InfixExpression, env *object.Environment) objec
 			closureEnv := object.NewEnclosedEnvironment(fn.Env)
 			closureEnv.Set("self", instance)
 
-			return &object.Function{Parameters: fn.Parameters, Env: closureEnv, Body: fn.Body}
+			return &object.Function{Parameters: fn.Parameters, Env: closureEnv, Body: fn.Body, IsGenerator: fn.IsGenerator}
 		}
 
+		if optional {
+			return NULL
+		}
 		return newError("property or method not found: %s", ident.Value)
 	}
 
@@ -574,12 +585,32 @@ func evalPrefixIncDec(node *ast.PrefixExpression, env *object.Environment) objec
 	return newVal
 }
 
+// compoundOperators maps compound assignment operators to the infix operator they apply
+var compoundOperators = map[string]string{
+	"+=":  "+",
+	"-=":  "-",
+	"*=":  "*",
+	"/=":  "/",
+	"%=":  "%",
+	"**=": "**",
+	"&=":  "&",
+	"|=":  "|",
+	"^=":  "^",
+	"<<=": "<<",
+	">>=": ">>",
+}
+
 func evalAssignmentExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
 	// Handle index assignment: arr[i] = val or hash[key] = val
 	if indexExpr, ok := node.Left.(*ast.IndexExpression); ok {
 		return evalIndexAssignment(indexExpr, node.Right, node.Operator, env)
 	}
 
+	// Handle slice assignment: arr[1:3] = [x, y]
+	if sliceExpr, ok := node.Left.(*ast.SliceExpression); ok {
+		return evalSliceAssignment(sliceExpr, node.Right, node.Operator, env)
+	}
+
 	ident, ok := node.Left.(*ast.Identifier)
 	if !ok {
 		return newError("assignment to non-identifier")
@@ -613,22 +644,15 @@ func evalAssignmentExpression(node *ast.InfixExpression, env *object.Environment
 		return rightVal
 	}
 
-	var newVal object.Object
-	switch node.Operator {
-	case "+=":
-		newVal = evalInfixExpression("+", currentVal, rightVal)
-	case "-=":
-		newVal = evalInfixExpression("-", currentVal, rightVal)
-	case "*=":
-		newVal = evalInfixExpression("*", currentVal, rightVal)
-	case "/=":
-		newVal = evalInfixExpression("/", currentVal, rightVal)
-	case "%=":
-		newVal = evalInfixExpression("%", currentVal, rightVal)
-	}
+	newVal := evalInfixExpression(compoundOperators[node.Operator], currentVal, rightVal)
 
-	if isError(newVal) {
-		return newVal
+	if errObj, ok := newVal.(*object.Error); ok {
+		if errObj.Line == 0 {
+			errObj.Line = node.Token.Line
+			errObj.Column = node.Token.Column
+			errObj.EndColumn = node.Token.EndColumn
+		}
+		return errObj
 	}
 
 	env.Update(ident.Value, newVal)
@@ -652,72 +676,67 @@ func evalIndexAssignment(indexExpr *ast.IndexExpression, rightNode ast.Expressio
 		return val
 	}
 
+	result := assignIndex(left, index, val, operator)
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+		errObj.Line = indexExpr.Token.Line
+		errObj.Column = indexExpr.Token.Column
+		errObj.EndColumn = indexExpr.Token.EndColumn
+	}
+	return result
+}
+
+// assignIndex stores val at index in left, combining it with the current
+// value first for a compound operator such as +=
+func assignIndex(left, index, val object.Object, operator string) object.Object {
 	switch left := left.(type) {
 	case *object.Array:
-		idx, ok := index.(*object.Integer)
+		if idx, ok := index.(*object.BigInteger); ok {
+			return bigIndexError(idx, int64(len(left.Elements)))
+		}
+		index, ok := index.(*object.Integer)
 		if !ok {
 			return newError("array index must be an integer, got %s", index.Type())
 		}
-		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
-			return newError("array index out of bounds: %d", idx.Value)
+		idx, errObj := resolveIndex(index.Value, int64(len(left.Elements)))
+		if errObj != nil {
+			return errObj
+		}
+		if left.Frozen() {
+			return newError("cannot modify array %s: it is used as a hash key", left.Inspect())
 		}
 		if operator == "=" {
-			left.Elements[idx.Value] = val
+			left.Elements[idx] = val
 		} else {
-			currentVal := left.Elements[idx.Value]
-			var newVal object.Object
-			switch operator {
-			case "+=":
-				newVal = evalInfixExpression("+", currentVal, val)
-			case "-=":
-				newVal = evalInfixExpression("-", currentVal, val)
-			case "*=":
-				newVal = evalInfixExpression("*", currentVal, val)
-			case "/=":
-				newVal = evalInfixExpression("/", currentVal, val)
-			case "%=":
-				newVal = evalInfixExpression("%", currentVal, val)
-			}
+			currentVal := left.Elements[idx]
+			newVal := evalInfixExpression(compoundOperators[operator], currentVal, val)
 			if isError(newVal) {
 				return newVal
 			}
-			left.Elements[idx.Value] = newVal
+			left.Elements[idx] = newVal
 			val = newVal
 		}
 		return val
 
 	case *object.Hash:
-		hashKey, ok := index.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(index)
 		if !ok {
 			return newError("unusable as hash key: %s", index.Type())
 		}
 		if operator == "=" {
-			left.Pairs[hashKey.HashKey()] = object.HashPair{Key: index, Value: val}
+			left.Set(index, hashKey, val)
 		} else {
-			pair, exists := left.Pairs[hashKey.HashKey()]
+			pair, exists := left.Get(index, hashKey)
 			var currentVal object.Object
 			if exists {
 				currentVal = pair.Value
 			} else {
 				currentVal = NULL
 			}
-			var newVal object.Object
-			switch operator {
-			case "+=":
-				newVal = evalInfixExpression("+", currentVal, val)
-			case "-=":
-				newVal = evalInfixExpression("-", currentVal, val)
-			case "*=":
-				newVal = evalInfixExpression("*", currentVal, val)
-			case "/=":
-				newVal = evalInfixExpression("/", currentVal, val)
-			case "%=":
-				newVal = evalInfixExpression("%", currentVal, val)
-			}
+			newVal := evalInfixExpression(compoundOperators[operator], currentVal, val)
 			if isError(newVal) {
 				return newVal
 			}
-			left.Pairs[hashKey.HashKey()] = object.HashPair{Key: index, Value: newVal}
+			left.Set(index, hashKey, newVal)
 			val = newVal
 		}
 		return val
@@ -734,31 +753,9 @@ func evalTernaryExpression(node *ast.TernaryExpression, env *object.Environment)
 	}
 
 	if isTruthy(condition) {
+		traceBranch(node, 0)
 		return Eval(node.Consequence, env)
 	}
+	traceBranch(node, 1)
 	return Eval(node.Alternative, env)
 }
-
-func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
-	start := Eval(node.Start, env)
-	if isError(start) {
-		return start
-	}
-
-	end := Eval(node.End, env)
-	if isError(end) {
-		return end
-	}
-
-	startInt, ok := start.(*object.Integer)
-	if !ok {
-		return newError("range start must be an integer, got %s", start.Type())
-	}
-
-	endInt, ok := end.(*object.Integer)
-	if !ok {
-		return newError("range end must be an integer, got %s", end.Type())
-	}
-
-	return &object.Range{Start: startInt.Value, End: endInt.Value}
-}
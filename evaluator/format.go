@@ -0,0 +1,522 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"victoria/object"
+)
+
+// maxFormatWidth bounds the width of a format spec so that a typo cannot
+// allocate a huge padding string
+const maxFormatWidth = 10000
+
+// formatSpec is a parsed Python-style format specification:
+//
+//	[[fill]align][sign][#][0][width][grouping][.precision][type]
+type formatSpec struct {
+	raw       string
+	fill      rune
+	align     rune // '<', '>', '^', '=' or 0 for the default of the value's type
+	sign      rune // '+', '-' or ' '
+	alternate bool // '#': 0b/0o/0x prefixes
+	zero      bool // '0': pad numbers with zeros after the sign
+	width     int
+	grouping  rune // ',' or '_'
+	precision int  // -1 when absent
+	verb      rune // 'd', 'f', 'x', ... or 0 when absent
+}
+
+func parseFormatSpec(spec string) (*formatSpec, *object.Error) {
+	fs := &formatSpec{raw: spec, fill: ' ', precision: -1}
+	runes := []rune(spec)
+	i := 0
+
+	if len(runes) >= 2 && isAlignRune(runes[1]) {
+		fs.fill, fs.align = runes[0], runes[1]
+		i = 2
+	} else if len(runes) >= 1 && isAlignRune(runes[0]) {
+		fs.align = runes[0]
+		i = 1
+	}
+	if i < len(runes) && (runes[i] == '+' || runes[i] == '-' || runes[i] == ' ') {
+		fs.sign = runes[i]
+		i++
+	}
+	if i < len(runes) && runes[i] == '#' {
+		fs.alternate = true
+		i++
+	}
+	if i < len(runes) && runes[i] == '0' {
+		fs.zero = true
+		i++
+	}
+	start := i
+	for i < len(runes) && isDigitRune(runes[i]) {
+		i++
+	}
+	if i > start {
+		width, err := strconv.Atoi(string(runes[start:i]))
+		if err != nil || width > maxFormatWidth {
+			return nil, newError("invalid format spec %q: width is too large (maximum is %d)", spec, maxFormatWidth)
+		}
+		fs.width = width
+	}
+	if i < len(runes) && (runes[i] == ',' || runes[i] == '_') {
+		fs.grouping = runes[i]
+		i++
+	}
+	if i < len(runes) && runes[i] == '.' {
+		i++
+		start = i
+		for i < len(runes) && isDigitRune(runes[i]) {
+			i++
+		}
+		if i == start {
+			return nil, newError("invalid format spec %q: missing precision after '.'", spec)
+		}
+		precision, err := strconv.Atoi(string(runes[start:i]))
+		if err != nil || precision > maxFormatWidth {
+			return nil, newError("invalid format spec %q: precision is too large (maximum is %d)", spec, maxFormatWidth)
+		}
+		fs.precision = precision
+	}
+	if i < len(runes) {
+		if !strings.ContainsRune("bcdoxXeEfFgG%s", runes[i]) {
+			return nil, newError("invalid format spec %q: unknown format type '%c'", spec, runes[i])
+		}
+		fs.verb = runes[i]
+		i++
+	}
+	if i < len(runes) {
+		return nil, newError("invalid format spec %q: unexpected '%s'", spec, string(runes[i:]))
+	}
+	return fs, nil
+}
+
+func isAlignRune(r rune) bool {
+	return r == '<' || r == '>' || r == '^' || r == '='
+}
+
+func isDigitRune(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// formatValue formats a Victoria value according to a Python-style spec
+func formatValue(obj object.Object, spec string) (string, *object.Error) {
+	fs, errObj := parseFormatSpec(spec)
+	if errObj != nil {
+		return "", errObj
+	}
+	return fs.format(obj)
+}
+
+func (fs *formatSpec) format(obj object.Object) (string, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.BigInteger:
+		value, _ := object.ToBigInt(obj)
+		switch fs.verb {
+		case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+			f, _ := new(big.Float).SetInt(value).Float64()
+			return fs.formatFloat(f)
+		}
+		return fs.formatInteger(value, object.TypeName(obj))
+	case *object.Float:
+		return fs.formatFloat(obj.Value)
+	case *object.Char:
+		if fs.verb == 'c' {
+			fs.verb = 's'
+		}
+		return fs.formatString(string(obj.Value), "char")
+	case *object.Rune:
+		if fs.verb == 'c' {
+			fs.verb = 's'
+		}
+		return fs.formatString(string(obj.Value), "rune")
+	default:
+		return fs.formatString(obj.Inspect(), object.TypeName(obj))
+	}
+}
+
+func (fs *formatSpec) invalidFor(typeName string) *object.Error {
+	return newError("format spec %q is not valid for a value of type %s", fs.raw, typeName)
+}
+
+func (fs *formatSpec) formatInteger(value *big.Int, typeName string) (string, *object.Error) {
+	if fs.precision >= 0 {
+		return "", newError("invalid format spec %q: precision is not allowed for integers", fs.raw)
+	}
+
+	base, prefix := 10, ""
+	switch fs.verb {
+	case 0, 'd':
+	case 'b':
+		base, prefix = 2, "0b"
+	case 'o':
+		base, prefix = 8, "0o"
+	case 'x':
+		base, prefix = 16, "0x"
+	case 'X':
+		base, prefix = 16, "0X"
+	case 'c':
+		if !value.IsInt64() || value.Int64() < 0 || value.Int64() > utf8.MaxRune {
+			return "", newError("format spec %q: %s is not a valid character code", fs.raw, value)
+		}
+		fs.verb = 's'
+		return fs.formatString(string(rune(value.Int64())), typeName)
+	default:
+		return "", fs.invalidFor(typeName)
+	}
+	if fs.grouping == ',' && base != 10 {
+		return "", newError("invalid format spec %q: ',' grouping is only allowed for decimal numbers", fs.raw)
+	}
+
+	digits := new(big.Int).Abs(value).Text(base)
+	if fs.verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	if fs.grouping != 0 {
+		size := 3
+		if base != 10 {
+			size = 4
+		}
+		digits = groupDigits(digits, fs.grouping, size)
+	}
+	if !fs.alternate {
+		prefix = ""
+	}
+	return fs.pad(fs.signOf(value.Sign() < 0)+prefix, digits, '>'), nil
+}
+
+func (fs *formatSpec) formatFloat(value float64) (string, *object.Error) {
+	precision := fs.precision
+	verb := fs.verb
+	switch verb {
+	case 0:
+		if precision < 0 {
+			// Same as printing the value: shortest representation
+			return fs.pad(fs.signOf(math.Signbit(value)), strconv.FormatFloat(math.Abs(value), 'g', -1, 64), '>'), nil
+		}
+		verb = 'g'
+	case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+	default:
+		return "", fs.invalidFor("float")
+	}
+	if precision < 0 {
+		precision = 6
+	}
+
+	negative := math.Signbit(value) && !math.IsNaN(value)
+	magnitude := math.Abs(value)
+	suffix := ""
+	if verb == '%' {
+		magnitude *= 100
+		verb, suffix = 'f', "%"
+	}
+	if verb == 'F' {
+		verb = 'f'
+	}
+
+	digits := strconv.FormatFloat(magnitude, byte(verb), precision, 64)
+	if fs.alternate && !strings.ContainsAny(digits, ".eEIN") {
+		digits += "."
+	}
+	if fs.grouping != 0 {
+		intPart, rest := digits, ""
+		if idx := strings.IndexAny(digits, ".eE"); idx >= 0 {
+			intPart, rest = digits[:idx], digits[idx:]
+		}
+		digits = groupDigits(intPart, fs.grouping, 3) + rest
+	}
+	return fs.pad(fs.signOf(negative), digits+suffix, '>'), nil
+}
+
+func (fs *formatSpec) formatString(value, typeName string) (string, *object.Error) {
+	if fs.verb != 0 && fs.verb != 's' {
+		return "", fs.invalidFor(typeName)
+	}
+	if fs.sign != 0 || fs.alternate || fs.grouping != 0 || fs.align == '=' {
+		return "", newError("invalid format spec %q: sign, '#', grouping and '=' alignment are only allowed for numbers", fs.raw)
+	}
+	if fs.precision >= 0 && utf8.RuneCountInString(value) > fs.precision {
+		value = string([]rune(value)[:fs.precision])
+	}
+	if fs.zero && fs.align == 0 {
+		fs.fill = '0'
+	}
+	return fs.pad("", value, '<'), nil
+}
+
+// signOf returns the sign prefix for a number
+func (fs *formatSpec) signOf(negative bool) string {
+	switch {
+	case negative:
+		return "-"
+	case fs.sign == '+':
+		return "+"
+	case fs.sign == ' ':
+		return " "
+	default:
+		return ""
+	}
+}
+
+// pad aligns prefix+body to the spec's width. With '=' alignment (or the '0'
+// flag on numbers) the padding goes between the sign/prefix and the digits.
+func (fs *formatSpec) pad(prefix, body string, defaultAlign rune) string {
+	align, fill := fs.align, fs.fill
+	if align == 0 {
+		align = defaultAlign
+		if fs.zero && defaultAlign == '>' {
+			align, fill = '=', '0'
+		}
+	}
+
+	length := utf8.RuneCountInString(prefix) + utf8.RuneCountInString(body)
+	if length >= fs.width {
+		return prefix + body
+	}
+	padding := fs.width - length
+	fillStr := string(fill)
+
+	switch align {
+	case '<':
+		return prefix + body + strings.Repeat(fillStr, padding)
+	case '^':
+		left := padding / 2
+		return strings.Repeat(fillStr, left) + prefix + body + strings.Repeat(fillStr, padding-left)
+	case '=':
+		return prefix + strings.Repeat(fillStr, padding) + body
+	default:
+		return strings.Repeat(fillStr, padding) + prefix + body
+	}
+}
+
+// groupDigits inserts sep every size digits from the right
+func groupDigits(digits string, sep rune, size int) string {
+	if len(digits) <= size {
+		return digits
+	}
+	var sb strings.Builder
+	first := len(digits) % size
+	if first > 0 {
+		sb.WriteString(digits[:first])
+	}
+	for i := first; i < len(digits); i += size {
+		if sb.Len() > 0 {
+			sb.WriteRune(sep)
+		}
+		sb.WriteString(digits[i : i+size])
+	}
+	return sb.String()
+}
+
+// formatTemplate implements the `format` builtin. Templates with `{}`
+// placeholders use Python-style fields ({}, {0}, {:.2f}, {1:>8}); otherwise
+// printf-style verbs (%d, %5.2f, %-10s, %x) are translated to the same specs,
+// so both styles understand Victoria values.
+func formatTemplate(template string, args []object.Object) object.Object {
+	if hasBracePlaceholder(template) {
+		return formatBraceTemplate(template, args)
+	}
+	return formatPercentTemplate(template, args)
+}
+
+func hasBracePlaceholder(template string) bool {
+	for i := 0; i+1 < len(template); i++ {
+		if template[i] != '{' {
+			continue
+		}
+		if template[i+1] == '{' {
+			i++
+			continue
+		}
+		if c := template[i+1]; c == '}' || c == ':' || ('0' <= c && c <= '9') {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBraceTemplate(template string, args []object.Object) object.Object {
+	var sb strings.Builder
+	next := 0
+	manual, automatic := false, false
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c == '}' {
+			if i+1 < len(template) && template[i+1] == '}' {
+				sb.WriteByte('}')
+				i++
+				continue
+			}
+			return newError("invalid format string: single '}' at position %d (use '}}' for a literal brace)", i)
+		}
+		if c != '{' {
+			sb.WriteByte(c)
+			continue
+		}
+		if i+1 < len(template) && template[i+1] == '{' {
+			sb.WriteByte('{')
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(template[i:], '}')
+		if end < 0 {
+			return newError("invalid format string: unclosed '{' at position %d", i)
+		}
+		field := template[i+1 : i+end]
+		i += end
+
+		name, spec, _ := strings.Cut(field, ":")
+		index := next
+		if name == "" {
+			automatic = true
+			next++
+		} else {
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 0 {
+				return newError("invalid format string: field {%s} must be empty or an argument number", field)
+			}
+			manual = true
+			index = n
+		}
+		if manual && automatic {
+			return newError("invalid format string: cannot mix automatic {} and numbered {0} fields")
+		}
+		if index >= len(args) {
+			return newError("format: field {%s} has no matching argument (got %d arguments)", field, len(args))
+		}
+
+		text, errObj := formatValue(args[index], spec)
+		if errObj != nil {
+			return errObj
+		}
+		sb.WriteString(text)
+	}
+	return &object.String{Value: sb.String()}
+}
+
+func formatPercentTemplate(template string, args []object.Object) object.Object {
+	var sb strings.Builder
+	next := 0
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			sb.WriteByte(template[i])
+			continue
+		}
+		if i+1 < len(template) && template[i+1] == '%' {
+			sb.WriteByte('%')
+			i++
+			continue
+		}
+
+		// %[flags][width][.precision]verb
+		j := i + 1
+		var spec strings.Builder
+		leftAlign := false
+		for ; j < len(template) && strings.IndexByte("-+ #0", template[j]) >= 0; j++ {
+			switch template[j] {
+			case '-':
+				leftAlign = true
+			case '+', ' ', '#', '0':
+				spec.WriteByte(template[j])
+			}
+		}
+		for j < len(template) && (isDigitRune(rune(template[j])) || template[j] == '.') {
+			spec.WriteByte(template[j])
+			j++
+		}
+		if j >= len(template) {
+			return newError("invalid format string: incomplete verb %q", template[i:])
+		}
+
+		verb := template[j]
+		directive := template[i : j+1]
+		i = j
+		if next >= len(args) {
+			return newError("format: %s has no matching argument (got %d arguments)", directive, len(args))
+		}
+		arg := args[next]
+		next++
+
+		switch verb {
+		case 'v', 's':
+			// %s prints any value the way print() would
+			arg = &object.String{Value: arg.Inspect()}
+		case 'q':
+			arg = &object.String{Value: strconv.Quote(arg.Inspect())}
+		case 'd', 'b', 'o', 'x', 'X', 'e', 'E', 'f', 'F', 'g', 'G', 'c':
+			spec.WriteByte(verb)
+		default:
+			return newError("invalid format string: unknown verb %s", directive)
+		}
+
+		fs, errObj := parseFormatSpec(spec.String())
+		if errObj != nil {
+			return errObj
+		}
+		fs.raw = directive
+		// printf pads on the left unless '-' is given, strings included
+		if leftAlign {
+			fs.align, fs.zero = '<', false
+		} else if !fs.zero {
+			fs.align = '>'
+		}
+		text, errObj := fs.format(arg)
+		if errObj != nil {
+			return errObj
+		}
+		sb.WriteString(text)
+	}
+	if next < len(args) {
+		return newError("format: %d unused argument(s)", len(args)-next)
+	}
+	return &object.String{Value: sb.String()}
+}
+
+// splitInterpolation splits the inside of ${...} into the expression and an
+// optional format spec after a top-level ':' ("price:.2f"). Colons inside
+// brackets, strings and the else-branch of a ternary are not separators; the
+// '?' of ?. and ?? does not start a ternary.
+func splitInterpolation(content string) (string, string, bool) {
+	depth, ternaries := 0, 0
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; c {
+		case '"', '\'', '`':
+			for i++; i < len(content) && content[i] != c; i++ {
+				if content[i] == '\\' {
+					i++
+				}
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '?':
+			switch {
+			case strings.HasPrefix(content[i:], "??"):
+				i++
+			case strings.HasPrefix(content[i:], "?.") && (i+2 >= len(content) || !isDigitRune(rune(content[i+2]))):
+				i++
+			case depth == 0:
+				ternaries++
+			}
+		case ':':
+			if depth != 0 {
+				continue
+			}
+			if ternaries > 0 {
+				ternaries--
+				continue
+			}
+			return content[:i], content[i+1:], true
+		}
+	}
+	return content, "", false
+}
@@ -1,9 +1,16 @@
 package evaluator
 
 import (
+	"victoria/ast"
 	"victoria/object"
 )
 
+// CallFunction calls fn with args from outside the interpreter, as a call
+// expression in a program would. Runners use it for hooks like setup().
+func CallFunction(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	if fn == nil {
 		return newError("not a function: nil")
@@ -24,11 +31,19 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 					}
 				}
 			}
+		} else if len(args) < len(fn.Parameters) {
+			return newError("wrong number of arguments: expected %d, got %d",
+				len(fn.Parameters), len(args))
 		}
 
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		result := unwrapReturnValue(evaluated)
+		var result object.Object
+		if fn.IsGenerator {
+			result = newGenerator(fn, args)
+		} else {
+			extendedEnv := extendFunctionEnv(fn, args)
+			evaluated := Eval(fn.Body, extendedEnv)
+			result = unwrapReturnValue(evaluated)
+		}
 
 		// Type check return value if return types are specified
 		if len(fn.ReturnTypes) > 0 && !isError(result) {
@@ -52,11 +67,60 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	case *object.Builtin:
 		return fn.Fn(args...)
 
+	case *object.Memoized:
+		return callMemoized(fn, args)
+
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// evalPipeExpression evaluates value |> stage. A call stage f(a, b) becomes
+// f(value, a, b); any other stage must evaluate to a function, which is
+// called with value alone.
+func evalPipeExpression(node *ast.PipeExpression, env *object.Environment) object.Object {
+	value := Eval(node.Left, env)
+	if isError(value) {
+		return value
+	}
+
+	args := []object.Object{value}
+	stage := node.Token
+
+	var function object.Object
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		function = Eval(call.Function, env)
+		if isError(function) {
+			return function
+		}
+		rest := evalExpressions(call.Arguments, env)
+		if len(rest) == 1 && isError(rest[0]) {
+			return rest[0]
+		}
+		args = append(args, rest...)
+		stage = call.Token
+	} else {
+		function = Eval(node.Right, env)
+		if isError(function) {
+			return function
+		}
+	}
+
+	var result object.Object
+	if isCallable(function) {
+		result = applyFunction(function, args)
+	} else {
+		result = newError("cannot pipe into %s: the right side of |> must be a call or a function", function.Type())
+	}
+
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+		errObj.Line = stage.Line
+		errObj.Column = stage.Column
+		errObj.EndColumn = stage.EndColumn
+	}
+	return result
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -88,7 +152,7 @@ func unwrapReturnValue(obj object.Object) object.Object {
 // isCallable checks if an object can be called as a function
 func isCallable(obj object.Object) bool {
 	switch obj.Type() {
-	case object.FUNCTION_OBJ, object.ARROW_FUNCTION_OBJ, object.BUILTIN_OBJ:
+	case object.FUNCTION_OBJ, object.ARROW_FUNCTION_OBJ, object.BUILTIN_OBJ, object.MEMOIZED_OBJ:
 		return true
 	default:
 		return false
@@ -102,6 +166,8 @@ func getParamCount(obj object.Object) int {
 		return len(fn.Parameters)
 	case *object.ArrowFunction:
 		return len(fn.Parameters)
+	case *object.Memoized:
+		return getParamCount(fn.Fn)
 	default:
 		return 0
 	}
@@ -112,6 +178,8 @@ func unwrapObject(obj object.Object) interface{} {
 	switch obj := obj.(type) {
 	case *object.Integer:
 		return obj.Value
+	case *object.BigInteger:
+		return obj.Value
 	case *object.Boolean:
 		return obj.Value
 	case *object.String:
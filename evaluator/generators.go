@@ -0,0 +1,246 @@
+package evaluator
+
+import (
+	"runtime"
+	"sync"
+
+	"victoria/ast"
+	"victoria/object"
+)
+
+// errGeneratorClosed unwinds a generator body whose consumer stopped early.
+// try/catch does not intercept it.
+var errGeneratorClosed = &object.Error{Message: "generator closed"}
+
+// generator runs a generator function's body on its own goroutine, handing
+// control back and forth with the consumer so only one side runs at a time.
+// It is stored in the body's environment under the "yield" keyword, which
+// no user binding can shadow.
+type generator struct {
+	fn       *object.Function
+	args     []object.Object
+	values   chan object.Object
+	resume   chan bool
+	started  bool
+	finished bool
+}
+
+func (g *generator) Type() object.ObjectType { return object.ITERATOR_OBJ }
+func (g *generator) Inspect() string         { return "<generator>" }
+
+// suspended holds the generators whose body has started and not finished.
+// A consumer that stops calling next() without closing leaves the body's
+// goroutine parked at a yield; ClearEvalContext closes whatever the run
+// left here.
+var (
+	suspendedMu sync.Mutex
+	suspended   = map[*generator]struct{}{}
+)
+
+// newGenerator returns an iterator over the values fn yields. The body does
+// not start running until the first value is requested.
+func newGenerator(fn *object.Function, args []object.Object) *object.Iterator {
+	g := &generator{
+		fn:     fn,
+		args:   args,
+		values: make(chan object.Object),
+		resume: make(chan bool),
+	}
+	it := &object.Iterator{Name: "generator", Next: g.next, Close: g.close}
+	// The body's goroutine only refers to g, so the iterator can become
+	// unreachable while the body is parked; close it then rather than at
+	// the end of the run. Unwinding runs no user code.
+	runtime.SetFinalizer(it, func(*object.Iterator) { go g.close() })
+	return it
+}
+
+// release removes g from suspended, reporting whether it was there, so a
+// generator is only ever unwound once
+func (g *generator) release() bool {
+	suspendedMu.Lock()
+	defer suspendedMu.Unlock()
+	if _, ok := suspended[g]; !ok {
+		return false
+	}
+	delete(suspended, g)
+	return true
+}
+
+// closeSuspendedGenerators closes every generator still parked at a yield
+func closeSuspendedGenerators() {
+	suspendedMu.Lock()
+	gens := make([]*generator, 0, len(suspended))
+	for g := range suspended {
+		gens = append(gens, g)
+	}
+	suspendedMu.Unlock()
+
+	for _, g := range gens {
+		g.close()
+	}
+}
+
+func (g *generator) run() {
+	defer close(g.values)
+
+	env := extendFunctionEnv(g.fn, g.args)
+	env.Set("yield", g)
+
+	result := unwrapReturnValue(Eval(g.fn.Body, env))
+	if isError(result) && result != errGeneratorClosed {
+		g.values <- result
+	}
+}
+
+func (g *generator) next() (object.Object, bool) {
+	if g.finished {
+		return nil, false
+	}
+	if g.started {
+		g.resume <- true
+	} else {
+		g.started = true
+		suspendedMu.Lock()
+		suspended[g] = struct{}{}
+		suspendedMu.Unlock()
+		go g.run()
+	}
+
+	value, ok := <-g.values
+	if !ok || isError(value) {
+		g.finished = true
+		g.release()
+	}
+	return value, ok
+}
+
+// close stops a generator that is suspended at a yield, unwinding its body
+func (g *generator) close() {
+	if !g.release() {
+		g.finished = true
+		return
+	}
+	g.finished = true
+	g.resume <- false
+	for range g.values {
+		g.resume <- false
+	}
+}
+
+// yield suspends the body until the consumer asks for the next value
+func (g *generator) yield(value object.Object) object.Object {
+	g.values <- value
+	if !<-g.resume {
+		return errGeneratorClosed
+	}
+	return NULL
+}
+
+func evalYieldStatement(node *ast.YieldStatement, env *object.Environment) object.Object {
+	var value object.Object = NULL
+	if node.Value != nil {
+		value = Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+	}
+
+	obj, _ := env.Get("yield")
+	g, ok := obj.(*generator)
+	if !ok {
+		return newError("yield outside of a generator")
+	}
+	return g.yield(value)
+}
+
+// iteratorMethod returns the method name bound to it, for calls like gen.next()
+func iteratorMethod(it *object.Iterator, name string) object.Object {
+	switch name {
+	case "next":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments to `next`. got=%d, want=0", len(args))
+			}
+			value, ok := it.Next()
+			if ok && isError(value) {
+				return value
+			}
+			step := object.NewHash()
+			if !ok {
+				value = NULL
+			}
+			step.SetString("value", value)
+			step.SetString("done", nativeBoolToBooleanObject(!ok))
+			return step
+		}}
+
+	case "close":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if it.Close != nil {
+				it.Close()
+			}
+			return NULL
+		}}
+	}
+
+	return newError("iterator has no method %s", name)
+}
+
+// structIterator adapts a struct instance with a next() method returning
+// {"value": v, "done": bool} to an iterator
+func structIterator(instance *object.StructInstance) (*object.Iterator, bool) {
+	if _, ok := instance.Struct.Methods["next"]; !ok {
+		return nil, false
+	}
+
+	done := false
+	next := func() (object.Object, bool) {
+		if done {
+			return nil, false
+		}
+		result, _ := callStructMethod(instance, "next")
+		if isError(result) {
+			done = true
+			return result, true
+		}
+		step, ok := result.(*object.Hash)
+		if !ok {
+			done = true
+			return newError("%s.next must return {\"value\": v, \"done\": bool}, got %s", instance.Struct.Name, object.TypeName(result)), true
+		}
+		if pair, ok := step.GetString("done"); ok && isTruthy(pair.Value) {
+			done = true
+			return nil, false
+		}
+		if pair, ok := step.GetString("value"); ok {
+			return pair.Value, true
+		}
+		return NULL, true
+	}
+	return &object.Iterator{Name: instance.Struct.Name, Next: next}, true
+}
+
+// evalIteratorLoop calls body with each value it produces, closing it when
+// the loop, named label, ends early through break, return or an error
+func evalIteratorLoop(it *object.Iterator, label string, body func(index int64, value object.Object) object.Object) object.Object {
+	if it.Close != nil {
+		defer it.Close()
+	}
+
+	var result object.Object = NULL
+
+	for i := int64(0); ; i++ {
+		value, ok := it.Next()
+		if !ok {
+			return result
+		}
+		if isError(value) {
+			return value
+		}
+
+		var stop bool
+		if result, stop = loopControl(body(i, value), label); stop {
+			return result
+		}
+	}
+}
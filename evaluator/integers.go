@@ -0,0 +1,308 @@
+package evaluator
+
+import (
+	"math/big"
+	"math/bits"
+	"strings"
+	"victoria/object"
+)
+
+// strictIntegers makes integer overflow an error instead of promoting the
+// result to an arbitrary-precision BigInteger
+var strictIntegers bool
+
+// SetStrictIntegers enables or disables strict integer mode. In strict mode an
+// int64 overflow raises an "integer overflow" error (reported as W0003).
+func SetStrictIntegers(strict bool) {
+	strictIntegers = strict
+}
+
+// isIntegral returns true for Integer and BigInteger values
+func isIntegral(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.BIG_INTEGER_OBJ
+}
+
+// integerOverflow is called when an int64 operation overflows. It returns the
+// promoted result, or an error in strict mode.
+func integerOverflow(operation string, left, right int64, result *big.Int) object.Object {
+	if strictIntegers {
+		return newError("integer overflow in %s (%d %s %d)", operationName(operation), left, operation, right)
+	}
+	return object.NewBigInteger(result)
+}
+
+func operationName(operator string) string {
+	switch operator {
+	case "+":
+		return "addition"
+	case "-":
+		return "subtraction"
+	case "*":
+		return "multiplication"
+	case "/", "div":
+		return "division"
+	case "**":
+		return "exponentiation"
+	default:
+		return "`" + operator + "`"
+	}
+}
+
+// addInt64 returns a+b and whether it overflowed
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) != (b > 0)
+}
+
+// subInt64 returns a-b and whether it overflowed
+func subInt64(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) != (b > 0)
+}
+
+// mulInt64 returns a*b and whether it overflowed
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, false
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == minInt64) || (b == -1 && a == minInt64) {
+		return c, true
+	}
+	return c, false
+}
+
+const minInt64 = -1 << 63
+
+// maxShiftAmount bounds shift amounts so that `1 << n` cannot allocate an
+// absurdly large big integer by accident
+const maxShiftAmount = 1 << 16
+
+// evalShiftExpression evaluates << and >> for Integer and BigInteger operands.
+// Left shifts that overflow int64 are promoted like other arithmetic.
+func evalShiftExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToBigInt(left)
+	rightVal, _ := object.ToBigInt(right)
+
+	if rightVal.Sign() < 0 {
+		return newError("negative shift amount: %s", rightVal)
+	}
+	if !rightVal.IsInt64() || rightVal.Int64() > maxShiftAmount {
+		return newError("shift amount too large: %s (maximum is %d)", rightVal, maxShiftAmount)
+	}
+	if leftVal.Sign() < 0 {
+		return newError("cannot shift negative value: %s", leftVal)
+	}
+
+	amount := uint(rightVal.Int64())
+	if operator == ">>" {
+		return object.NewBigInteger(new(big.Int).Rsh(leftVal, amount))
+	}
+
+	result := new(big.Int).Lsh(leftVal, amount)
+	if !result.IsInt64() && strictIntegers {
+		return newError("integer overflow in left shift (%s << %d)", leftVal, amount)
+	}
+	return object.NewBigInteger(result)
+}
+
+// maxPowerBits bounds the size of an integer power result (about 315,000
+// decimal digits) so that a typo like 10 ** 10 ** 10 fails fast
+const maxPowerBits = 1 << 20
+
+// evalPowerExpression evaluates ** for Integer and BigInteger operands. The
+// result is always an integer; results beyond int64 are promoted.
+func evalPowerExpression(left, right object.Object) object.Object {
+	base, _ := object.ToBigInt(left)
+	exponent, _ := object.ToBigInt(right)
+
+	if exponent.Sign() < 0 {
+		return newError("negative exponent in integer power: %s ** %s", base, exponent)
+	}
+
+	// 0, 1 and -1 stay small for any exponent
+	if base.IsInt64() && base.Int64() >= -1 && base.Int64() <= 1 {
+		if base.Sign() < 0 && exponent.Bit(0) == 0 {
+			return &object.Integer{Value: 1}
+		}
+		if base.Sign() == 0 && exponent.Sign() == 0 {
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: base.Int64()}
+	}
+
+	if !exponent.IsInt64() || exponent.Int64() > maxPowerBits ||
+		int64(base.BitLen()-1)*exponent.Int64() > maxPowerBits {
+		return newError("integer power too large: %s ** %s", base, exponent)
+	}
+
+	if a, ok := left.(*object.Integer); ok {
+		if result, overflow := powInt64(a.Value, exponent.Int64()); !overflow {
+			return &object.Integer{Value: result}
+		}
+		result := new(big.Int).Exp(base, exponent, nil)
+		return integerOverflow("**", a.Value, exponent.Int64(), result)
+	}
+	return object.NewBigInteger(new(big.Int).Exp(base, exponent, nil))
+}
+
+// powInt64 returns base**exp by repeated squaring and whether it overflowed
+func powInt64(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for {
+		if exp&1 == 1 {
+			var overflow bool
+			if result, overflow = mulInt64(result, base); overflow {
+				return 0, true
+			}
+		}
+		exp >>= 1
+		if exp == 0 {
+			return result, false
+		}
+		var overflow bool
+		if base, overflow = mulInt64(base, base); overflow {
+			return 0, true
+		}
+	}
+}
+
+// evalBitNotExpression evaluates ~x (two's complement, so ~x == -x - 1)
+func evalBitNotExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInteger:
+		return object.NewBigInteger(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
+}
+
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToBigInt(left)
+	rightVal, _ := object.ToBigInt(right)
+
+	switch operator {
+	case "+":
+		return object.NewBigInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return object.NewBigInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return object.NewBigInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewBigInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "div":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		quotient, remainder := new(big.Int).QuoRem(leftVal, rightVal, new(big.Int))
+		if remainder.Sign() != 0 && remainder.Sign() != rightVal.Sign() {
+			quotient.Sub(quotient, big.NewInt(1))
+		}
+		return object.NewBigInteger(quotient)
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewBigInteger(new(big.Int).Rem(leftVal, rightVal))
+	case "**":
+		return evalPowerExpression(left, right)
+	case "&":
+		return object.NewBigInteger(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return object.NewBigInteger(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return object.NewBigInteger(new(big.Int).Xor(leftVal, rightVal))
+	case "<<", ">>":
+		return evalShiftExpression(operator, left, right)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// bigToFloat converts a BigInteger to the nearest float64
+func bigToFloat(obj *object.BigInteger) *object.Float {
+	f, _ := new(big.Float).SetInt(obj.Value).Float64()
+	return &object.Float{Value: f}
+}
+
+// bitArgument validates an argument of a bit-manipulation builtin
+func bitArgument(name string, arg object.Object) (*big.Int, *object.Error) {
+	value, ok := object.ToBigInt(arg)
+	if !ok {
+		return nil, newError("argument to `%s` must be INTEGER, got %s", name, arg.Type())
+	}
+	if value.Sign() < 0 {
+		return nil, newError("argument to `%s` must be a non-negative integer, got %s", name, value)
+	}
+	return value, nil
+}
+
+// popcount returns the number of set bits in a non-negative integer
+func popcount(value *big.Int) int {
+	count := 0
+	for _, word := range value.Bits() {
+		count += bits.OnesCount(uint(word))
+	}
+	return count
+}
+
+// baseArgument validates a numeric base argument (2 to 36)
+func baseArgument(name string, arg object.Object) (int, *object.Error) {
+	base, ok := arg.(*object.Integer)
+	if !ok {
+		return 0, newError("base argument to `%s` must be INTEGER, got %s", name, arg.Type())
+	}
+	if base.Value < 2 || base.Value > 36 {
+		return 0, newError("invalid base %d for `%s`: base must be between 2 and 36", base.Value, name)
+	}
+	return int(base.Value), nil
+}
+
+// parseIntWithBase implements int(s, base). A prefix matching the base
+// (e.g. "0xff" with base 16) is accepted, as are `_` digit separators.
+func parseIntWithBase(str, baseArg object.Object) object.Object {
+	s, ok := str.(*object.String)
+	if !ok {
+		return newError("first argument to `int` must be STRING when a base is given, got %s", str.Type())
+	}
+	base, errObj := baseArgument("int", baseArg)
+	if errObj != nil {
+		return errObj
+	}
+
+	digits := strings.TrimSpace(s.Value)
+	sign := ""
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if prefix, ok := basePrefixes[base]; ok && len(digits) > 2 && strings.EqualFold(digits[:2], prefix) {
+		digits = digits[2:]
+	}
+	digits = strings.ReplaceAll(digits, "_", "")
+
+	value, ok := new(big.Int).SetString(sign+digits, base)
+	if !ok || digits == "" {
+		return newError("could not parse %q as integer in base %d", s.Value, base)
+	}
+	return object.NewBigInteger(value)
+}
+
+var basePrefixes = map[int]string{2: "0b", 8: "0o", 16: "0x"}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,14 +29,59 @@ import (
 // moduleRegistry holds all available modules
 var moduleRegistry = make(map[string]func() *object.Hash)
 
-// createModule creates a hash object from a map of methods
+// createModule creates a hash object from a map of methods, sorted by name
 func createModule(methods map[string]object.Object) *object.Hash {
-	pairs := make(map[object.HashKey]object.HashPair)
-	for name, method := range methods {
-		key := &object.String{Value: name}
-		pairs[key.HashKey()] = object.HashPair{Key: key, Value: method}
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
 	}
-	return &object.Hash{Pairs: pairs}
+	sort.Strings(names)
+	pairs := object.NewHash()
+	for _, name := range names {
+		pairs.SetString(name, methods[name])
+	}
+	return pairs
+}
+
+// headerHash converts headers or query values to a hash with sorted keys
+func headerHash(values map[string][]string, sep string) *object.Hash {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := object.NewHash()
+	for _, key := range keys {
+		pairs.SetString(key, &object.String{Value: strings.Join(values[key], sep)})
+	}
+	return pairs
+}
+
+// lineIterator streams the lines of file, closing it once they run out or
+// the consumer stops early
+func lineIterator(file *os.File) *object.Iterator {
+	scanner := bufio.NewScanner(file)
+	closed := false
+	closeFile := func() {
+		if !closed {
+			closed = true
+			file.Close()
+		}
+	}
+	next := func() (object.Object, bool) {
+		if closed {
+			return nil, false
+		}
+		if scanner.Scan() {
+			return &object.String{Value: scanner.Text()}, true
+		}
+		closeFile()
+		if err := scanner.Err(); err != nil {
+			return newError("could not read file: %s", err.Error()), true
+		}
+		return nil, false
+	}
+	return &object.Iterator{Name: "lines " + file.Name(), Next: next, Close: closeFile}
 }
 
 // createSocketObject creates a socket object for TCP connections
@@ -108,6 +155,21 @@ func RegisterBuiltinModules() {
 					return &object.String{Value: string(content)}
 				},
 			},
+			"readLines": &object.Builtin{
+				Fn: func(args ...object.Object) object.Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+					if args[0].Type() != object.STRING_OBJ {
+						return newError("argument to `readLines` must be STRING, got %s", args[0].Type())
+					}
+					file, err := os.Open(args[0].(*object.String).Value)
+					if err != nil {
+						return newError("could not read file: %s", err.Error())
+					}
+					return lineIterator(file)
+				},
+			},
 			"writeFile": &object.Builtin{
 				Fn: func(args ...object.Object) object.Object {
 					if len(args) != 2 {
@@ -222,20 +284,20 @@ func RegisterBuiltinModules() {
 						return newError("could not stat file: %s", err.Error())
 					}
 					// Return a hash with file info
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					nameKey := &object.String{Value: "name"}
-					pairs[nameKey.HashKey()] = object.HashPair{Key: nameKey, Value: &object.String{Value: info.Name()}}
+					pairs.Set(nameKey, nameKey.HashKey(), &object.String{Value: info.Name()})
 					sizeKey := &object.String{Value: "size"}
-					pairs[sizeKey.HashKey()] = object.HashPair{Key: sizeKey, Value: &object.Integer{Value: info.Size()}}
+					pairs.Set(sizeKey, sizeKey.HashKey(), &object.Integer{Value: info.Size()})
 					isDir := FALSE
 					if info.IsDir() {
 						isDir = TRUE
 					}
 					isDirKey := &object.String{Value: "isDir"}
-					pairs[isDirKey.HashKey()] = object.HashPair{Key: isDirKey, Value: isDir}
+					pairs.Set(isDirKey, isDirKey.HashKey(), isDir)
 					modTimeKey := &object.String{Value: "modTime"}
-					pairs[modTimeKey.HashKey()] = object.HashPair{Key: modTimeKey, Value: &object.Integer{Value: info.ModTime().Unix()}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(modTimeKey, modTimeKey.HashKey(), &object.Integer{Value: info.ModTime().Unix()})
+					return pairs
 				},
 			},
 			"rename": &object.Builtin{
@@ -284,15 +346,15 @@ func RegisterBuiltinModules() {
 				Fn: func(args ...object.Object) object.Object {
 					if len(args) == 0 {
 						// Return all environment variables as hash
-						envMap := make(map[object.HashKey]object.HashPair)
+						envMap := object.NewHash()
 						for _, env := range os.Environ() {
 							parts := strings.SplitN(env, "=", 2)
 							if len(parts) == 2 {
 								key := &object.String{Value: parts[0]}
-								envMap[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: parts[1]}}
+								envMap.Set(key, key.HashKey(), &object.String{Value: parts[1]})
 							}
 						}
-						return &object.Hash{Pairs: envMap}
+						return envMap
 					} else if len(args) == 1 {
 						if args[0].Type() != object.STRING_OBJ {
 							return newError("argument to `env` must be STRING")
@@ -356,18 +418,18 @@ func RegisterBuiltinModules() {
 					if err != nil {
 						return newError("could not get current user: %s", err.Error())
 					}
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					usernameKey := &object.String{Value: "username"}
-					pairs[usernameKey.HashKey()] = object.HashPair{Key: usernameKey, Value: &object.String{Value: u.Username}}
+					pairs.Set(usernameKey, usernameKey.HashKey(), &object.String{Value: u.Username})
 					nameKey := &object.String{Value: "name"}
-					pairs[nameKey.HashKey()] = object.HashPair{Key: nameKey, Value: &object.String{Value: u.Name}}
+					pairs.Set(nameKey, nameKey.HashKey(), &object.String{Value: u.Name})
 					homeKey := &object.String{Value: "home"}
-					pairs[homeKey.HashKey()] = object.HashPair{Key: homeKey, Value: &object.String{Value: u.HomeDir}}
+					pairs.Set(homeKey, homeKey.HashKey(), &object.String{Value: u.HomeDir})
 					uidKey := &object.String{Value: "uid"}
-					pairs[uidKey.HashKey()] = object.HashPair{Key: uidKey, Value: &object.String{Value: u.Uid}}
+					pairs.Set(uidKey, uidKey.HashKey(), &object.String{Value: u.Uid})
 					gidKey := &object.String{Value: "gid"}
-					pairs[gidKey.HashKey()] = object.HashPair{Key: gidKey, Value: &object.String{Value: u.Gid}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(gidKey, gidKey.HashKey(), &object.String{Value: u.Gid})
+					return pairs
 				},
 			},
 			"tempDir": &object.Builtin{
@@ -438,14 +500,14 @@ func RegisterBuiltinModules() {
 						return newError("failed to read response: %s", err.Error())
 					}
 					// Return a hash with status, statusCode, and body
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					bodyKey := &object.String{Value: "body"}
-					pairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(body)}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(body)})
+					return pairs
 				},
 			},
 			"post": &object.Builtin{
@@ -477,14 +539,14 @@ func RegisterBuiltinModules() {
 					if err != nil {
 						return newError("failed to read response: %s", err.Error())
 					}
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					bodyKey := &object.String{Value: "body"}
-					pairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(respBody)}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(respBody)})
+					return pairs
 				},
 			},
 			"head": &object.Builtin{
@@ -501,20 +563,16 @@ func RegisterBuiltinModules() {
 						return newError("HTTP HEAD failed: %s", err.Error())
 					}
 					defer resp.Body.Close()
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					// Add headers
 					headersKey := &object.String{Value: "headers"}
-					headerPairs := make(map[object.HashKey]object.HashPair)
-					for key, values := range resp.Header {
-						hKey := &object.String{Value: key}
-						headerPairs[hKey.HashKey()] = object.HashPair{Key: hKey, Value: &object.String{Value: strings.Join(values, ", ")}}
-					}
-					pairs[headersKey.HashKey()] = object.HashPair{Key: headersKey, Value: &object.Hash{Pairs: headerPairs}}
-					return &object.Hash{Pairs: pairs}
+					headerPairs := headerHash(resp.Header, ", ")
+					pairs.Set(headersKey, headersKey.HashKey(), headerPairs)
+					return pairs
 				},
 			},
 			"delete": &object.Builtin{
@@ -540,14 +598,14 @@ func RegisterBuiltinModules() {
 					if err != nil {
 						return newError("failed to read response: %s", err.Error())
 					}
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					bodyKey := &object.String{Value: "body"}
-					pairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(body)}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(body)})
+					return pairs
 				},
 			},
 			"put": &object.Builtin{
@@ -585,14 +643,14 @@ func RegisterBuiltinModules() {
 					if err != nil {
 						return newError("failed to read response: %s", err.Error())
 					}
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					bodyKey := &object.String{Value: "body"}
-					pairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(respBody)}}
-					return &object.Hash{Pairs: pairs}
+					pairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(respBody)})
+					return pairs
 				},
 			},
 			"parseQuery": &object.Builtin{
@@ -605,13 +663,8 @@ func RegisterBuiltinModules() {
 					if err != nil {
 						return newError("failed to parse query: %s", err.Error())
 					}
-					pairs := make(map[object.HashKey]object.HashPair)
-					for key, vals := range values {
-						k := &object.String{Value: key}
-						v := &object.String{Value: strings.Join(vals, ",")}
-						pairs[k.HashKey()] = object.HashPair{Key: k, Value: v}
-					}
-					return &object.Hash{Pairs: pairs}
+					pairs := headerHash(values, ",")
+					return pairs
 				},
 			},
 			"lookupHost": &object.Builtin{
@@ -639,16 +692,16 @@ func RegisterBuiltinModules() {
 					}
 					elements := make([]object.Object, len(ifaces))
 					for i, iface := range ifaces {
-						pairs := make(map[object.HashKey]object.HashPair)
+						pairs := object.NewHash()
 						nameKey := &object.String{Value: "name"}
-						pairs[nameKey.HashKey()] = object.HashPair{Key: nameKey, Value: &object.String{Value: iface.Name}}
+						pairs.Set(nameKey, nameKey.HashKey(), &object.String{Value: iface.Name})
 						indexKey := &object.String{Value: "index"}
-						pairs[indexKey.HashKey()] = object.HashPair{Key: indexKey, Value: &object.Integer{Value: int64(iface.Index)}}
+						pairs.Set(indexKey, indexKey.HashKey(), &object.Integer{Value: int64(iface.Index)})
 						mtuKey := &object.String{Value: "mtu"}
-						pairs[mtuKey.HashKey()] = object.HashPair{Key: mtuKey, Value: &object.Integer{Value: int64(iface.MTU)}}
+						pairs.Set(mtuKey, mtuKey.HashKey(), &object.Integer{Value: int64(iface.MTU)})
 						macKey := &object.String{Value: "mac"}
-						pairs[macKey.HashKey()] = object.HashPair{Key: macKey, Value: &object.String{Value: iface.HardwareAddr.String()}}
-						elements[i] = &object.Hash{Pairs: pairs}
+						pairs.Set(macKey, macKey.HashKey(), &object.String{Value: iface.HardwareAddr.String()})
+						elements[i] = pairs
 					}
 					return &object.Array{Elements: elements}
 				},
@@ -666,7 +719,7 @@ func RegisterBuiltinModules() {
 					}
 					host := args[0].(*object.String).Value
 					port := args[1].(*object.Integer).Value
-					addr := fmt.Sprintf("%s:%d", host, port)
+					addr := net.JoinHostPort(host, fmt.Sprint(port))
 					conn, err := net.Dial("tcp", addr)
 					if err != nil {
 						return newError("failed to connect: %s", err.Error())
@@ -687,7 +740,7 @@ func RegisterBuiltinModules() {
 					}
 					host := args[0].(*object.String).Value
 					port := args[1].(*object.Integer).Value
-					addr := fmt.Sprintf("%s:%d", host, port)
+					addr := net.JoinHostPort(host, fmt.Sprint(port))
 					conn, err := net.Dial("udp", addr)
 					if err != nil {
 						return newError("failed to connect UDP: %s", err.Error())
@@ -763,12 +816,12 @@ func RegisterBuiltinModules() {
 						data := string(buf[:n])
 						remote := remoteAddr.String()
 
-						pairs := make(map[object.HashKey]object.HashPair)
+						pairs := object.NewHash()
 						dataKey := &object.String{Value: "data"}
-						pairs[dataKey.HashKey()] = object.HashPair{Key: dataKey, Value: &object.String{Value: data}}
+						pairs.Set(dataKey, dataKey.HashKey(), &object.String{Value: data})
 						remoteKey := &object.String{Value: "remote"}
-						pairs[remoteKey.HashKey()] = object.HashPair{Key: remoteKey, Value: &object.String{Value: remote}}
-						packetObj := &object.Hash{Pairs: pairs}
+						pairs.Set(remoteKey, remoteKey.HashKey(), &object.String{Value: remote})
+						packetObj := pairs
 
 						if fn, ok := handler.(*object.Function); ok {
 							env := extendFunctionEnv(fn, []object.Object{packetObj})
@@ -798,7 +851,7 @@ func RegisterBuiltinModules() {
 
 					if len(args) > 3 && args[3].Type() == object.HASH_OBJ {
 						headers := args[3].(*object.Hash)
-						for _, pair := range headers.Pairs {
+						for _, pair := range headers.Pairs() {
 							req.Header.Set(pair.Key.Inspect(), pair.Value.Inspect())
 						}
 					}
@@ -811,24 +864,19 @@ func RegisterBuiltinModules() {
 					defer resp.Body.Close()
 
 					respBody, _ := io.ReadAll(resp.Body)
-					pairs := make(map[object.HashKey]object.HashPair)
+					pairs := object.NewHash()
 					statusKey := &object.String{Value: "status"}
-					pairs[statusKey.HashKey()] = object.HashPair{Key: statusKey, Value: &object.String{Value: resp.Status}}
+					pairs.Set(statusKey, statusKey.HashKey(), &object.String{Value: resp.Status})
 					statusCodeKey := &object.String{Value: "statusCode"}
-					pairs[statusCodeKey.HashKey()] = object.HashPair{Key: statusCodeKey, Value: &object.Integer{Value: int64(resp.StatusCode)}}
+					pairs.Set(statusCodeKey, statusCodeKey.HashKey(), &object.Integer{Value: int64(resp.StatusCode)})
 					bodyKey := &object.String{Value: "body"}
-					pairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(respBody)}}
+					pairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(respBody)})
 
-					headerPairs := make(map[object.HashKey]object.HashPair)
-					for k, v := range resp.Header {
-						hk := &object.String{Value: k}
-						hv := &object.String{Value: strings.Join(v, ",")}
-						headerPairs[hk.HashKey()] = object.HashPair{Key: hk, Value: hv}
-					}
+					headerPairs := headerHash(resp.Header, ",")
 					headersKey := &object.String{Value: "headers"}
-					pairs[headersKey.HashKey()] = object.HashPair{Key: headersKey, Value: &object.Hash{Pairs: headerPairs}}
+					pairs.Set(headersKey, headersKey.HashKey(), headerPairs)
 
-					return &object.Hash{Pairs: pairs}
+					return pairs
 				},
 			},
 			"listen": &object.Builtin{
@@ -844,32 +892,28 @@ func RegisterBuiltinModules() {
 
 					http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 						// Build request object
-						reqPairs := make(map[object.HashKey]object.HashPair)
+						reqPairs := object.NewHash()
 
 						methodKey := &object.String{Value: "method"}
-						reqPairs[methodKey.HashKey()] = object.HashPair{Key: methodKey, Value: &object.String{Value: r.Method}}
+						reqPairs.Set(methodKey, methodKey.HashKey(), &object.String{Value: r.Method})
 
 						pathKey := &object.String{Value: "path"}
-						reqPairs[pathKey.HashKey()] = object.HashPair{Key: pathKey, Value: &object.String{Value: r.URL.Path}}
+						reqPairs.Set(pathKey, pathKey.HashKey(), &object.String{Value: r.URL.Path})
 
 						queryKey := &object.String{Value: "query"}
-						reqPairs[queryKey.HashKey()] = object.HashPair{Key: queryKey, Value: &object.String{Value: r.URL.RawQuery}}
+						reqPairs.Set(queryKey, queryKey.HashKey(), &object.String{Value: r.URL.RawQuery})
 
 						// Headers
-						headerPairs := make(map[object.HashKey]object.HashPair)
-						for key, values := range r.Header {
-							hKey := &object.String{Value: key}
-							headerPairs[hKey.HashKey()] = object.HashPair{Key: hKey, Value: &object.String{Value: strings.Join(values, ", ")}}
-						}
+						headerPairs := headerHash(r.Header, ", ")
 						headersKey := &object.String{Value: "headers"}
-						reqPairs[headersKey.HashKey()] = object.HashPair{Key: headersKey, Value: &object.Hash{Pairs: headerPairs}}
+						reqPairs.Set(headersKey, headersKey.HashKey(), headerPairs)
 
 						// Body
 						body, _ := io.ReadAll(r.Body)
 						bodyKey := &object.String{Value: "body"}
-						reqPairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(body)}}
+						reqPairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(body)})
 
-						reqObj := &object.Hash{Pairs: reqPairs}
+						reqObj := reqPairs
 
 						// Call handler
 						var result object.Object
@@ -889,7 +933,7 @@ func RegisterBuiltinModules() {
 								_, _ = w.Write([]byte(res.Value))
 							case *object.Hash:
 								// Check for status, headers, body
-								for _, pair := range res.Pairs {
+								for _, pair := range res.Pairs() {
 									if keyStr, ok := pair.Key.(*object.String); ok {
 										switch keyStr.Value {
 										case "status":
@@ -898,7 +942,7 @@ func RegisterBuiltinModules() {
 											}
 										case "headers":
 											if headersHash, ok := pair.Value.(*object.Hash); ok {
-												for _, hPair := range headersHash.Pairs {
+												for _, hPair := range headersHash.Pairs() {
 													if hKey, ok := hPair.Key.(*object.String); ok {
 														if hVal, ok := hPair.Value.(*object.String); ok {
 															w.Header().Set(hKey.Value, hVal.Value)
@@ -942,25 +986,25 @@ func RegisterBuiltinModules() {
 					routes := args[1].(*object.Hash)
 
 					mux := http.NewServeMux()
-					for _, pair := range routes.Pairs {
+					for _, pair := range routes.Pairs() {
 						path := pair.Key.Inspect()
 						handler := pair.Value
 
 						mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 							// Build request object
-							reqPairs := make(map[object.HashKey]object.HashPair)
+							reqPairs := object.NewHash()
 							methodKey := &object.String{Value: "method"}
-							reqPairs[methodKey.HashKey()] = object.HashPair{Key: methodKey, Value: &object.String{Value: r.Method}}
+							reqPairs.Set(methodKey, methodKey.HashKey(), &object.String{Value: r.Method})
 							pathKey := &object.String{Value: "path"}
-							reqPairs[pathKey.HashKey()] = object.HashPair{Key: pathKey, Value: &object.String{Value: r.URL.Path}}
+							reqPairs.Set(pathKey, pathKey.HashKey(), &object.String{Value: r.URL.Path})
 							queryKey := &object.String{Value: "query"}
-							reqPairs[queryKey.HashKey()] = object.HashPair{Key: queryKey, Value: &object.String{Value: r.URL.RawQuery}}
+							reqPairs.Set(queryKey, queryKey.HashKey(), &object.String{Value: r.URL.RawQuery})
 
 							body, _ := io.ReadAll(r.Body)
 							bodyKey := &object.String{Value: "body"}
-							reqPairs[bodyKey.HashKey()] = object.HashPair{Key: bodyKey, Value: &object.String{Value: string(body)}}
+							reqPairs.Set(bodyKey, bodyKey.HashKey(), &object.String{Value: string(body)})
 
-							reqObj := &object.Hash{Pairs: reqPairs}
+							reqObj := reqPairs
 
 							var result object.Object
 							if fn, ok := handler.(*object.Function); ok {
@@ -976,7 +1020,7 @@ func RegisterBuiltinModules() {
 								case *object.String:
 									w.Write([]byte(res.Value))
 								case *object.Hash:
-									for _, p := range res.Pairs {
+									for _, p := range res.Pairs() {
 										k := p.Key.Inspect()
 										if k == "status" {
 											if si, ok := p.Value.(*object.Integer); ok {
@@ -986,7 +1030,7 @@ func RegisterBuiltinModules() {
 											w.Write([]byte(p.Value.Inspect()))
 										} else if k == "headers" {
 											if hh, ok := p.Value.(*object.Hash); ok {
-												for _, hp := range hh.Pairs {
+												for _, hp := range hh.Pairs() {
 													w.Header().Set(hp.Key.Inspect(), hp.Value.Inspect())
 												}
 											}
@@ -1047,6 +1091,8 @@ func RegisterBuiltinModules() {
 							return &object.Integer{Value: -arg.Value}
 						}
 						return arg
+					case *object.BigInteger:
+						return object.NewBigInteger(new(big.Int).Abs(arg.Value))
 					case *object.Float:
 						return &object.Float{Value: math.Abs(arg.Value)}
 					default:
@@ -1561,6 +1607,8 @@ func getNumericValue(obj object.Object) *float64 {
 	case *object.Integer:
 		val := float64(o.Value)
 		return &val
+	case *object.BigInteger:
+		return &bigToFloat(o).Value
 	case *object.Float:
 		return &o.Value
 	default:
@@ -1570,14 +1618,65 @@ func getNumericValue(obj object.Object) *float64 {
 
 // parseJSON converts a JSON string to Victoria objects
 func parseJSON(jsonStr string) object.Object {
-	var data interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
+	// Decode numbers as json.Number so large integers keep their precision
+	decoder := json.NewDecoder(strings.NewReader(jsonStr))
+	decoder.UseNumber()
+	result, err := decodeJSONValue(decoder)
+	if err != nil {
 		return newError("failed to parse JSON: %s", err.Error())
 	}
-	return jsonToObject(data)
+	if _, err := decoder.Token(); err != io.EOF {
+		return newError("failed to parse JSON: invalid character after top-level value")
+	}
+	return result
 }
 
-// jsonToObject converts a Go interface{} to Victoria object
+// decodeJSONValue reads one value from the token stream, keeping object
+// members in document order
+func decodeJSONValue(decoder *json.Decoder) (object.Object, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return jsonToObject(tok), nil
+	}
+	switch delim {
+	case '[':
+		elements := []object.Object{}
+		for decoder.More() {
+			elem, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, elem)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return &object.Array{Elements: elements}, nil
+	default:
+		pairs := object.NewHash()
+		for decoder.More() {
+			keyTok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			pairs.SetString(keyTok.(string), val)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return pairs, nil
+	}
+}
+
+// jsonToObject converts a scalar JSON token to a Victoria object
 func jsonToObject(data interface{}) object.Object {
 	if data == nil {
 		return NULL
@@ -1593,22 +1692,23 @@ func jsonToObject(data interface{}) object.Object {
 			return &object.Integer{Value: int64(v)}
 		}
 		return &object.Float{Value: v}
-	case string:
-		return &object.String{Value: v}
-	case []interface{}:
-		elements := make([]object.Object, len(v))
-		for i, elem := range v {
-			elements[i] = jsonToObject(elem)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &object.Integer{Value: i}
 		}
-		return &object.Array{Elements: elements}
-	case map[string]interface{}:
-		pairs := make(map[object.HashKey]object.HashPair)
-		for key, val := range v {
-			keyObj := &object.String{Value: key}
-			valObj := jsonToObject(val)
-			pairs[keyObj.HashKey()] = object.HashPair{Key: keyObj, Value: valObj}
+		if b, ok := new(big.Int).SetString(string(v), 10); ok {
+			return object.NewBigInteger(b)
 		}
-		return &object.Hash{Pairs: pairs}
+		f, err := v.Float64()
+		if err != nil {
+			return newError("invalid JSON number: %s", v)
+		}
+		if f == float64(int64(f)) {
+			return &object.Integer{Value: int64(f)}
+		}
+		return &object.Float{Value: f}
+	case string:
+		return &object.String{Value: v}
 	default:
 		return newError("unsupported JSON type: %T", v)
 	}
@@ -1635,6 +1735,8 @@ func objectToGo(obj object.Object) interface{} {
 	switch o := obj.(type) {
 	case *object.Integer:
 		return o.Value
+	case *object.BigInteger:
+		return json.Number(o.Value.String())
 	case *object.Float:
 		return o.Value
 	case *object.Boolean:
@@ -1649,11 +1751,17 @@ func objectToGo(obj object.Object) interface{} {
 			result[i] = objectToGo(elem)
 		}
 		return result
+	case *object.Set:
+		elements := o.Elements()
+		result := make([]interface{}, len(elements))
+		for i, elem := range elements {
+			result[i] = objectToGo(elem)
+		}
+		return result
 	case *object.Hash:
-		result := make(map[string]interface{})
-		for _, pair := range o.Pairs {
-			key := pair.Key.Inspect()
-			result[key] = objectToGo(pair.Value)
+		result := make(jsonObject, 0, o.Len())
+		for _, pair := range o.Pairs() {
+			result = append(result, jsonMember{Key: pair.Key.Inspect(), Value: objectToGo(pair.Value)})
 		}
 		return result
 	default:
@@ -1661,6 +1769,37 @@ func objectToGo(obj object.Object) interface{} {
 	}
 }
 
+// jsonObject is a JSON object that marshals its members in order
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out strings.Builder
+	out.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return []byte(out.String()), nil
+}
+
 // convertTimeFormat converts common format tokens to Go's time format
 func convertTimeFormat(format string) string {
 	replacements := map[string]string{
@@ -1724,6 +1863,16 @@ func findModuleFile(name string) (string, bool) {
 	return "", false
 }
 
+// defines are the command-line defines (-D NAME=value) of the current run.
+// Every file an include loads is lexed with them, so #if DEBUG in a shared
+// helper agrees with the file that was run.
+var defines map[string]string
+
+// SetDefines sets the defines applied to included files; nil clears them
+func SetDefines(d map[string]string) {
+	defines = d
+}
+
 // evalIncludeStatement handles include statements for modules and files
 func evalIncludeStatement(node *ast.IncludeStatement, env *object.Environment) object.Object {
 	for _, moduleName := range node.Modules {
@@ -1743,6 +1892,9 @@ func evalIncludeStatement(node *ast.IncludeStatement, env *object.Environment) o
 			}
 
 			l := lexer.New(string(content))
+			for name, value := range defines {
+				l.Define(name, value)
+			}
 			p := parser.New(l)
 			program := p.ParseProgram()
 
@@ -1753,6 +1905,10 @@ func evalIncludeStatement(node *ast.IncludeStatement, env *object.Environment) o
 				}
 				return newError(msg)
 			}
+			if tracer != nil {
+				absPath, _ := filepath.Abs(filename)
+				tracer.Program(absPath, string(content), program)
+			}
 
 			// Create a new environment for the module to isolate it
 			moduleEnv := object.NewEnvironment()
@@ -0,0 +1,130 @@
+package evaluator
+
+import "victoria/object"
+
+// operatorMethods maps infix operators to the struct methods that overload them
+var operatorMethods = map[string]string{
+	"+":  "__add",
+	"-":  "__sub",
+	"*":  "__mul",
+	"/":  "__div",
+	"%":  "__mod",
+	"**": "__pow",
+	"==": "__eq",
+	"!=": "__eq",
+	"<":  "__lt",
+}
+
+func init() {
+	object.StringMethod = func(instance *object.StructInstance) (string, bool) {
+		result, ok := callStructMethod(instance, "__str")
+		if !ok {
+			return "", false
+		}
+		str, ok := result.(*object.String)
+		if !ok {
+			return "", false
+		}
+		return str.Value, true
+	}
+}
+
+// structMethod returns the named method of instance's struct with self bound
+func structMethod(instance *object.StructInstance, name string) (*object.Function, bool) {
+	fn, ok := instance.Struct.Methods[name]
+	if !ok {
+		return nil, false
+	}
+	closureEnv := object.NewEnclosedEnvironment(fn.Env)
+	closureEnv.Set("self", instance)
+	return &object.Function{Parameters: fn.Parameters, Env: closureEnv, Body: fn.Body, IsGenerator: fn.IsGenerator}, true
+}
+
+// callStructMethod calls a method on obj if it is a struct instance that
+// defines it, and reports whether the method was found
+func callStructMethod(obj object.Object, name string, args ...object.Object) (object.Object, bool) {
+	instance, ok := obj.(*object.StructInstance)
+	if !ok {
+		return nil, false
+	}
+	method, ok := structMethod(instance, name)
+	if !ok {
+		return nil, false
+	}
+	return applyFunction(method, args), true
+}
+
+// evalOperatorMethod dispatches an infix operator to the left operand's
+// overloading method. == and != also try the right operand, and a > b is
+// evaluated as b < a when b defines __lt.
+func evalOperatorMethod(operator string, left, right object.Object) (object.Object, bool) {
+	if operator == ">" {
+		operator, left, right = "<", right, left
+	}
+
+	name, ok := operatorMethods[operator]
+	if !ok {
+		return nil, false
+	}
+
+	result, ok := callStructMethod(left, name, right)
+	if !ok && name == "__eq" {
+		result, ok = callStructMethod(right, name, left)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	if name == "__eq" || name == "__lt" {
+		if isError(result) {
+			return result, true
+		}
+		truth := isTruthy(result)
+		if operator == "!=" {
+			truth = !truth
+		}
+		return nativeBoolToBooleanObject(truth), true
+	}
+	return result, true
+}
+
+// evalLenMethod returns the length of a struct instance through its __len method
+func evalLenMethod(instance *object.StructInstance) object.Object {
+	result, ok := callStructMethod(instance, "__len")
+	if !ok {
+		return newError("argument to `len` not supported, got %s: define %s.__len()", instance.Struct.Name, instance.Struct.Name)
+	}
+	if isError(result) {
+		return result
+	}
+	if _, ok := result.(*object.Integer); !ok {
+		return newError("%s.__len must return an int, got %s", instance.Struct.Name, object.TypeName(result))
+	}
+	return result
+}
+
+// iterableOf returns the value a for-in loop iterates over. Struct instances
+// provide it through their __iter method, or are iterators themselves when
+// they define next().
+func iterableOf(obj object.Object) object.Object {
+	instance, ok := obj.(*object.StructInstance)
+	if !ok {
+		return obj
+	}
+	if _, ok := instance.Struct.Methods["__iter"]; !ok {
+		if it, ok := structIterator(instance); ok {
+			return it
+		}
+	}
+	result, ok := callStructMethod(instance, "__iter")
+	if !ok {
+		return newError("not iterable: %s: define %s.__iter() or %s.next()", instance.Struct.Name, instance.Struct.Name, instance.Struct.Name)
+	}
+	if iter, ok := result.(*object.StructInstance); ok {
+		if it, ok := structIterator(iter); ok {
+			return it
+		}
+		return newError("%s.__iter must return an array, hash, set, string, range or iterator, got %s", instance.Struct.Name, object.TypeName(result))
+	}
+	return result
+}
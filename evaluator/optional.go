@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+	"victoria/ast"
+	"victoria/object"
+)
+
+// evalOptionalIndex evaluates a?.[i]: null when a is null or i is outside
+// the array, string or range, and an ordinary index expression otherwise
+func evalOptionalIndex(left, index object.Object) object.Object {
+	if left == NULL {
+		return NULL
+	}
+
+	if length, ok := sequenceLength(left); ok {
+		switch n := index.(type) {
+		case *object.Integer:
+			if n.Value >= length || n.Value < -length {
+				return NULL
+			}
+		case *object.BigInteger:
+			return NULL
+		}
+	}
+
+	return evalIndexExpression(left, index)
+}
+
+// isOptionalCall reports whether callee is a?.b, so that a?.b() is null
+// rather than a call of null when a is null or has no b
+func isOptionalCall(callee ast.Expression) bool {
+	dot, ok := callee.(*ast.InfixExpression)
+	return ok && dot.Operator == "?."
+}
@@ -0,0 +1,134 @@
+package evaluator
+
+import (
+	"victoria/ast"
+	"victoria/object"
+)
+
+func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	start := Eval(node.Start, env)
+	if isError(start) {
+		return start
+	}
+
+	end := Eval(node.End, env)
+	if isError(end) {
+		return end
+	}
+
+	r := &object.Range{Inclusive: node.Inclusive}
+
+	switch startVal := start.(type) {
+	case *object.Integer:
+		endInt, ok := end.(*object.Integer)
+		if !ok {
+			return newError("range end must be an integer, got %s", end.Type())
+		}
+		r.Start, r.End = startVal.Value, endInt.Value
+	case *object.Char:
+		endChar, ok := end.(*object.Char)
+		if !ok {
+			return newError("range end must be a char to match the start, got %s", end.Type())
+		}
+		r.Start, r.End, r.IsChar = int64(startVal.Value), int64(endChar.Value), true
+	default:
+		return newError("range start must be an integer or char, got %s", start.Type())
+	}
+
+	if node.Step != nil {
+		step := Eval(node.Step, env)
+		if isError(step) {
+			return step
+		}
+		stepInt, ok := step.(*object.Integer)
+		if !ok {
+			return newError("range step must be an integer, got %s", step.Type())
+		}
+		if stepInt.Value == 0 {
+			return newError("range step cannot be zero")
+		}
+		r.Step = stepInt.Value
+	}
+
+	return r
+}
+
+// rangeValue converts v to the int64 a range of ints or chars would hold
+func rangeValue(r *object.Range, v object.Object) (int64, bool) {
+	if r.IsChar {
+		c, ok := v.(*object.Char)
+		if !ok {
+			return 0, false
+		}
+		return int64(c.Value), true
+	}
+	n, ok := v.(*object.Integer)
+	if !ok {
+		return 0, false
+	}
+	return n.Value, true
+}
+
+// rangeContains reports whether v is one of the elements of r, without
+// walking the range
+func rangeContains(r *object.Range, v object.Object) bool {
+	n, ok := rangeValue(r, v)
+	return ok && r.IndexOf(n) >= 0
+}
+
+func evalRangeIndexExpression(r *object.Range, index object.Object) object.Object {
+	idx, errObj := resolveIndex(index.(*object.Integer).Value, r.Len())
+	if errObj != nil {
+		return errObj
+	}
+
+	return r.Element(idx)
+}
+
+// rangeIterator produces the elements of r one at a time
+func rangeIterator(r *object.Range) *object.Iterator {
+	length := r.Len()
+	i := int64(0)
+	next := func() (object.Object, bool) {
+		if i >= length {
+			return nil, false
+		}
+		elem := r.Element(i)
+		i++
+		return elem, true
+	}
+	return &object.Iterator{Name: "range", Next: next}
+}
+
+// rangeElements materialises r, for consumers that need every element
+func rangeElements(r *object.Range) []object.Object {
+	length := r.Len()
+	var elements []object.Object
+	for i := int64(0); i < length; i++ {
+		elements = append(elements, r.Element(i))
+	}
+	return elements
+}
+
+// rangeMethod returns the method name bound to r, for calls like r.contains(x)
+func rangeMethod(r *object.Range, name string) object.Object {
+	switch name {
+	case "contains":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments to `contains`. got=%d, want=1", len(args))
+			}
+			return nativeBoolToBooleanObject(rangeContains(r, args[0]))
+		}}
+
+	case "reversed":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments to `reversed`. got=%d, want=0", len(args))
+			}
+			return r.Reversed()
+		}}
+	}
+
+	return newError("range has no method %s", name)
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"victoria/ast"
+	"victoria/object"
+)
+
+func evalSetLiteral(node *ast.SetLiteral, env *object.Environment) object.Object {
+	elements := evalArrayElements(node.Elements, env)
+	if len(elements) == 1 && isError(elements[0]) {
+		return elements[0]
+	}
+	return newSetFrom(elements)
+}
+
+// newSetFrom builds a set from elements, dropping duplicates
+func newSetFrom(elements []object.Object) object.Object {
+	set := object.NewSet()
+	for _, elem := range elements {
+		key, ok := object.HashKeyOf(elem)
+		if !ok {
+			return newError("unusable as set element: %s", elem.Type())
+		}
+		set.Add(elem, key)
+	}
+	return set
+}
+
+// setMethod returns the method name bound to set, for calls like s.add(x)
+func setMethod(set *object.Set, name string) object.Object {
+	switch name {
+	case "add", "remove", "has":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments to `%s`. got=%d, want=1", name, len(args))
+			}
+			key, ok := object.HashKeyOf(args[0])
+			if !ok {
+				return newError("unusable as set element: %s", args[0].Type())
+			}
+			switch name {
+			case "add":
+				return nativeBoolToBooleanObject(set.Add(args[0], key))
+			case "remove":
+				return nativeBoolToBooleanObject(set.Remove(args[0], key))
+			default:
+				return nativeBoolToBooleanObject(set.Has(args[0], key))
+			}
+		}}
+
+	case "union", "intersection", "difference", "isSubset":
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments to `%s`. got=%d, want=1", name, len(args))
+			}
+			other, ok := args[0].(*object.Set)
+			if !ok {
+				return newError("argument to `%s` must be SET, got %s", name, args[0].Type())
+			}
+			return setAlgebra(name, set, other)
+		}}
+	}
+
+	return newError("set has no method %s", name)
+}
+
+func setAlgebra(name string, left, right *object.Set) object.Object {
+	result := object.NewSet()
+
+	switch name {
+	case "union":
+		for _, elem := range left.Elements() {
+			key, _ := object.HashKeyOf(elem)
+			result.Add(elem, key)
+		}
+		for _, elem := range right.Elements() {
+			key, _ := object.HashKeyOf(elem)
+			result.Add(elem, key)
+		}
+	case "intersection", "difference":
+		keep := name == "intersection"
+		for _, elem := range left.Elements() {
+			key, _ := object.HashKeyOf(elem)
+			if right.Has(elem, key) == keep {
+				result.Add(elem, key)
+			}
+		}
+	case "isSubset":
+		for _, elem := range left.Elements() {
+			key, _ := object.HashKeyOf(elem)
+			if !right.Has(elem, key) {
+				return FALSE
+			}
+		}
+		return TRUE
+	}
+
+	return result
+}
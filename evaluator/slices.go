@@ -0,0 +1,268 @@
+package evaluator
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"victoria/ast"
+	"victoria/object"
+)
+
+// resolveIndex converts an index that may count from the end (-1 is the last
+// element) into a position within a sequence of the given length
+func resolveIndex(idx, length int64) (int64, *object.Error) {
+	if idx < 0 {
+		if idx < -length {
+			return 0, newError("negative index %d is out of range for length %d", idx, length)
+		}
+		return idx + length, nil
+	}
+	if idx >= length {
+		return 0, newError("index out of bounds: index is %d but length is %d", idx, length)
+	}
+	return idx, nil
+}
+
+// sequenceLength returns the number of elements of an array, string or
+// range, the values that take integer indices
+func sequenceLength(obj object.Object) (int64, bool) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return int64(len(obj.Elements)), true
+	case *object.String:
+		return int64(utf8.RuneCountInString(obj.Value)), true
+	case *object.Range:
+		return obj.Len(), true
+	}
+	return 0, false
+}
+
+// bigIndexError reports a promoted big integer used as an index. It does not
+// fit in an int64, so it is out of range for any sequence.
+func bigIndexError(idx *object.BigInteger, length int64) *object.Error {
+	if idx.Value.Sign() < 0 {
+		return newError("negative index %s is out of range for length %d", idx.Value, length)
+	}
+	return newError("index out of bounds: index is %s but length is %d", idx.Value, length)
+}
+
+// sliceInteger returns a slice bound or step as an int64. A big integer is
+// clamped to the int64 range, which already lies beyond every sequence.
+func sliceInteger(obj object.Object) (int64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, true
+	case *object.BigInteger:
+		if obj.Value.Sign() < 0 {
+			return math.MinInt64 + 1, true
+		}
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// sliceSpec is a slice resolved against a sequence: the position of the first
+// selected element, the distance between selected elements and their count
+type sliceSpec struct {
+	start, step, count int64
+}
+
+func (s sliceSpec) index(i int64) int64 {
+	return s.start + i*s.step
+}
+
+// evalSliceSpec evaluates the bounds of a slice over a sequence of the given
+// length the way Python does: negative indices count from the end, bounds are
+// clamped to the sequence, and a negative step walks backwards from the end.
+func evalSliceSpec(node *ast.SliceExpression, env *object.Environment, length int64) (sliceSpec, object.Object) {
+	step := int64(1)
+	if node.Step != nil {
+		stepVal := Eval(node.Step, env)
+		if isError(stepVal) {
+			return sliceSpec{}, stepVal
+		}
+		var ok bool
+		if step, ok = sliceInteger(stepVal); !ok {
+			return sliceSpec{}, newError("slice step must be an integer, got %s", stepVal.Type())
+		}
+		if step == 0 {
+			return sliceSpec{}, newError("slice step cannot be zero")
+		}
+	}
+
+	// lower and upper are the furthest positions a bound may take
+	lower, upper := int64(0), length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+
+	bound := func(expr ast.Expression, missing int64) (int64, object.Object) {
+		if expr == nil {
+			return missing, nil
+		}
+		val := Eval(expr, env)
+		if isError(val) {
+			return 0, val
+		}
+		idx, ok := sliceInteger(val)
+		if !ok {
+			return 0, newError("slice index must be an integer, got %s", val.Type())
+		}
+		if idx < 0 {
+			idx += length
+			if idx < lower {
+				idx = lower
+			}
+		} else if idx > upper {
+			idx = upper
+		}
+		return idx, nil
+	}
+
+	// A missing start begins at the first element in the direction of the
+	// step and a missing end runs past the last one
+	defaultStart, defaultEnd := lower, upper
+	if step < 0 {
+		defaultStart, defaultEnd = upper, lower
+	}
+
+	start, errObj := bound(node.Start, defaultStart)
+	if errObj != nil {
+		return sliceSpec{}, errObj
+	}
+	end, errObj := bound(node.End, defaultEnd)
+	if errObj != nil {
+		return sliceSpec{}, errObj
+	}
+
+	spec := sliceSpec{start: start, step: step}
+	if step > 0 && start < end {
+		spec.count = (end-start-1)/step + 1
+	} else if step < 0 && end < start {
+		spec.count = (start-end-1)/(-step) + 1
+	}
+	return spec, nil
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if node.Optional && left == NULL {
+		return NULL
+	}
+
+	switch obj := left.(type) {
+	case *object.Array:
+		spec, errObj := evalSliceSpec(node, env, int64(len(obj.Elements)))
+		if errObj != nil {
+			return errObj
+		}
+		elements := make([]object.Object, spec.count)
+		for i := range elements {
+			elements[i] = obj.Elements[spec.index(int64(i))]
+		}
+		return &object.Array{Elements: elements}
+
+	case *object.String:
+		// Strings are sliced by code point so a multi-byte character is
+		// never cut in half
+		runes := []rune(obj.Value)
+		spec, errObj := evalSliceSpec(node, env, int64(len(runes)))
+		if errObj != nil {
+			return errObj
+		}
+		sliced := make([]rune, spec.count)
+		for i := range sliced {
+			sliced[i] = runes[spec.index(int64(i))]
+		}
+		return &object.String{Value: string(sliced)}
+
+	case *object.Range:
+		spec, errObj := evalSliceSpec(node, env, obj.Len())
+		if errObj != nil {
+			return errObj
+		}
+		return obj.Slice(spec.start, spec.step, spec.count)
+
+	default:
+		return newError("slice operator not supported for: %s", left.Type())
+	}
+}
+
+// evalSliceAssignment replaces the elements of an array selected by a slice.
+// A plain slice may be replaced by any number of elements, growing or
+// shrinking the array; a stepped slice needs exactly as many as it selects.
+// Errors without a position of their own point at the slice.
+func evalSliceAssignment(node *ast.SliceExpression, rightNode ast.Expression, operator string, env *object.Environment) object.Object {
+	result := assignSlice(node, rightNode, operator, env)
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+		errObj.Line = node.Token.Line
+		errObj.Column = node.Token.Column
+		errObj.EndColumn = node.Token.EndColumn
+	}
+	return result
+}
+
+// assignSlice does the work of evalSliceAssignment
+func assignSlice(node *ast.SliceExpression, rightNode ast.Expression, operator string, env *object.Environment) object.Object {
+	if operator != "=" {
+		return newError("operator %s is not supported on a slice; use =", operator)
+	}
+
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	arr, ok := left.(*object.Array)
+	if !ok {
+		if left.Type() == object.STRING_OBJ {
+			return newError("cannot assign to a slice of a string: strings are immutable")
+		}
+		return newError("slice assignment not supported for: %s", left.Type())
+	}
+
+	spec, errObj := evalSliceSpec(node, env, int64(len(arr.Elements)))
+	if errObj != nil {
+		return errObj
+	}
+
+	val := Eval(rightNode, env)
+	if isError(val) {
+		return val
+	}
+
+	var replacement []object.Object
+	switch val := val.(type) {
+	case *object.Array:
+		replacement = append(replacement, val.Elements...)
+	case *object.Range:
+		replacement = rangeElements(val)
+	default:
+		return newError("can only assign an array to a slice, got %s", val.Type())
+	}
+
+	if arr.Frozen() {
+		return newError("cannot modify array %s: it is used as a hash key", arr.Inspect())
+	}
+
+	if spec.step == 1 {
+		end := spec.start + spec.count
+		elements := make([]object.Object, 0, int64(len(arr.Elements))-spec.count+int64(len(replacement)))
+		elements = append(elements, arr.Elements[:spec.start]...)
+		elements = append(elements, replacement...)
+		elements = append(elements, arr.Elements[end:]...)
+		arr.Elements = elements
+		return val
+	}
+
+	if int64(len(replacement)) != spec.count {
+		return newError("cannot assign %d elements to a stepped slice of %d elements", len(replacement), spec.count)
+	}
+	for i, elem := range replacement {
+		arr.Elements[spec.index(int64(i))] = elem
+	}
+	return val
+}
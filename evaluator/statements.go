@@ -18,17 +18,9 @@ func evalWhileExpression(node *ast.WhileExpression, env *object.Environment) obj
 			break
 		}
 
-		result = Eval(node.Body, env)
-		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result
-			}
-			if result.Type() == object.BREAK_OBJ {
-				break
-			}
-			if result.Type() == object.CONTINUE_OBJ {
-				continue
-			}
+		var stop bool
+		if result, stop = loopControl(Eval(node.Body, env), node.Label); stop {
+			return result
 		}
 	}
 
@@ -40,6 +32,21 @@ func evalForExpression(node *ast.ForExpression, env *object.Environment) object.
 	if isError(iterable) {
 		return iterable
 	}
+	iterable = iterableOf(iterable)
+	if isError(iterable) {
+		return iterable
+	}
+
+	if r, ok := iterable.(*object.Range); ok {
+		iterable = rangeIterator(r)
+	}
+	if it, ok := iterable.(*object.Iterator); ok {
+		return evalIteratorLoop(it, node.Label, func(_ int64, value object.Object) object.Object {
+			loopEnv := object.NewEnclosedEnvironment(env)
+			loopEnv.Set(node.Item.Value, value)
+			return evalBlockStatement(node.Body, loopEnv)
+		})
+	}
 
 	var elements []object.Object
 
@@ -51,13 +58,11 @@ func evalForExpression(node *ast.ForExpression, env *object.Environment) object.
 			elements = append(elements, &object.String{Value: string(char)})
 		}
 	case *object.Hash:
-		for _, pair := range iterable.Pairs {
+		for _, pair := range iterable.Pairs() {
 			elements = append(elements, pair.Key)
 		}
-	case *object.Range:
-		for i := iterable.Start; i < iterable.End; i++ {
-			elements = append(elements, &object.Integer{Value: i})
-		}
+	case *object.Set:
+		elements = iterable.Elements()
 	default:
 		return newError("not iterable: %s", iterable.Type())
 	}
@@ -68,18 +73,9 @@ func evalForExpression(node *ast.ForExpression, env *object.Environment) object.
 		loopEnv := object.NewEnclosedEnvironment(env)
 		loopEnv.Set(node.Item.Value, elem)
 
-		result = evalBlockStatement(node.Body, loopEnv)
-
-		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result
-			}
-			if result.Type() == object.BREAK_OBJ {
-				break
-			}
-			if result.Type() == object.CONTINUE_OBJ {
-				continue
-			}
+		var stop bool
+		if result, stop = loopControl(evalBlockStatement(node.Body, loopEnv), node.Label); stop {
+			return result
 		}
 	}
 
@@ -91,68 +87,67 @@ func evalForInIndexExpression(node *ast.ForInIndexExpression, env *object.Enviro
 	if isError(iterable) {
 		return iterable
 	}
+	iterable = iterableOf(iterable)
+	if isError(iterable) {
+		return iterable
+	}
+
+	if r, ok := iterable.(*object.Range); ok {
+		iterable = rangeIterator(r)
+	}
 
 	var result object.Object = NULL
 
 	switch iterable := iterable.(type) {
+	case *object.Iterator:
+		return evalIteratorLoop(iterable, node.Label, func(i int64, value object.Object) object.Object {
+			loopEnv := object.NewEnclosedEnvironment(env)
+			loopEnv.Set(node.Index.Value, &object.Integer{Value: i})
+			loopEnv.Set(node.Value.Value, value)
+			return evalBlockStatement(node.Body, loopEnv)
+		})
 	case *object.Array:
 		for i, elem := range iterable.Elements {
 			loopEnv := object.NewEnclosedEnvironment(env)
 			loopEnv.Set(node.Index.Value, &object.Integer{Value: int64(i)})
 			loopEnv.Set(node.Value.Value, elem)
 
-			result = evalBlockStatement(node.Body, loopEnv)
-
-			if result != nil {
-				if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-					return result
-				}
-				if result.Type() == object.BREAK_OBJ {
-					break
-				}
-				if result.Type() == object.CONTINUE_OBJ {
-					continue
-				}
+			var stop bool
+			if result, stop = loopControl(evalBlockStatement(node.Body, loopEnv), node.Label); stop {
+				return result
 			}
 		}
 	case *object.Hash:
-		for _, pair := range iterable.Pairs {
+		for _, pair := range iterable.Pairs() {
 			loopEnv := object.NewEnclosedEnvironment(env)
 			loopEnv.Set(node.Index.Value, pair.Key)
 			loopEnv.Set(node.Value.Value, pair.Value)
 
-			result = evalBlockStatement(node.Body, loopEnv)
-
-			if result != nil {
-				if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-					return result
-				}
-				if result.Type() == object.BREAK_OBJ {
-					break
-				}
-				if result.Type() == object.CONTINUE_OBJ {
-					continue
-				}
+			var stop bool
+			if result, stop = loopControl(evalBlockStatement(node.Body, loopEnv), node.Label); stop {
+				return result
 			}
 		}
 	case *object.String:
-		for i, char := range iterable.Value {
+		for i, char := range []rune(iterable.Value) {
 			loopEnv := object.NewEnclosedEnvironment(env)
 			loopEnv.Set(node.Index.Value, &object.Integer{Value: int64(i)})
 			loopEnv.Set(node.Value.Value, &object.String{Value: string(char)})
 
-			result = evalBlockStatement(node.Body, loopEnv)
-
-			if result != nil {
-				if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-					return result
-				}
-				if result.Type() == object.BREAK_OBJ {
-					break
-				}
-				if result.Type() == object.CONTINUE_OBJ {
-					continue
-				}
+			var stop bool
+			if result, stop = loopControl(evalBlockStatement(node.Body, loopEnv), node.Label); stop {
+				return result
+			}
+		}
+	case *object.Set:
+		for i, elem := range iterable.Elements() {
+			loopEnv := object.NewEnclosedEnvironment(env)
+			loopEnv.Set(node.Index.Value, &object.Integer{Value: int64(i)})
+			loopEnv.Set(node.Value.Value, elem)
+
+			var stop bool
+			if result, stop = loopControl(evalBlockStatement(node.Body, loopEnv), node.Label); stop {
+				return result
 			}
 		}
 	default:
@@ -186,19 +181,9 @@ func evalCForExpression(node *ast.CForExpression, env *object.Environment) objec
 		}
 
 		bodyEnv := object.NewEnclosedEnvironment(loopEnv)
-		result = evalBlockStatement(node.Body, bodyEnv)
-
-		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result
-			}
-			if result.Type() == object.BREAK_OBJ {
-				break
-			}
-			if result.Type() == object.CONTINUE_OBJ {
-				// Continue: fall through to update expression
-				_ = result // Explicit no-op to satisfy linter
-			}
+		var stop bool
+		if result, stop = loopControl(evalBlockStatement(node.Body, bodyEnv), node.Label); stop {
+			return result
 		}
 
 		if node.Update != nil {
@@ -218,17 +203,19 @@ func evalSwitchExpression(node *ast.SwitchExpression, env *object.Environment) o
 		return value
 	}
 
-	for _, caseExpr := range node.Cases {
+	for i, caseExpr := range node.Cases {
 		caseValue := Eval(caseExpr.Value, env)
 		if isError(caseValue) {
 			return caseValue
 		}
 
-		if compareObjects(value, caseValue) {
+		if objectsEqual(value, caseValue) {
+			traceBranch(node, i)
 			return Eval(caseExpr.Body, env)
 		}
 	}
 
+	traceBranch(node, len(node.Cases))
 	if node.Default != nil {
 		return Eval(node.Default, env)
 	}
@@ -236,19 +223,25 @@ func evalSwitchExpression(node *ast.SwitchExpression, env *object.Environment) o
 	return NULL
 }
 
-func compareObjects(a, b object.Object) bool {
-	if a.Type() != b.Type() {
-		return false
-	}
-	switch a := a.(type) {
-	case *object.Integer:
-		return a.Value == b.(*object.Integer).Value
-	case *object.String:
-		return a.Value == b.(*object.String).Value
-	case *object.Boolean:
-		return a.Value == b.(*object.Boolean).Value
-	case *object.Float:
-		return a.Value == b.(*object.Float).Value
+// loopControl interprets the result of one pass through the body of the loop
+// named label. It reports whether the loop must stop, and the value to
+// record: a return or error to propagate, a break or continue aimed at an
+// outer loop, null when this loop is broken out of or continued, and
+// otherwise the body's value.
+func loopControl(result object.Object, label string) (object.Object, bool) {
+	switch r := result.(type) {
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	case *object.Break:
+		if r.Label == "" || r.Label == label {
+			return NULL, true
+		}
+		return result, true
+	case *object.Continue:
+		if r.Label == "" || r.Label == label {
+			return NULL, false
+		}
+		return result, true
 	}
-	return a == b
+	return result, false
 }
@@ -0,0 +1,37 @@
+package evaluator
+
+import "victoria/ast"
+
+// Tracer follows a program as it runs; coverage reports are built from one.
+// Program is called for each file that is parsed to be run, including files
+// pulled in with include, Statement before each statement of a program or
+// block runs, and Branch when a decision picks one of its arms.
+//
+// Branch arms are numbered per kind of node: for if and ?: 0 is the true arm
+// and 1 the false arm, even when there is no else; for switch, i is the i-th
+// case and len(Cases) is the default, or no match; for &&, || and ?? 0 means
+// the right side was evaluated and 1 that it was skipped.
+type Tracer interface {
+	Program(filename, source string, program *ast.Program)
+	Statement(stmt ast.Statement)
+	Branch(node ast.Node, arm int)
+}
+
+var tracer Tracer
+
+// SetTracer installs t for the evaluations that follow; nil turns tracing off
+func SetTracer(t Tracer) {
+	tracer = t
+}
+
+func traceStatement(stmt ast.Statement) {
+	if tracer != nil {
+		tracer.Statement(stmt)
+	}
+}
+
+func traceBranch(node ast.Node, arm int) {
+	if tracer != nil {
+		tracer.Branch(node, arm)
+	}
+}
@@ -1,38 +1,58 @@
 package lexer
 
 import (
-	"strings"
+	"unicode"
+	"unicode/utf8"
 	"victoria/token"
 )
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	position     int  // current byte offset in input (points to current char)
+	readPosition int  // current reading byte offset in input (after current char)
+	ch           rune // current char under examination
 	line         int
-	column       int // current column position (1-indexed)
-	lineStart    int // position where current line starts
+	column       int // current column position in characters (1-indexed)
+	lineStart    int // byte offset where current line starts
+
+	// Preprocessor state
+	pending   []token.Token     // tokens ready to be returned by NextToken
+	lookahead []token.Token     // raw tokens read ahead of the preprocessor
+	macros    map[string]*macro // #make and -D definitions
+	defines   map[string]bool   // names defined on the command line (-D)
+	conds     []condFrame       // stack of open #if blocks
+	ppErrors  []DirectiveError  // errors found while preprocessing
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input, line: 1, column: 0, lineStart: 0}
+	l := &Lexer{input: input, line: 1, column: 0, lineStart: 0, macros: make(map[string]*macro), defines: make(map[string]bool)}
 	l.readChar()
 	return l
 }
 
+// readChar advances by one character (Unicode code point). Columns count
+// characters rather than bytes so error underlines line up with the source.
 func (l *Lexer) readChar() {
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
+	} else if l.input[l.readPosition] < utf8.RuneSelf {
+		l.ch = rune(l.input[l.readPosition])
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
-	l.column = l.position - l.lineStart + 1
+	l.readPosition += width
+	if l.position == l.lineStart {
+		l.column = 1
+	} else {
+		l.column++
+	}
 }
 
-func (l *Lexer) NextToken() token.Token {
+// nextRawToken scans the next token from the input without applying
+// preprocessor directives or macro expansion (see preprocessor.go)
+func (l *Lexer) nextRawToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
@@ -97,10 +117,10 @@ func (l *Lexer) NextToken() token.Token {
 	case '/':
 		if l.peekChar() == '/' {
 			l.skipSingleLineComment()
-			return l.NextToken()
+			return l.nextRawToken()
 		} else if l.peekChar() == '*' {
 			l.skipMultiLineComment()
-			return l.NextToken()
+			return l.nextRawToken()
 		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
@@ -110,7 +130,14 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newTokenWithCol(token.SLASH, l.ch, l.line, startCol)
 		}
 	case '*':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '*' && l.peekCharN(2) == '=' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.POWER_ASSIGN, Literal: "**=", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: "**", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
@@ -133,8 +160,13 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.AND_AND, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.BIT_AND_ASSIGN, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
 		} else {
-			tok = newTokenWithCol(token.ILLEGAL, l.ch, l.line, startCol)
+			tok = newTokenWithCol(token.BIT_AND, l.ch, l.line, startCol)
 		}
 	case '|':
 		if l.peekChar() == '|' {
@@ -142,17 +174,56 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.OR_OR, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.BIT_OR_ASSIGN, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
 		} else {
-			tok = newTokenWithCol(token.ILLEGAL, l.ch, l.line, startCol)
+			tok = newTokenWithCol(token.BIT_OR, l.ch, l.line, startCol)
+		}
+	case '^':
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.BIT_XOR_ASSIGN, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else {
+			tok = newTokenWithCol(token.BIT_XOR, l.ch, l.line, startCol)
 		}
+	case '~':
+		tok = newTokenWithCol(token.BIT_NOT, l.ch, l.line, startCol)
+	case '@':
+		tok = newTokenWithCol(token.AT, l.ch, l.line, startCol)
 	case '?':
-		tok = newTokenWithCol(token.QUESTION, l.ch, l.line, startCol)
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.COALESCE, Literal: "??", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '.' && !isDigit(l.peekCharN(2)) {
+			// ?. is optional chaining, but "x ?.5 : 1" is a ternary with a float
+			l.readChar()
+			tok = token.Token{Type: token.QUESTION_DOT, Literal: "?.", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else {
+			tok = newTokenWithCol(token.QUESTION, l.ch, l.line, startCol)
+		}
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.LTE, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '<' && l.peekCharN(2) == '=' {
+			l.readChar() // consume second <
+			l.readChar() // consume =
+			tok = token.Token{Type: token.SHIFT_LEFT_ASSIGN, Literal: "<<=", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
 		} else {
 			tok = newTokenWithCol(token.LT, l.ch, l.line, startCol)
 		}
@@ -162,6 +233,15 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.GTE, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '>' && l.peekCharN(2) == '=' {
+			l.readChar() // consume second >
+			l.readChar() // consume =
+			tok = token.Token{Type: token.SHIFT_RIGHT_ASSIGN, Literal: ">>=", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: literal, Line: l.line, Column: startCol, EndColumn: l.column + 1}
 		} else {
 			tok = newTokenWithCol(token.GT, l.ch, l.line, startCol)
 		}
@@ -177,6 +257,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar() // consume second .
 			l.readChar() // consume third .
 			tok = token.Token{Type: token.SPREAD, Literal: "...", Line: l.line, Column: startCol, EndColumn: l.column + 1}
+		} else if l.peekChar() == '.' && l.peekCharN(2) == '=' {
+			// Inclusive range operator ..=
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.RANGE_INCL, Literal: "..=", Line: l.line, Column: startCol, EndColumn: l.column + 1}
 		} else if l.peekChar() == '.' {
 			// Check if it's a range operator ..
 			ch := l.ch
@@ -186,7 +271,7 @@ func (l *Lexer) NextToken() token.Token {
 		} else if isDigit(l.peekChar()) {
 			// Check if it's a float starting with dot like .5
 			startCol := l.column
-			tok.Literal = l.readNumber()
+			tok.Literal, _ = l.readNumber()
 			tok.Type = token.FLOAT
 			tok.Line = l.line
 			tok.Column = startCol
@@ -221,16 +306,31 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Line = l.line
 		tok.EndColumn = l.column + 1
 	case '#':
-		// Preprocessor directive #make
+		// Preprocessor directives: #make, #if, #else, #endif, and set literals #{
 		startCol := l.column
 		l.readChar() // consume #
 		if isLetter(l.ch) {
 			directive := l.readIdentifier()
-			if directive == "make" {
-				tok = token.Token{Type: token.MAKE, Literal: "#make", Line: l.line, Column: startCol, EndColumn: l.column}
+			var tokType token.TokenType
+			switch directive {
+			case "make":
+				tokType = token.MAKE
+			case "if":
+				tokType = token.PP_IF
+			case "else":
+				tokType = token.PP_ELSE
+			case "endif":
+				tokType = token.PP_ENDIF
+			}
+			if tokType != "" {
+				tok = token.Token{Type: tokType, Literal: "#" + directive, Line: l.line, Column: startCol, EndColumn: l.column}
 				return tok
 			}
 		}
+		if l.ch == '{' {
+			l.readChar()
+			return token.Token{Type: token.SET_LBRACE, Literal: "#{", Line: l.line, Column: startCol, EndColumn: l.column}
+		}
 		tok = newTokenWithCol(token.ILLEGAL, '#', l.line, startCol)
 		return tok
 	case '`':
@@ -256,8 +356,9 @@ func (l *Lexer) NextToken() token.Token {
 			return tok
 		} else if isDigit(l.ch) {
 			startCol := l.column
-			tok.Literal = l.readNumber()
-			if strings.Contains(tok.Literal, ".") {
+			literal, isFloat := l.readNumber()
+			tok.Literal = literal
+			if isFloat {
 				tok.Type = token.FLOAT
 			} else {
 				tok.Type = token.INT
@@ -314,24 +415,53 @@ func (l *Lexer) skipMultiLineComment() {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) || isDigit(l.ch) { // Allow digits in identifiers after first char
+	for isIdentifierPart(l.ch) { // Allow digits in identifiers after first char
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or float literal and reports whether it is a
+// float. Supported forms are decimal (with `_` separators, an optional fraction
+// and exponent) and 0x/0b/0o prefixed integers. The literal keeps its original
+// spelling; malformed digits are left for the parser to report.
+func (l *Lexer) readNumber() (string, bool) {
 	position := l.position
-	for isDigit(l.ch) {
+	isFloat := false
+
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		return l.input[position:l.position], false
+	}
+
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
 	if l.ch == '.' && isDigit(l.peekChar()) {
+		isFloat = true
 		l.readChar()
-		for isDigit(l.ch) {
+		for isDigit(l.ch) || l.ch == '_' {
 			l.readChar()
 		}
 	}
-	return l.input[position:l.position]
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || ((next == '+' || next == '-') && isDigit(l.peekCharN(2))) {
+			isFloat = true
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			for isDigit(l.ch) || l.ch == '_' {
+				l.readChar()
+			}
+		}
+	}
+	return l.input[position:l.position], isFloat
 }
 
 func (l *Lexer) readString() string {
@@ -348,6 +478,44 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+// Unescape resolves the backslash escapes in the raw text of a string
+// literal: \n, \t, \r, \\, \" and \$. Other backslashes are kept.
+func Unescape(s string) string {
+	result := ""
+	i := 0
+	for i < len(s) {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				result += "\n"
+				i += 2
+			case 't':
+				result += "\t"
+				i += 2
+			case 'r':
+				result += "\r"
+				i += 2
+			case '\\':
+				result += "\\"
+				i += 2
+			case '"':
+				result += "\""
+				i += 2
+			case '$':
+				result += "$"
+				i += 2
+			default:
+				result += s[i : i+1]
+				i++
+			}
+		} else {
+			result += s[i : i+1]
+			i++
+		}
+	}
+	return result
+}
+
 func (l *Lexer) readMultiLineString() string {
 	position := l.position + 1
 	for {
@@ -397,34 +565,65 @@ func (l *Lexer) readCharLiteral() string {
 	return result
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter reports whether ch can start an identifier: `_` or any Unicode
+// letter, so names like größe and 名前 are valid
+func isLetter(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	}
+	return unicode.IsLetter(ch)
+}
+
+// isIdentifierPart reports whether ch can continue an identifier. Besides
+// letters and digits this allows combining marks (e.g. a decomposed é).
+func isIdentifierPart(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return isLetter(ch) || isDigit(ch)
+	}
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || unicode.IsMark(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'b', 'B', 'o', 'O':
+		return true
 	}
-	return l.input[l.readPosition]
+	return false
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.peekCharN(1)
 }
 
 // peekCharN peeks n characters ahead (1 = next char, 2 = char after next, etc.)
-func (l *Lexer) peekCharN(n int) byte {
-	pos := l.readPosition + n - 1
+func (l *Lexer) peekCharN(n int) rune {
+	pos := l.readPosition
+	for ; n > 1 && pos < len(l.input); n-- {
+		_, width := utf8.DecodeRuneInString(l.input[pos:])
+		pos += width
+	}
 	if pos >= len(l.input) {
 		return 0
 	}
-	return l.input[pos]
+	if l.input[pos] < utf8.RuneSelf {
+		return rune(l.input[pos])
+	}
+	ch, _ := utf8.DecodeRuneInString(l.input[pos:])
+	return ch
 }
 
-// func newToken(tokenType token.TokenType, ch byte, line int) token.Token {
+// func newToken(tokenType token.TokenType, ch rune, line int) token.Token {
 //	return token.Token{Type: tokenType, Literal: string(ch), Line: line, Column: 1, EndColumn: 2}
 //}
 
-func newTokenWithCol(tokenType token.TokenType, ch byte, line int, col int) token.Token {
+func newTokenWithCol(tokenType token.TokenType, ch rune, line int, col int) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch), Line: line, Column: col, EndColumn: col + 1}
 }
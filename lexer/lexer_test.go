@@ -296,8 +296,202 @@ func TestCompoundAssignment(t *testing.T) {
 	}
 }
 
+func TestBitwiseOperators(t *testing.T) {
+	input := `a & b | c ^ ~d << 1 >> 2; x &= 1; x |= 2; x ^= 3; x <<= 4; x >>= 5; p && q || r`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "c"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "d"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "1"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.BIT_AND_ASSIGN, "&="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.BIT_OR_ASSIGN, "|="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.BIT_XOR_ASSIGN, "^="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SHIFT_LEFT_ASSIGN, "<<="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SHIFT_RIGHT_ASSIGN, ">>="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "p"},
+		{token.AND_AND, "&&"},
+		{token.IDENT, "q"},
+		{token.OR_OR, "||"},
+		{token.IDENT, "r"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	input := `0xFF 0b1010 0o755 1_000_000_007 1e9 2.5e-3 1E+2 3.14 1..5 0x1e`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF"},
+		{token.INT, "0b1010"},
+		{token.INT, "0o755"},
+		{token.INT, "1_000_000_007"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "2.5e-3"},
+		{token.FLOAT, "1E+2"},
+		{token.FLOAT, "3.14"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "5"},
+		{token.INT, "0x1e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestPowerAndFloorDivision(t *testing.T) {
+	input := `2 ** 10; x **= 2; 7 div 2; a * b`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.POWER_ASSIGN, "**="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "7"},
+		{token.DIV, "div"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodeSource(t *testing.T) {
+	input := "let größe = \"日本\"; 名前 + x\nlet é = 'ö'"
+
+	tests := []struct {
+		expectedType      token.TokenType
+		expectedLiteral   string
+		expectedLine      int
+		expectedColumn    int
+		expectedEndColumn int
+	}{
+		{token.LET, "let", 1, 1, 4},
+		{token.IDENT, "größe", 1, 5, 10},
+		{token.ASSIGN, "=", 1, 11, 12},
+		{token.STRING, "日本", 1, 13, 17},
+		{token.SEMICOLON, ";", 1, 17, 18},
+		{token.IDENT, "名前", 1, 19, 21},
+		{token.PLUS, "+", 1, 22, 23},
+		{token.IDENT, "x", 1, 24, 25},
+		{token.LET, "let", 2, 1, 4},
+		{token.IDENT, "é", 2, 5, 6},
+		{token.ASSIGN, "=", 2, 7, 8},
+		{token.CHAR, "ö", 2, 9, 12},
+		{token.EOF, "", 2, 12, 12},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn || tok.EndColumn != tt.expectedEndColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d-%d, got=%d:%d-%d",
+				i, tt.expectedLine, tt.expectedColumn, tt.expectedEndColumn,
+				tok.Line, tok.Column, tok.EndColumn)
+		}
+	}
+}
+
 func TestRangeOperator(t *testing.T) {
-	input := `1..10`
+	input := `1..10 0..=n`
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -306,6 +500,9 @@ func TestRangeOperator(t *testing.T) {
 		{token.INT, "1"},
 		{token.RANGE, ".."},
 		{token.INT, "10"},
+		{token.INT, "0"},
+		{token.RANGE_INCL, "..="},
+		{token.IDENT, "n"},
 		{token.EOF, ""},
 	}
 
@@ -584,3 +781,240 @@ func TestDotOperator(t *testing.T) {
 		}
 	}
 }
+
+func TestFunctionLikeMacro(t *testing.T) {
+	input := `#make SQ(x) ((x)*(x))
+SQ(a + 1)`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LPAREN, "("},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.ASTERISK, "*"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestConditionalDirectives(t *testing.T) {
+	tests := []struct {
+		input    string
+		defines  map[string]string
+		expected []string
+	}{
+		{"#make DEBUG 1\n#if DEBUG\na\n#else\nb\n#endif", nil, []string{"#make", "DEBUG", "1", ";", "a"}},
+		{"#make DEBUG 0\n#if DEBUG\na\n#else\nb\n#endif", nil, []string{"#make", "DEBUG", "0", ";", "b"}},
+		{"#if DEBUG\na\n#endif\nc", nil, []string{"c"}},
+		{"#make DEBUG 0\n#if DEBUG\na\n#endif", map[string]string{"DEBUG": "1"}, []string{"a"}},
+		{"#if LEVEL >= 2 && defined(LEVEL)\nLEVEL\n#endif", map[string]string{"LEVEL": "3"}, []string{"3"}},
+		{"#if 1\n#if 0\na\n#else\nb\n#endif\n#endif", nil, []string{"b"}},
+		{"#if 0\n#if 1\na\n#endif\n#else\nc\n#endif", nil, []string{"c"}},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for name, value := range tt.defines {
+			l.Define(name, value)
+		}
+
+		got := []string{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			got = append(got, tok.Literal)
+		}
+
+		if len(l.DirectiveErrors()) != 0 {
+			t.Fatalf("tests[%d] - unexpected directive errors: %v", i, l.DirectiveErrors())
+		}
+		if len(got) != len(tt.expected) {
+			t.Fatalf("tests[%d] - wrong tokens. expected=%v, got=%v", i, tt.expected, got)
+		}
+		for j := range got {
+			if got[j] != tt.expected[j] {
+				t.Fatalf("tests[%d] - wrong tokens. expected=%v, got=%v", i, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestDirectiveErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"#endif", "#endif without matching #if"},
+		{"#else", "#else without matching #if"},
+		{"#if 1\na", "unterminated #if, expected #endif"},
+		{"#if 1\n#else\n#else\n#endif", "duplicate #else for #if on line 1"},
+		{"#make ADD(a, b) (a + b)\nADD(1)", "macro 'ADD' expects 2 argument(s), got 1"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errs := l.DirectiveErrors()
+		if len(errs) == 0 {
+			t.Fatalf("no directive error for %q", tt.input)
+		}
+		if errs[0].Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errs[0].Message)
+		}
+	}
+}
+
+func TestSetLiteral(t *testing.T) {
+	input := `#{1, x} #{}`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.SET_LBRACE, "#{"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.SET_LBRACE, "#{"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestQuestionAndPipeTokens(t *testing.T) {
+	input := `a?.b ?? c?.[0] x ?.5 : 1 |> f || g |= h`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.QUESTION_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "c"},
+		{token.QUESTION_DOT, "?."},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "x"},
+		{token.QUESTION, "?"},
+		{token.FLOAT, ".5"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.OR_OR, "||"},
+		{token.IDENT, "g"},
+		{token.BIT_OR_ASSIGN, "|="},
+		{token.IDENT, "h"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestDecoratorToken(t *testing.T) {
+	input := "@memo\n@trace(\"x\") define f(n) {}"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.AT, "@"},
+		{token.IDENT, "memo"},
+		{token.AT, "@"},
+		{token.IDENT, "trace"},
+		{token.LPAREN, "("},
+		{token.STRING, "x"},
+		{token.RPAREN, ")"},
+		{token.FUNCTION, "define"},
+		{token.IDENT, "f"},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`plain`, "plain"},
+		{`a\nb\tc\rd`, "a\nb\tc\rd"},
+		{`\"quoted\" \\ \${x}`, "\"quoted\" \\ ${x}"},
+		{`\q stays`, "\\q stays"},
+		{`trailing\`, "trailing\\"},
+	}
+
+	for _, tt := range tests {
+		if got := Unescape(tt.input); got != tt.expected {
+			t.Errorf("Unescape(%q): expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
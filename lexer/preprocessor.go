@@ -0,0 +1,748 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"victoria/token"
+)
+
+// The preprocessor sits between the raw tokenizer and the parser. It handles
+// conditional compilation (#if / #else / #endif), function-like macros
+// (#make SQ(x) ((x)*(x))) and command-line defines (-D NAME=value).
+//
+// Object-like #make directives are still passed through to the parser so that
+// they become runtime constants, but their values are recorded so that #if
+// conditions can refer to them.
+
+type macroKind int
+
+const (
+	macroObject   macroKind = iota // #make NAME value (runtime constant, visible to #if)
+	macroDefine                    // -D NAME=value (substituted everywhere)
+	macroFunction                  // #make NAME(params) body
+)
+
+type macro struct {
+	name   string
+	kind   macroKind
+	params []string
+	body   []token.Token
+}
+
+// macroToken is a token together with the set of macro names that must not be
+// expanded again inside it (prevents infinite recursion like C's hide sets)
+type macroToken struct {
+	tok  token.Token
+	hide map[string]bool
+}
+
+type condFrame struct {
+	active       bool // tokens in the current branch are emitted
+	parentActive bool // the enclosing region is active
+	taken        bool // a branch of this #if has already been selected
+	seenElse     bool
+	tok          token.Token
+}
+
+// DirectiveError describes an invalid preprocessor directive
+type DirectiveError struct {
+	Directive string // "#make", "#if", "#else" or "#endif"
+	Message   string
+	Line      int
+	Column    int
+	EndColumn int
+}
+
+// Define registers a command-line define (-D NAME=value). It must be called
+// before the first token is read. A #make for the same name in the source is
+// ignored so the command line always wins.
+func (l *Lexer) Define(name, value string) {
+	sub := New(value)
+	body := []token.Token{}
+	for tok := sub.nextRawToken(); tok.Type != token.EOF; tok = sub.nextRawToken() {
+		body = append(body, tok)
+	}
+	l.macros[name] = &macro{name: name, kind: macroDefine, body: body}
+	l.defines[name] = true
+}
+
+// DirectiveErrors returns the errors found while processing directives
+func (l *Lexer) DirectiveErrors() []DirectiveError {
+	return l.ppErrors
+}
+
+// NextToken returns the next token after applying preprocessor directives
+// and macro expansion
+func (l *Lexer) NextToken() token.Token {
+	for {
+		if len(l.pending) > 0 {
+			tok := l.pending[0]
+			l.pending = l.pending[1:]
+			return tok
+		}
+
+		tok := l.readToken()
+		switch tok.Type {
+		case token.PP_IF:
+			l.handleIf(tok)
+			continue
+		case token.PP_ELSE:
+			l.handleElse(tok)
+			continue
+		case token.PP_ENDIF:
+			l.handleEndif(tok)
+			continue
+		case token.EOF:
+			for _, frame := range l.conds {
+				l.directiveError(frame.tok, "unterminated #if, expected #endif")
+			}
+			l.conds = nil
+			return tok
+		}
+
+		if !l.isActive() {
+			continue
+		}
+
+		switch tok.Type {
+		case token.MAKE:
+			l.handleMake(tok)
+			continue
+		case token.IDENT:
+			if m := l.lookupMacro(tok.Literal, false); m != nil {
+				l.expandFromStream(tok, m)
+				continue
+			}
+		}
+		return tok
+	}
+}
+
+// readToken returns the next raw token, taking any pushed-back tokens first
+func (l *Lexer) readToken() token.Token {
+	if len(l.lookahead) > 0 {
+		tok := l.lookahead[0]
+		l.lookahead = l.lookahead[1:]
+		return tok
+	}
+	return l.nextRawToken()
+}
+
+func (l *Lexer) unreadToken(tok token.Token) {
+	l.lookahead = append([]token.Token{tok}, l.lookahead...)
+}
+
+// readLine returns the remaining raw tokens on the given line
+func (l *Lexer) readLine(line int) []token.Token {
+	toks := []token.Token{}
+	for {
+		tok := l.readToken()
+		if tok.Type == token.EOF || tok.Line != line {
+			l.unreadToken(tok)
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func (l *Lexer) isActive() bool {
+	if len(l.conds) == 0 {
+		return true
+	}
+	return l.conds[len(l.conds)-1].active
+}
+
+func (l *Lexer) directiveError(tok token.Token, format string, args ...interface{}) {
+	l.ppErrors = append(l.ppErrors, DirectiveError{
+		Directive: tok.Literal,
+		Message:   fmt.Sprintf(format, args...),
+		Line:      tok.Line,
+		Column:    tok.Column,
+		EndColumn: tok.EndColumn,
+	})
+}
+
+// lookupMacro finds a macro that may be expanded. Object-like #make values are
+// only substituted inside #if conditions; in code they stay runtime constants.
+func (l *Lexer) lookupMacro(name string, inCondition bool) *macro {
+	m, ok := l.macros[name]
+	if !ok {
+		return nil
+	}
+	if m.kind == macroObject && !inCondition {
+		return nil
+	}
+	return m
+}
+
+func (l *Lexer) handleMake(makeTok token.Token) {
+	rest := l.readLine(makeTok.Line)
+	if len(rest) == 0 || rest[0].Type != token.IDENT {
+		// Let the parser report the malformed directive
+		l.pending = append(l.pending, makeTok)
+		l.pending = append(l.pending, rest...)
+		return
+	}
+
+	name := rest[0]
+	if l.defines[name.Literal] {
+		// Overridden by -D on the command line
+		return
+	}
+
+	if params, body, ok := parseMacroParams(name, rest[1:]); ok {
+		for _, p := range params {
+			if p == name.Literal {
+				l.directiveError(makeTok, "macro parameter '%s' shadows the macro name", p)
+			}
+		}
+		l.macros[name.Literal] = &macro{name: name.Literal, kind: macroFunction, params: params, body: body}
+		return
+	}
+
+	value := l.expandTokens(wrapTokens(rest[1:]), false)
+	if len(value) == 0 {
+		l.directiveError(makeTok, "missing value for '%s'", name.Literal)
+	}
+	l.macros[name.Literal] = &macro{name: name.Literal, kind: macroObject, body: value}
+
+	l.pending = append(l.pending, makeTok, name)
+	l.pending = append(l.pending, value...)
+
+	// Directives end at the end of the line, so the value must not run into
+	// the next line (e.g. a macro expanding to a parenthesised expression).
+	// Values with unclosed brackets continue on the following lines.
+	if len(value) > 0 && value[len(value)-1].Type != token.SEMICOLON && bracketDepth(value) == 0 {
+		last := value[len(value)-1]
+		l.pending = append(l.pending, token.Token{Type: token.SEMICOLON, Literal: ";", Line: last.Line, Column: last.EndColumn, EndColumn: last.EndColumn})
+	}
+}
+
+// bracketDepth returns the number of brackets left open by toks
+func bracketDepth(toks []token.Token) int {
+	depth := 0
+	for _, tok := range toks {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		}
+	}
+	return depth
+}
+
+// parseMacroParams recognises the "(a, b)" parameter list of a function-like
+// macro. The opening parenthesis must directly follow the name, as in C.
+func parseMacroParams(name token.Token, toks []token.Token) ([]string, []token.Token, bool) {
+	if len(toks) == 0 || toks[0].Type != token.LPAREN || toks[0].Column != name.EndColumn {
+		return nil, nil, false
+	}
+
+	params := []string{}
+	i := 1
+	if i < len(toks) && toks[i].Type == token.RPAREN {
+		return params, toks[i+1:], true
+	}
+	for i < len(toks) {
+		if toks[i].Type != token.IDENT {
+			return nil, nil, false
+		}
+		params = append(params, toks[i].Literal)
+		i++
+		if i >= len(toks) {
+			return nil, nil, false
+		}
+		switch toks[i].Type {
+		case token.COMMA:
+			i++
+		case token.RPAREN:
+			return params, toks[i+1:], true
+		default:
+			return nil, nil, false
+		}
+	}
+	return nil, nil, false
+}
+
+func wrapTokens(toks []token.Token) []macroToken {
+	out := make([]macroToken, len(toks))
+	for i, tok := range toks {
+		out[i] = macroToken{tok: tok}
+	}
+	return out
+}
+
+// expandFromStream expands a macro found in the token stream, reading the
+// invocation arguments from the input when the macro is function-like
+func (l *Lexer) expandFromStream(nameTok token.Token, m *macro) {
+	invocation := []token.Token{nameTok}
+
+	if m.kind == macroFunction {
+		next := l.readToken()
+		if next.Type != token.LPAREN {
+			// A function-like macro name without arguments is left alone
+			l.unreadToken(next)
+			l.pending = append(l.pending, nameTok)
+			return
+		}
+		invocation = append(invocation, next)
+		depth := 1
+		for depth > 0 {
+			tok := l.readToken()
+			if tok.Type == token.EOF {
+				l.unreadToken(tok)
+				l.directiveError(nameTok, "unterminated argument list for macro '%s'", m.name)
+				return
+			}
+			switch tok.Type {
+			case token.LPAREN:
+				depth++
+			case token.RPAREN:
+				depth--
+			}
+			invocation = append(invocation, tok)
+		}
+	}
+
+	l.pending = append(l.pending, l.expandTokens(wrapTokens(invocation), false)...)
+}
+
+// expandTokens fully macro-expands a token list
+func (l *Lexer) expandTokens(input []macroToken, inCondition bool) []token.Token {
+	out := []token.Token{}
+	work := input
+
+	for len(work) > 0 {
+		cur := work[0]
+		work = work[1:]
+
+		if cur.tok.Type != token.IDENT || cur.hide[cur.tok.Literal] {
+			out = append(out, cur.tok)
+			continue
+		}
+		m := l.lookupMacro(cur.tok.Literal, inCondition)
+		if m == nil {
+			out = append(out, cur.tok)
+			continue
+		}
+
+		hide := map[string]bool{m.name: true}
+		for name := range cur.hide {
+			hide[name] = true
+		}
+
+		if m.kind != macroFunction {
+			replacement := make([]macroToken, 0, len(m.body))
+			for _, tok := range m.body {
+				replacement = append(replacement, macroToken{tok: relocate(tok, cur.tok, cur.tok.EndColumn), hide: hide})
+			}
+			work = append(replacement, work...)
+			continue
+		}
+
+		args, rest, closing, ok := collectArgs(work)
+		if !ok {
+			out = append(out, cur.tok)
+			continue
+		}
+		if len(args) != len(m.params) && !(len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0) {
+			l.directiveError(cur.tok, "macro '%s' expects %d argument(s), got %d", m.name, len(m.params), len(args))
+			out = append(out, cur.tok)
+			continue
+		}
+
+		// Arguments are fully expanded before substitution
+		expandedArgs := make(map[string][]token.Token, len(m.params))
+		for i, param := range m.params {
+			expandedArgs[param] = l.expandTokens(args[i], inCondition)
+		}
+
+		replacement := []macroToken{}
+		for _, tok := range m.body {
+			if arg, isParam := expandedArgs[tok.Literal]; isParam && tok.Type == token.IDENT {
+				for _, a := range arg {
+					replacement = append(replacement, macroToken{tok: a, hide: hide})
+				}
+				continue
+			}
+			replacement = append(replacement, macroToken{tok: relocate(tok, cur.tok, closing.EndColumn), hide: hide})
+		}
+		work = append(replacement, rest...)
+	}
+
+	return out
+}
+
+// collectArgs splits "(a, (b, c))" into its top-level arguments
+func collectArgs(toks []macroToken) ([][]macroToken, []macroToken, token.Token, bool) {
+	if len(toks) == 0 || toks[0].tok.Type != token.LPAREN {
+		return nil, nil, token.Token{}, false
+	}
+
+	args := [][]macroToken{}
+	current := []macroToken{}
+	depth := 0
+	for i := 1; i < len(toks); i++ {
+		tok := toks[i].tok
+		switch {
+		case tok.Type == token.RPAREN && depth == 0:
+			args = append(args, current)
+			return args, toks[i+1:], tok, true
+		case tok.Type == token.COMMA && depth == 0:
+			args = append(args, current)
+			current = []macroToken{}
+			continue
+		case tok.Type == token.LPAREN || tok.Type == token.LBRACKET || tok.Type == token.LBRACE:
+			depth++
+		case tok.Type == token.RPAREN || tok.Type == token.RBRACKET || tok.Type == token.RBRACE:
+			depth--
+		}
+		current = append(current, toks[i])
+	}
+	return nil, nil, token.Token{}, false
+}
+
+// relocate moves a macro body token to the invocation site so errors point at
+// the macro call rather than the definition
+func relocate(tok token.Token, site token.Token, endColumn int) token.Token {
+	tok.Line = site.Line
+	tok.Column = site.Column
+	tok.EndColumn = endColumn
+	return tok
+}
+
+func (l *Lexer) handleIf(ifTok token.Token) {
+	cond := l.readLine(ifTok.Line)
+	parentActive := l.isActive()
+	frame := condFrame{parentActive: parentActive, tok: ifTok}
+
+	if parentActive {
+		if len(cond) == 0 {
+			l.directiveError(ifTok, "missing condition after #if")
+		} else {
+			value, err := l.evalCondition(cond)
+			if err != "" {
+				l.directiveError(ifTok, "%s", err)
+			}
+			frame.active = err == "" && ppTruthy(value)
+			frame.taken = frame.active
+		}
+	}
+
+	l.conds = append(l.conds, frame)
+}
+
+func (l *Lexer) handleElse(elseTok token.Token) {
+	if len(l.conds) == 0 {
+		l.directiveError(elseTok, "#else without matching #if")
+		return
+	}
+	frame := &l.conds[len(l.conds)-1]
+	if frame.seenElse {
+		l.directiveError(elseTok, "duplicate #else for #if on line %d", frame.tok.Line)
+		return
+	}
+	frame.seenElse = true
+	frame.active = frame.parentActive && !frame.taken
+	frame.taken = true
+}
+
+func (l *Lexer) handleEndif(endifTok token.Token) {
+	if len(l.conds) == 0 {
+		l.directiveError(endifTok, "#endif without matching #if")
+		return
+	}
+	l.conds = l.conds[:len(l.conds)-1]
+}
+
+// evalCondition evaluates the expression of an #if directive. Undefined
+// identifiers evaluate to 0, like in C.
+func (l *Lexer) evalCondition(toks []token.Token) (interface{}, string) {
+	resolved := []token.Token{}
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.Type != token.IDENT || tok.Literal != "defined" {
+			resolved = append(resolved, tok)
+			continue
+		}
+		// defined(NAME) or defined NAME
+		name := ""
+		if i+1 < len(toks) && toks[i+1].Type == token.LPAREN {
+			if i+3 >= len(toks) || toks[i+2].Type != token.IDENT || toks[i+3].Type != token.RPAREN {
+				return nil, "expected 'defined(NAME)'"
+			}
+			name = toks[i+2].Literal
+			i += 3
+		} else if i+1 < len(toks) && toks[i+1].Type == token.IDENT {
+			name = toks[i+1].Literal
+			i++
+		} else {
+			return nil, "expected a name after 'defined'"
+		}
+		lit := "0"
+		if _, ok := l.macros[name]; ok {
+			lit = "1"
+		}
+		resolved = append(resolved, token.Token{Type: token.INT, Literal: lit, Line: tok.Line, Column: tok.Column, EndColumn: tok.EndColumn})
+	}
+
+	e := &condEvaluator{toks: l.expandTokens(wrapTokens(resolved), true)}
+	value := e.parseOr()
+	if e.err == "" && e.pos < len(e.toks) {
+		e.err = fmt.Sprintf("unexpected '%s' in #if condition", e.toks[e.pos].Literal)
+	}
+	return value, e.err
+}
+
+// condEvaluator is a small recursive-descent evaluator for #if conditions.
+// Values are int64, float64, string or bool.
+type condEvaluator struct {
+	toks []token.Token
+	pos  int
+	err  string
+}
+
+func (e *condEvaluator) peek() token.Token {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return token.Token{Type: token.EOF}
+}
+
+func (e *condEvaluator) fail(format string, args ...interface{}) interface{} {
+	if e.err == "" {
+		e.err = fmt.Sprintf(format, args...)
+	}
+	return int64(0)
+}
+
+func (e *condEvaluator) parseOr() interface{} {
+	left := e.parseAnd()
+	for t := e.peek().Type; t == token.OR_OR || t == token.OR; t = e.peek().Type {
+		e.pos++
+		right := e.parseAnd()
+		left = ppTruthy(left) || ppTruthy(right)
+	}
+	return left
+}
+
+func (e *condEvaluator) parseAnd() interface{} {
+	left := e.parseComparison()
+	for t := e.peek().Type; t == token.AND_AND || t == token.AND; t = e.peek().Type {
+		e.pos++
+		right := e.parseComparison()
+		left = ppTruthy(left) && ppTruthy(right)
+	}
+	return left
+}
+
+func (e *condEvaluator) parseComparison() interface{} {
+	left := e.parseSum()
+	switch op := e.peek(); op.Type {
+	case token.EQ, token.NOT_EQ, token.LT, token.GT, token.LTE, token.GTE:
+		e.pos++
+		right := e.parseSum()
+		return e.compare(op.Literal, left, right)
+	}
+	return left
+}
+
+func (e *condEvaluator) parseSum() interface{} {
+	left := e.parseProduct()
+	for op := e.peek(); op.Type == token.PLUS || op.Type == token.MINUS; op = e.peek() {
+		e.pos++
+		right := e.parseProduct()
+		left = e.arith(op.Literal, left, right)
+	}
+	return left
+}
+
+func (e *condEvaluator) parseProduct() interface{} {
+	left := e.parseUnary()
+	for op := e.peek(); op.Type == token.ASTERISK || op.Type == token.SLASH || op.Type == token.MODULO; op = e.peek() {
+		e.pos++
+		right := e.parseUnary()
+		left = e.arith(op.Literal, left, right)
+	}
+	return left
+}
+
+func (e *condEvaluator) parseUnary() interface{} {
+	switch e.peek().Type {
+	case token.BANG, token.NOT:
+		e.pos++
+		return !ppTruthy(e.parseUnary())
+	case token.MINUS:
+		e.pos++
+		switch v := e.parseUnary().(type) {
+		case int64:
+			return -v
+		case float64:
+			return -v
+		default:
+			return e.fail("cannot negate %v in #if condition", v)
+		}
+	}
+	return e.parsePrimary()
+}
+
+func (e *condEvaluator) parsePrimary() interface{} {
+	tok := e.peek()
+	e.pos++
+	switch tok.Type {
+	case token.INT:
+		v, err := strconv.ParseInt(tok.Literal, 0, 64)
+		if err != nil {
+			return e.fail("invalid integer '%s' in #if condition", tok.Literal)
+		}
+		return v
+	case token.FLOAT:
+		v, err := strconv.ParseFloat(tok.Literal, 64)
+		if err != nil {
+			return e.fail("invalid float '%s' in #if condition", tok.Literal)
+		}
+		return v
+	case token.STRING, token.CHAR:
+		return tok.Literal
+	case token.TRUE:
+		return true
+	case token.FALSE:
+		return false
+	case token.NULL_KW, token.IDENT:
+		// Undefined names are false
+		return int64(0)
+	case token.LPAREN:
+		v := e.parseOr()
+		if e.peek().Type != token.RPAREN {
+			return e.fail("expected ')' in #if condition")
+		}
+		e.pos++
+		return v
+	case token.EOF:
+		e.pos--
+		return e.fail("unexpected end of #if condition")
+	}
+	return e.fail("unexpected '%s' in #if condition", tok.Literal)
+}
+
+func (e *condEvaluator) arith(op string, left, right interface{}) interface{} {
+	if ls, ok := left.(string); ok {
+		if rs, ok := right.(string); ok && op == "+" {
+			return ls + rs
+		}
+		return e.fail("unsupported operator '%s' for strings in #if condition", op)
+	}
+
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt {
+		switch op {
+		case "+":
+			return li + ri
+		case "-":
+			return li - ri
+		case "*":
+			return li * ri
+		case "/", "%":
+			if ri == 0 {
+				return e.fail("division by zero in #if condition")
+			}
+			if op == "/" {
+				return li / ri
+			}
+			return li % ri
+		}
+	}
+
+	lf, lok := ppFloat(left)
+	rf, rok := ppFloat(right)
+	if !lok || !rok {
+		return e.fail("unsupported operands for '%s' in #if condition", op)
+	}
+	switch op {
+	case "+":
+		return lf + rf
+	case "-":
+		return lf - rf
+	case "*":
+		return lf * rf
+	case "/":
+		if rf == 0 {
+			return e.fail("division by zero in #if condition")
+		}
+		return lf / rf
+	}
+	return e.fail("unsupported operator '%s' for floats in #if condition", op)
+}
+
+func (e *condEvaluator) compare(op string, left, right interface{}) interface{} {
+	var cmp int
+	ls, lStr := left.(string)
+	rs, rStr := right.(string)
+	lf, lNum := ppFloat(left)
+	rf, rNum := ppFloat(right)
+
+	switch {
+	case lStr && rStr:
+		switch {
+		case ls < rs:
+			cmp = -1
+		case ls > rs:
+			cmp = 1
+		}
+	case lNum && rNum:
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	default:
+		lb, lBool := left.(bool)
+		rb, rBool := right.(bool)
+		if lBool && rBool && (op == "==" || op == "!=") {
+			return (lb == rb) == (op == "==")
+		}
+		return e.fail("cannot compare %v and %v in #if condition", left, right)
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func ppFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func ppTruthy(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case int64:
+		return val != 0
+	case float64:
+		return val != 0
+	case string:
+		return val != ""
+	}
+	return false
+}
@@ -2,8 +2,13 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
 	"strings"
 	"victoria/ast"
 )
@@ -12,6 +17,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ        = "INTEGER"
+	BIG_INTEGER_OBJ    = "BIG_INTEGER"
 	FLOAT_OBJ          = "FLOAT"
 	BOOLEAN_OBJ        = "BOOLEAN"
 	NULL_OBJ           = "NULL"
@@ -26,6 +32,7 @@ const (
 	BUILTIN_OBJ        = "BUILTIN"
 	ARRAY_OBJ          = "ARRAY"
 	HASH_OBJ           = "HASH"
+	SET_OBJ            = "SET"
 	STRUCT_OBJ         = "STRUCT"          // The struct definition
 	INSTANCE_OBJ       = "STRUCT_INSTANCE" // The instance
 	ENUM_OBJ           = "ENUM"            // Enum type definition
@@ -33,6 +40,8 @@ const (
 	BREAK_OBJ          = "BREAK"
 	CONTINUE_OBJ       = "CONTINUE"
 	RANGE_OBJ          = "RANGE"
+	ITERATOR_OBJ       = "ITERATOR"
+	MEMOIZED_OBJ       = "MEMOIZED"
 )
 
 type Object interface {
@@ -54,6 +63,44 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// BigInteger is an arbitrary-precision integer. Integer arithmetic is promoted
+// to BigInteger on overflow; values that fit in an int64 are always
+// represented as Integer (see NewBigInteger).
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(bi.Value.Bytes())
+	value := h.Sum64()
+	if bi.Value.Sign() < 0 {
+		value = ^value
+	}
+	return HashKey{Type: bi.Type(), Value: value}
+}
+
+// NewBigInteger returns an Integer if v fits in an int64 and a BigInteger otherwise
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+// ToBigInt returns the value of an Integer or BigInteger as a *big.Int
+func ToBigInt(obj Object) (*big.Int, bool) {
+	switch o := obj.(type) {
+	case *Integer:
+		return big.NewInt(o.Value), true
+	case *BigInteger:
+		return o.Value, true
+	}
+	return nil, false
+}
+
 type Float struct {
 	Value float64
 }
@@ -61,6 +108,20 @@ type Float struct {
 func (f *Float) Type() ObjectType { return FLOAT_OBJ }
 func (f *Float) Inspect() string  { return fmt.Sprintf("%g", f.Value) }
 
+// HashKey makes floats with an integral value the same key as the matching
+// integer, since 1 == 1.0. Zero and NaN are normalized so -0.0 and 0.0 share a
+// key and every NaN is the same key.
+func (f *Float) HashKey() HashKey {
+	v := f.Value
+	if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(v))}
+	}
+	if math.IsNaN(v) {
+		v = math.NaN()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(v)}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -94,6 +155,9 @@ type Error struct {
 	Line      int
 	Column    int
 	EndColumn int
+	// Details are extra lines for the rich formatter, such as the values
+	// compared by a failed assert
+	Details []string
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -105,6 +169,7 @@ type Function struct {
 	ReturnTypes     []*ast.TypeAnnotation // Return type(s)
 	Body            *ast.BlockStatement
 	Env             *Environment
+	IsGenerator     bool // Calling the function returns an Iterator over its yields
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -256,8 +321,15 @@ func (b *Builtin) Inspect() string  { return "builtin function" }
 
 type Array struct {
 	Elements []Object
+	// KeyRefs counts the hash entries and set members whose key is the array
+	// or contains it. While it is above zero the array may not be modified,
+	// since that would change the key's hash.
+	KeyRefs int
 }
 
+// Frozen reports whether the array is part of a key held by a hash or set
+func (ao *Array) Frozen() bool { return ao.KeyRefs > 0 }
+
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
 func (ao *Array) Inspect() string {
 	var out bytes.Buffer
@@ -276,20 +348,275 @@ type HashKey struct {
 	Value uint64
 }
 
+// HashKeyOf returns the hash key for obj. Besides Hashable values, arrays and
+// struct instances can be keys: they hash by structure, so two arrays with
+// equal elements are the same key. They are usable only if every element is.
+func HashKeyOf(obj Object) (HashKey, bool) {
+	switch obj.(type) {
+	case *Array, *StructInstance:
+		h := fnv.New64a()
+		if !writeHashKey(h, obj) {
+			return HashKey{}, false
+		}
+		return HashKey{Type: obj.Type(), Value: h.Sum64()}, true
+	case Hashable:
+		return obj.(Hashable).HashKey(), true
+	}
+	return HashKey{}, false
+}
+
+func writeHashKey(h hash.Hash64, obj Object) bool {
+	var buf [8]byte
+	switch o := obj.(type) {
+	case *Array:
+		h.Write([]byte(ARRAY_OBJ))
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(o.Elements)))
+		h.Write(buf[:])
+		for _, elem := range o.Elements {
+			if !writeHashKey(h, elem) {
+				return false
+			}
+		}
+		return true
+	case *StructInstance:
+		h.Write([]byte(INSTANCE_OBJ + ":" + o.Struct.Name))
+		for _, name := range o.fieldNames() {
+			h.Write([]byte{0})
+			h.Write([]byte(name))
+			if !writeHashKey(h, o.Fields[name]) {
+				return false
+			}
+		}
+		return true
+	case Hashable:
+		key := o.HashKey()
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(buf[:], key.Value)
+		h.Write(buf[:])
+		return true
+	}
+	return false
+}
+
+// keysEqual reports whether a and b are the same hash key. Hash keys only
+// narrow the search, since different keys can share one, so the keys whose
+// hashes can collide are compared by value: strings, big integers, enum
+// values, and arrays and structs element by element.
+func keysEqual(a, b Object) bool {
+	switch x := a.(type) {
+	case *Array:
+		y, ok := b.(*Array)
+		if !ok || len(x.Elements) != len(y.Elements) {
+			return false
+		}
+		for i := range x.Elements {
+			if !keysEqual(x.Elements[i], y.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *StructInstance:
+		y, ok := b.(*StructInstance)
+		if !ok || x.Struct.Name != y.Struct.Name {
+			return false
+		}
+		xNames, yNames := x.fieldNames(), y.fieldNames()
+		if len(xNames) != len(yNames) {
+			return false
+		}
+		for i, name := range xNames {
+			if yNames[i] != name || !keysEqual(x.Fields[name], y.Fields[name]) {
+				return false
+			}
+		}
+		return true
+	case *String:
+		y, ok := b.(*String)
+		return ok && x.Value == y.Value
+	case *BigInteger:
+		y, ok := b.(*BigInteger)
+		return ok && x.Value.Cmp(y.Value) == 0
+	case *EnumValue:
+		y, ok := b.(*EnumValue)
+		return ok && x.EnumName == y.EnumName && x.ValueName == y.ValueName
+	}
+	ha, ok := a.(Hashable)
+	if !ok {
+		return false
+	}
+	hb, ok := b.(Hashable)
+	return ok && ha.HashKey() == hb.HashKey()
+}
+
+// retainKey adds delta to KeyRefs of every array inside key, so an array is
+// frozen exactly as long as some hash or set holds it as a key
+func retainKey(key Object, delta int) {
+	switch o := key.(type) {
+	case *Array:
+		o.KeyRefs += delta
+		for _, elem := range o.Elements {
+			retainKey(elem, delta)
+		}
+	case *StructInstance:
+		for _, field := range o.Fields {
+			retainKey(field, delta)
+		}
+	}
+}
+
+// CopyKey returns a copy of key that shares no arrays or structs with it,
+// for callers that must keep a key unaffected by later changes to the
+// original, such as the argument lists @memo caches
+func CopyKey(key Object) Object {
+	switch o := key.(type) {
+	case *Array:
+		elements := make([]Object, len(o.Elements))
+		for i, elem := range o.Elements {
+			elements[i] = CopyKey(elem)
+		}
+		return &Array{Elements: elements}
+	case *StructInstance:
+		fields := make(map[string]Object, len(o.Fields))
+		for name, field := range o.Fields {
+			fields[name] = CopyKey(field)
+		}
+		return &StructInstance{Struct: o.Struct, Fields: fields}
+	}
+	return key
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash is an insertion-ordered hash map. Lookups go through an index map and
+// pairs are kept in a slice in insertion order, so printing and iteration are
+// deterministic. Keys with the same HashKey share an index slot and are told
+// apart with keysEqual. Deleted pairs leave a tombstone that is compacted
+// away once tombstones outnumber live pairs, keeping Delete amortized O(1).
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	index   map[HashKey][]int // positions in entries of the live keys with each hash
+	entries []HashPair        // insertion order; deleted entries have a nil Key
+	size    int               // number of live pairs
+}
+
+// NewHash returns an empty hash
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey][]int)}
+}
+
+// find returns the position in entries of key, whose hash is hashKey
+func (h *Hash) find(key Object, hashKey HashKey) (int, bool) {
+	for _, i := range h.index[hashKey] {
+		if keysEqual(h.entries[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Get returns the pair stored under key, whose hash is hashKey
+func (h *Hash) Get(key Object, hashKey HashKey) (HashPair, bool) {
+	i, ok := h.find(key, hashKey)
+	if !ok {
+		return HashPair{}, false
+	}
+	return h.entries[i], true
+}
+
+// GetString is shorthand for Get with a string key
+func (h *Hash) GetString(key string) (HashPair, bool) {
+	k := &String{Value: key}
+	return h.Get(k, k.HashKey())
+}
+
+// Set stores value under key, whose hash is hashKey. Updating an existing
+// key keeps its position. A new key is stored as is and the arrays in it are
+// frozen until it is deleted.
+func (h *Hash) Set(key Object, hashKey HashKey, value Object) {
+	if h.index == nil {
+		h.index = make(map[HashKey][]int)
+	}
+	if i, ok := h.find(key, hashKey); ok {
+		h.entries[i].Value = value
+		return
+	}
+	h.index[hashKey] = append(h.index[hashKey], len(h.entries))
+	retainKey(key, 1)
+	h.entries = append(h.entries, HashPair{Key: key, Value: value})
+	h.size++
+}
+
+// SetString is shorthand for Set with a string key
+func (h *Hash) SetString(key string, value Object) {
+	k := &String{Value: key}
+	h.Set(k, k.HashKey(), value)
+}
+
+// Delete removes key, whose hash is hashKey, and reports whether it was present
+func (h *Hash) Delete(key Object, hashKey HashKey) bool {
+	i, ok := h.find(key, hashKey)
+	if !ok {
+		return false
+	}
+	slot := h.index[hashKey]
+	for j, pos := range slot {
+		if pos == i {
+			slot = append(slot[:j], slot[j+1:]...)
+			break
+		}
+	}
+	if len(slot) == 0 {
+		delete(h.index, hashKey)
+	} else {
+		h.index[hashKey] = slot
+	}
+	retainKey(h.entries[i].Key, -1)
+	h.entries[i] = HashPair{}
+	h.size--
+	if dead := len(h.entries) - h.size; dead > 16 && dead > h.size {
+		h.compact()
+	}
+	return true
+}
+
+func (h *Hash) compact() {
+	live := make([]HashPair, 0, h.size)
+	moved := make([]int, len(h.entries))
+	for i, pair := range h.entries {
+		if pair.Key != nil {
+			moved[i] = len(live)
+			live = append(live, pair)
+		}
+	}
+	h.entries = live
+	for _, slot := range h.index {
+		for j, i := range slot {
+			slot[j] = moved[i]
+		}
+	}
+}
+
+// Len returns the number of pairs
+func (h *Hash) Len() int { return h.size }
+
+// Pairs returns the pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.size)
+	for _, pair := range h.entries {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{")
@@ -298,9 +625,66 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Set is an insertion-ordered collection of distinct values. Members are
+// stored as the keys of a Hash, so any valid hash key can be a member and
+// Add, Remove and Has are O(1).
+type Set struct {
+	members *Hash
+}
+
+func NewSet() *Set {
+	return &Set{members: NewHash()}
+}
+
+// Add inserts elem, whose hash is key, and reports whether it was not
+// already a member
+func (s *Set) Add(elem Object, key HashKey) bool {
+	if _, ok := s.members.Get(elem, key); ok {
+		return false
+	}
+	s.members.Set(elem, key, elem)
+	return true
+}
+
+// Remove deletes elem, whose hash is key, and reports whether it was present
+func (s *Set) Remove(elem Object, key HashKey) bool { return s.members.Delete(elem, key) }
+
+// Has reports whether the set contains elem, whose hash is key
+func (s *Set) Has(elem Object, key HashKey) bool {
+	_, ok := s.members.Get(elem, key)
+	return ok
+}
+
+// Len returns the number of members
+func (s *Set) Len() int { return s.members.Len() }
+
+// Elements returns the members in insertion order
+func (s *Set) Elements() []Object {
+	pairs := s.members.Pairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = pair.Key
+	}
+	return elements
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range s.Elements() {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
 type Struct struct {
-	Name   string
-	Fields []string
+	Name    string
+	Fields  []string
+	Methods map[string]*Function // methods defined with define Name.method(...)
 }
 
 func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
@@ -314,21 +698,53 @@ type StructInstance struct {
 }
 
 func (si *StructInstance) Type() ObjectType { return INSTANCE_OBJ }
+
+// StringMethod is set by the evaluator to call a struct's __str method, so
+// that instances print through it wherever they appear
+var StringMethod func(si *StructInstance) (string, bool)
+
 func (si *StructInstance) Inspect() string {
+	if StringMethod != nil {
+		if s, ok := StringMethod(si); ok {
+			return s
+		}
+	}
 	var out bytes.Buffer
 	out.WriteString(si.Struct.Name)
 	out.WriteString(" { ")
 	pairs := []string{}
-	for k, v := range si.Fields {
-		pairs = append(pairs, k+": "+v.Inspect())
+	for _, k := range si.fieldNames() {
+		pairs = append(pairs, k+": "+si.Fields[k].Inspect())
 	}
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString(" }")
 	return out.String()
 }
 
+// fieldNames returns the instance's fields in declaration order, followed by
+// any undeclared fields sorted by name
+func (si *StructInstance) fieldNames() []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, f := range si.Struct.Fields {
+		if _, ok := si.Fields[f]; ok {
+			names = append(names, f)
+			seen[f] = true
+		}
+	}
+	extra := []string{}
+	for f := range si.Fields {
+		if !seen[f] {
+			extra = append(extra, f)
+		}
+	}
+	sort.Strings(extra)
+	return append(names, extra...)
+}
+
 type Environment struct {
 	store  map[string]Object
+	names  []string        // definition order of store, used by ToHash
 	consts map[string]bool // tracks which variables are const
 	outer  *Environment
 }
@@ -354,25 +770,28 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	if _, exists := e.store[name]; !exists {
+		e.names = append(e.names, name)
+	}
 	e.store[name] = val
 	return val
 }
 
 // SetConst sets a constant variable that cannot be reassigned
 func (e *Environment) SetConst(name string, val Object) Object {
-	e.store[name] = val
+	e.Set(name, val)
 	e.consts[name] = true
 	return val
 }
 
-// ToHash converts the environment's store to a Hash object
+// ToHash converts the environment's store to a Hash object, in the order the
+// names were defined
 func (e *Environment) ToHash() *Hash {
-	pairs := make(map[HashKey]HashPair)
-	for name, val := range e.store {
-		key := &String{Value: name}
-		pairs[key.HashKey()] = HashPair{Key: key, Value: val}
+	hash := NewHash()
+	for _, name := range e.names {
+		hash.SetString(name, e.store[name])
 	}
-	return &Hash{Pairs: pairs}
+	return hash
 }
 
 // IsConst checks if a variable is a constant
@@ -399,26 +818,171 @@ func (e *Environment) Update(name string, val Object) (Object, bool) {
 	return nil, false
 }
 
-// Break represents a break statement
-type Break struct{}
+// Break represents a break statement, aimed at the loop named Label or at
+// the innermost loop when Label is empty
+type Break struct {
+	Label string
+}
 
 func (b *Break) Type() ObjectType { return BREAK_OBJ }
 func (b *Break) Inspect() string  { return "break" }
 
-// Continue represents a continue statement
-type Continue struct{}
+// Continue represents a continue statement, aimed at the loop named Label or
+// at the innermost loop when Label is empty
+type Continue struct {
+	Label string
+}
 
 func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
 func (c *Continue) Inspect() string  { return "continue" }
 
-// Range represents a range like 0..10
+// Range is a lazy arithmetic sequence such as 0..10, 0..=10, 10..0 step -2
+// or 'a'..='z'. End is exclusive unless Inclusive is set, and a zero Step
+// counts up by one. Elements are computed on demand, never stored.
 type Range struct {
-	Start int64
-	End   int64
+	Start     int64
+	End       int64
+	Step      int64
+	Inclusive bool
+	IsChar    bool // elements are chars rather than ints
 }
 
 func (r *Range) Type() ObjectType { return RANGE_OBJ }
-func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+func (r *Range) Inspect() string {
+	var out bytes.Buffer
+	if r.IsChar {
+		fmt.Fprintf(&out, "%q", rune(r.Start))
+	} else {
+		fmt.Fprintf(&out, "%d", r.Start)
+	}
+	out.WriteString("..")
+	if r.Inclusive {
+		out.WriteString("=")
+	}
+	if r.IsChar {
+		fmt.Fprintf(&out, "%q", rune(r.End))
+	} else {
+		fmt.Fprintf(&out, "%d", r.End)
+	}
+	if r.Step != 0 && r.Step != 1 {
+		fmt.Fprintf(&out, " step %d", r.Step)
+	}
+	return out.String()
+}
+
+// StepSize returns the distance between consecutive elements
+func (r *Range) StepSize() int64 {
+	if r.Step == 0 {
+		return 1
+	}
+	return r.Step
+}
+
+// Len returns the number of elements in the range
+func (r *Range) Len() int64 {
+	step := r.StepSize()
+	// Distances are computed in uint64 so that ranges spanning most of the
+	// int64 space do not overflow
+	var span, stride uint64
+	if step > 0 {
+		if r.End < r.Start || (r.End == r.Start && !r.Inclusive) {
+			return 0
+		}
+		span, stride = uint64(r.End)-uint64(r.Start), uint64(step)
+	} else {
+		if r.End > r.Start || (r.End == r.Start && !r.Inclusive) {
+			return 0
+		}
+		span, stride = uint64(r.Start)-uint64(r.End), uint64(-step)
+	}
+	if !r.Inclusive {
+		span--
+	}
+	n := span / stride
+	if n >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n) + 1
+}
+
+// At returns the i-th value of the range, which must be within Len
+func (r *Range) At(i int64) int64 {
+	return r.Start + i*r.StepSize()
+}
+
+// Element returns the i-th element as an Integer or Char
+func (r *Range) Element(i int64) Object {
+	if r.IsChar {
+		return &Char{Value: rune(r.At(i))}
+	}
+	return &Integer{Value: r.At(i)}
+}
+
+// IndexOf returns the position of v in the range, or -1
+func (r *Range) IndexOf(v int64) int64 {
+	step := r.StepSize()
+	var offset, stride uint64
+	if step > 0 {
+		if v < r.Start {
+			return -1
+		}
+		offset, stride = uint64(v)-uint64(r.Start), uint64(step)
+	} else {
+		if v > r.Start {
+			return -1
+		}
+		offset, stride = uint64(r.Start)-uint64(v), uint64(-step)
+	}
+	if offset%stride != 0 || offset/stride >= uint64(r.Len()) {
+		return -1
+	}
+	return int64(offset / stride)
+}
+
+// Slice returns count elements as a new range, beginning at index start
+// and advancing step indices at a time
+func (r *Range) Slice(start, step, count int64) *Range {
+	newStep := r.StepSize() * step
+	if count <= 0 {
+		first := r.Start
+		if start >= 0 && start < r.Len() {
+			first = r.At(start)
+		}
+		return &Range{Start: first, End: first, Step: newStep, IsChar: r.IsChar}
+	}
+	return &Range{Start: r.At(start), End: r.At(start + (count-1)*step), Step: newStep, Inclusive: true, IsChar: r.IsChar}
+}
+
+// Reversed returns the same elements in the opposite order
+func (r *Range) Reversed() *Range {
+	n := r.Len()
+	if n == 0 {
+		return &Range{Start: r.Start, End: r.Start, IsChar: r.IsChar}
+	}
+	return &Range{Start: r.At(n - 1), End: r.Start, Step: -r.StepSize(), Inclusive: true, IsChar: r.IsChar}
+}
+
+// Iterator is a sequence produced one value at a time, such as a generator.
+// Next returns the following value, or false once the sequence is exhausted.
+// Close releases the sequence when a consumer stops early and may be nil.
+type Iterator struct {
+	Name  string
+	Next  func() (Object, bool)
+	Close func()
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "<" + it.Name + ">" }
+
+// Memoized is a function wrapped by @memo. Results are cached under the
+// hash key of the argument list, so equal arguments share an entry.
+type Memoized struct {
+	Fn    Object
+	Cache *Hash // results keyed by the array of arguments
+}
+
+func (m *Memoized) Type() ObjectType { return MEMOIZED_OBJ }
+func (m *Memoized) Inspect() string  { return "@memo " + m.Fn.Inspect() }
 
 // TypeChecker provides type validation utilities
 // CheckType validates if an object matches the expected type annotation
@@ -457,15 +1021,31 @@ func CheckType(obj Object, typeAnn *ast.TypeAnnotation) bool {
 		return ok // For now, just check if it's a hash; deeper checking can be added
 	}
 
+	// Handle set types
+	if typeName == "set" {
+		set, ok := obj.(*Set)
+		if !ok {
+			return false
+		}
+		if typeAnn.ElementType != nil {
+			for _, elem := range set.Elements() {
+				if !CheckType(elem, typeAnn.ElementType) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
 	// Handle basic types
 	switch typeName {
 	case "int":
-		_, ok := obj.(*Integer)
+		_, ok := ToBigInt(obj)
 		return ok
 	case "float":
 		// Allow int as float for convenience (like Go)
 		_, isFloat := obj.(*Float)
-		_, isInt := obj.(*Integer)
+		_, isInt := ToBigInt(obj)
 		return isFloat || isInt
 	case "string":
 		_, ok := obj.(*String)
@@ -507,6 +1087,9 @@ func CheckType(obj Object, typeAnn *ast.TypeAnnotation) bool {
 	case "void":
 		_, ok := obj.(*Null)
 		return ok
+	case "iterator":
+		_, ok := obj.(*Iterator)
+		return ok
 	default:
 		// Custom type (struct or enum) - check if it's a struct instance with matching name
 		si, ok := obj.(*StructInstance)
@@ -525,7 +1108,7 @@ func CheckType(obj Object, typeAnn *ast.TypeAnnotation) bool {
 // TypeName returns the type name of an object as a string
 func TypeName(obj Object) string {
 	switch obj := obj.(type) {
-	case *Integer:
+	case *Integer, *BigInteger:
 		return "int"
 	case *Float:
 		return "float"
@@ -543,18 +1126,24 @@ func TypeName(obj Object) string {
 		return "array"
 	case *Hash:
 		return "map"
+	case *Set:
+		return "set"
 	case *Null:
 		return "void"
 	case *Function:
 		return "function"
 	case *ArrowFunction:
 		return "function"
+	case *Memoized:
+		return "function"
 	case *StructInstance:
 		return obj.Struct.Name
 	case *EnumValue:
 		return obj.EnumName
 	case *Enum:
 		return "enum"
+	case *Iterator:
+		return "iterator"
 	default:
 		return string(obj.Type())
 	}
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -70,7 +74,7 @@ func TestObjectTypes(t *testing.T) {
 		{&Boolean{Value: true}, BOOLEAN_OBJ},
 		{&Null{}, NULL_OBJ},
 		{&Array{Elements: []Object{}}, ARRAY_OBJ},
-		{&Hash{Pairs: map[HashKey]HashPair{}}, HASH_OBJ},
+		{NewHash(), HASH_OBJ},
 		{&Error{Message: "error"}, ERROR_OBJ},
 		{&ReturnValue{Value: &Integer{Value: 5}}, RETURN_VALUE_OBJ},
 		{&Break{}, BREAK_OBJ},
@@ -264,16 +268,245 @@ func TestReturnValue(t *testing.T) {
 }
 
 func TestHashPairs(t *testing.T) {
-	key := &String{Value: "name"}
-	value := &String{Value: "Victoria"}
+	hash := NewHash()
+	hash.SetString("name", &String{Value: "Victoria"})
 
-	pairs := map[HashKey]HashPair{
-		key.HashKey(): {Key: key, Value: value},
+	if hash.Type() != HASH_OBJ {
+		t.Errorf("wrong type. got=%s, want=%s", hash.Type(), HASH_OBJ)
 	}
 
-	hash := &Hash{Pairs: pairs}
+	pair, ok := hash.GetString("name")
+	if !ok || pair.Value.Inspect() != "Victoria" {
+		t.Errorf("Get returned wrong pair. got=%+v (%t)", pair, ok)
+	}
+}
 
-	if hash.Type() != HASH_OBJ {
-		t.Errorf("wrong type. got=%s, want=%s", hash.Type(), HASH_OBJ)
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	for _, k := range []string{"c", "a", "b"} {
+		hash.SetString(k, &Integer{Value: 1})
+	}
+	hash.SetString("a", &Integer{Value: 2})
+
+	if got := hash.Inspect(); got != `{c: 1, a: 2, b: 1}` {
+		t.Errorf("updating a key should keep its position. got=%s", got)
+	}
+
+	c := &String{Value: "c"}
+	if !hash.Delete(c, c.HashKey()) {
+		t.Fatalf("Delete should report an existing key")
+	}
+	if hash.Delete(c, c.HashKey()) {
+		t.Errorf("Delete should report a missing key")
+	}
+	hash.SetString("c", &Integer{Value: 3})
+	if got := hash.Inspect(); got != `{a: 2, b: 1, c: 3}` {
+		t.Errorf("re-inserted key should move to the end. got=%s", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := &Integer{Value: int64(i)}
+		hash.Set(key, key.HashKey(), &Null{})
+	}
+	for i := 0; i < 99; i++ {
+		key := &Integer{Value: int64(i)}
+		hash.Delete(key, key.HashKey())
+	}
+	if hash.Len() != 4 {
+		t.Fatalf("wrong Len after deletes. got=%d", hash.Len())
+	}
+	if got := hash.Inspect(); got != `{a: 2, b: 1, c: 3, 99: null}` {
+		t.Errorf("order lost after compaction. got=%s", got)
+	}
+	last := &Integer{Value: 99}
+	if pair, ok := hash.Get(last, last.HashKey()); !ok || pair.Key.Inspect() != "99" {
+		t.Errorf("lookup broken after compaction. got=%+v (%t)", pair, ok)
+	}
+}
+
+func TestNewBigInteger(t *testing.T) {
+	small := NewBigInteger(big.NewInt(42))
+	if i, ok := small.(*Integer); !ok || i.Value != 42 {
+		t.Errorf("values that fit in int64 should be Integer. got=%T (%+v)", small, small)
+	}
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	obj := NewBigInteger(huge)
+	bi, ok := obj.(*BigInteger)
+	if !ok {
+		t.Fatalf("large values should be BigInteger. got=%T", obj)
+	}
+	if bi.Inspect() != "123456789012345678901234567890" {
+		t.Errorf("wrong Inspect. got=%s", bi.Inspect())
+	}
+
+	same, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	neg := new(big.Int).Neg(huge)
+	if bi.HashKey() != (&BigInteger{Value: same}).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if bi.HashKey() == (&BigInteger{Value: neg}).HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+
+	if TypeName(bi) != "int" {
+		t.Errorf("TypeName of big integer should be int. got=%s", TypeName(bi))
+	}
+}
+
+func TestEnvironmentToHashOrder(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("zeta", &Integer{Value: 1})
+	env.SetConst("alpha", &Integer{Value: 2})
+	env.Set("mid", &Integer{Value: 3})
+	env.Set("zeta", &Integer{Value: 4})
+
+	if got := env.ToHash().Inspect(); got != "{zeta: 4, alpha: 2, mid: 3}" {
+		t.Errorf("exports should keep declaration order. got=%s", got)
+	}
+}
+
+func TestHashKeyOf(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}
+	b := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}
+	c := &Array{Elements: []Object{&String{Value: "x"}, &Integer{Value: 1}}}
+
+	ka, ok := HashKeyOf(a)
+	if !ok {
+		t.Fatalf("array of hashable values should be a valid key")
+	}
+	if kb, _ := HashKeyOf(b); ka != kb {
+		t.Errorf("equal arrays have different hash keys")
+	}
+	if kc, _ := HashKeyOf(c); ka == kc {
+		t.Errorf("arrays in different order have the same hash key")
+	}
+
+	if _, ok := HashKeyOf(&Array{Elements: []Object{NewHash()}}); ok {
+		t.Errorf("array containing a hash should not be a valid key")
+	}
+
+	if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("integral float should share the integer's key")
+	}
+	if (&Float{Value: 2.5}).HashKey() == (&Float{Value: 2.25}).HashKey() {
+		t.Errorf("different floats have the same key")
+	}
+
+	// A stored key freezes the caller's array until every hash holding it
+	// lets go of it
+	hash := NewHash()
+	hash.Set(a, ka, &Integer{Value: 1})
+	other := NewHash()
+	other.Set(b, ka, &Integer{Value: 2})
+	if !a.Frozen() || !b.Frozen() {
+		t.Errorf("arrays stored as keys should be frozen")
+	}
+	if stored := hash.Pairs()[0].Key; stored != a {
+		t.Errorf("the hash should store the key it was given")
+	}
+	hash.Set(b, ka, &Integer{Value: 3})
+	hash.Delete(b, ka)
+	if !b.Frozen() || a.Frozen() {
+		t.Errorf("deleting a key should only release the array stored. a=%d b=%d", a.KeyRefs, b.KeyRefs)
+	}
+	other.Delete(a, ka)
+	if b.Frozen() {
+		t.Errorf("an array no hash holds should be changeable. got KeyRefs=%d", b.KeyRefs)
+	}
+
+	copied := CopyKey(a).(*Array)
+	if copied == a || copied.Inspect() != a.Inspect() {
+		t.Errorf("CopyKey should return an equal, separate array. got=%s", copied.Inspect())
+	}
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	// Different keys forced onto the same hash must stay apart
+	same := HashKey{Type: ARRAY_OBJ, Value: 42}
+	x := &Array{Elements: []Object{&Integer{Value: 1}}}
+	y := &Array{Elements: []Object{&String{Value: "1"}}}
+	z := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	hash := NewHash()
+	hash.Set(x, same, &String{Value: "x"})
+	hash.Set(y, same, &String{Value: "y"})
+	if hash.Len() != 2 {
+		t.Fatalf("colliding keys should not overwrite each other. got Len=%d", hash.Len())
+	}
+	if pair, ok := hash.Get(z, same); !ok || pair.Value.Inspect() != "x" {
+		t.Errorf("lookup should compare keys structurally. got=%+v (%t)", pair, ok)
+	}
+	if pair, ok := hash.Get(y, same); !ok || pair.Value.Inspect() != "y" {
+		t.Errorf("wrong pair for the second key. got=%+v (%t)", pair, ok)
+	}
+
+	if !hash.Delete(z, same) {
+		t.Fatalf("Delete should find the equal key")
+	}
+	if _, ok := hash.Get(x, same); ok {
+		t.Errorf("deleted key is still present")
+	}
+	if pair, ok := hash.Get(y, same); !ok || pair.Value.Inspect() != "y" {
+		t.Errorf("deleting one key should keep the other. got=%+v (%t)", pair, ok)
+	}
+
+	s1, s2 := &String{Value: "a"}, &String{Value: "b"}
+	byName := NewHash()
+	byName.Set(s1, same, &Boolean{Value: true})
+	if _, ok := byName.Get(s2, same); ok {
+		t.Errorf("different strings with the same hash should not match")
+	}
+}
+
+func TestRangeArithmetic(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		inspect  string
+		length   int64
+		last     int64
+		reversed string
+	}{
+		{&Range{Start: 0, End: 5}, "0..5", 5, 4, "4..=0 step -1"},
+		{&Range{Start: 0, End: 5, Inclusive: true}, "0..=5", 6, 5, "5..=0 step -1"},
+		{&Range{Start: 10, End: 0, Step: -3}, "10..0 step -3", 4, 1, "1..=10 step 3"},
+		{&Range{Start: 1, End: 10, Step: 4, Inclusive: true}, "1..=10 step 4", 3, 9, "9..=1 step -4"},
+		{&Range{Start: 'a', End: 'e', Inclusive: true, IsChar: true}, "'a'..='e'", 5, 'e', "'e'..='a' step -1"},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: math.MaxInt64}, "-9223372036854775808..9223372036854775807 step 9223372036854775807", 3, math.MaxInt64 - 1, "9223372036854775806..=-9223372036854775808 step -9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		if tt.r.Inspect() != tt.inspect {
+			t.Errorf("wrong Inspect. expected=%q, got=%q", tt.inspect, tt.r.Inspect())
+		}
+		if tt.r.Len() != tt.length {
+			t.Errorf("%s: wrong Len. expected=%d, got=%d", tt.inspect, tt.length, tt.r.Len())
+		}
+		if last := tt.r.At(tt.r.Len() - 1); last != tt.last {
+			t.Errorf("%s: wrong last element. expected=%d, got=%d", tt.inspect, tt.last, last)
+		}
+		if tt.r.Reversed().Inspect() != tt.reversed {
+			t.Errorf("%s: wrong Reversed. expected=%q, got=%q", tt.inspect, tt.reversed, tt.r.Reversed().Inspect())
+		}
+		if tt.r.IndexOf(tt.last) != tt.length-1 {
+			t.Errorf("%s: IndexOf(last) = %d", tt.inspect, tt.r.IndexOf(tt.last))
+		}
+	}
+
+	empty := []*Range{{Start: 5, End: 5}, {Start: 5, End: 0}, {Start: 0, End: 5, Step: -1}}
+	for _, r := range empty {
+		if r.Len() != 0 {
+			t.Errorf("%s: expected an empty range, got Len %d", r.Inspect(), r.Len())
+		}
+	}
+
+	r := &Range{Start: 0, End: 20, Step: 5}
+	for v, want := range map[int64]int64{0: 0, 15: 3, 20: -1, 3: -1, -5: -1} {
+		if got := r.IndexOf(v); got != want {
+			t.Errorf("IndexOf(%d) = %d, want %d", v, got, want)
+		}
+	}
+	if got := r.Slice(1, 1, 2).Inspect(); got != "5..=10 step 5" {
+		t.Errorf("wrong Slice. got=%q", got)
 	}
 }
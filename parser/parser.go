@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 	"victoria/ast"
 	"victoria/errors"
 	"victoria/lexer"
@@ -12,53 +14,77 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	ARROW_PREC  // =>
-	TERNARY     // ?:
-	OR_PREC     // || or
-	AND_PREC    // && and
-	ASSIGN      // =
-	EQUALS      // ==
-	LESSGREATER // > or <
-	RANGE_PREC  // ..
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
-	CALL        // myFunction(X)
-	INDEX       // array[index]
-	POSTFIX     // i++
-	DOT         // struct.field
+	ARROW_PREC   // =>
+	TERNARY      // ?:
+	COALESCE     // ??
+	OR_PREC      // || or
+	AND_PREC     // && and
+	ASSIGN       // =
+	BIT_OR_PREC  // |
+	BIT_XOR_PREC // ^
+	BIT_AND_PREC // &
+	EQUALS       // ==
+	LESSGREATER  // > or <
+	PIPE_PREC    // |>
+	RANGE_PREC   // ..
+	SHIFT        // << >>
+	SUM          // +
+	PRODUCT      // *
+	PREFIX       // -X or !X
+	POWER_PREC   // ** (binds tighter than unary minus: -2 ** 2 == -4)
+	CALL         // myFunction(X)
+	INDEX        // array[index]
+	POSTFIX      // i++
+	DOT          // struct.field
 )
 
 var precedences = map[token.TokenType]int{
-	token.ARROW:           ARROW_PREC,
-	token.EQ:              EQUALS,
-	token.NOT_EQ:          EQUALS,
-	token.LT:              LESSGREATER,
-	token.GT:              LESSGREATER,
-	token.LTE:             LESSGREATER,
-	token.GTE:             LESSGREATER,
-	token.PLUS:            SUM,
-	token.MINUS:           SUM,
-	token.SLASH:           PRODUCT,
-	token.ASTERISK:        PRODUCT,
-	token.MODULO:          PRODUCT,
-	token.LPAREN:          CALL,
-	token.LBRACKET:        INDEX,
-	token.DOT:             DOT,
-	token.ASSIGN:          ASSIGN,
-	token.PLUS_ASSIGN:     ASSIGN,
-	token.MINUS_ASSIGN:    ASSIGN,
-	token.ASTERISK_ASSIGN: ASSIGN,
-	token.SLASH_ASSIGN:    ASSIGN,
-	token.MODULO_ASSIGN:   ASSIGN,
-	token.INC:             POSTFIX,
-	token.DEC:             POSTFIX,
-	token.AND:             AND_PREC,
-	token.OR:              OR_PREC,
-	token.AND_AND:         AND_PREC,
-	token.OR_OR:           OR_PREC,
-	token.QUESTION:        TERNARY,
-	token.RANGE:           RANGE_PREC,
+	token.ARROW:              ARROW_PREC,
+	token.EQ:                 EQUALS,
+	token.NOT_EQ:             EQUALS,
+	token.LT:                 LESSGREATER,
+	token.GT:                 LESSGREATER,
+	token.LTE:                LESSGREATER,
+	token.GTE:                LESSGREATER,
+	token.PLUS:               SUM,
+	token.MINUS:              SUM,
+	token.SLASH:              PRODUCT,
+	token.ASTERISK:           PRODUCT,
+	token.MODULO:             PRODUCT,
+	token.DIV:                PRODUCT,
+	token.POWER:              POWER_PREC,
+	token.LPAREN:             CALL,
+	token.LBRACKET:           INDEX,
+	token.DOT:                DOT,
+	token.ASSIGN:             ASSIGN,
+	token.PLUS_ASSIGN:        ASSIGN,
+	token.MINUS_ASSIGN:       ASSIGN,
+	token.ASTERISK_ASSIGN:    ASSIGN,
+	token.SLASH_ASSIGN:       ASSIGN,
+	token.MODULO_ASSIGN:      ASSIGN,
+	token.POWER_ASSIGN:       ASSIGN,
+	token.BIT_AND:            BIT_AND_PREC,
+	token.BIT_OR:             BIT_OR_PREC,
+	token.BIT_XOR:            BIT_XOR_PREC,
+	token.SHIFT_LEFT:         SHIFT,
+	token.SHIFT_RIGHT:        SHIFT,
+	token.BIT_AND_ASSIGN:     ASSIGN,
+	token.BIT_OR_ASSIGN:      ASSIGN,
+	token.BIT_XOR_ASSIGN:     ASSIGN,
+	token.SHIFT_LEFT_ASSIGN:  ASSIGN,
+	token.SHIFT_RIGHT_ASSIGN: ASSIGN,
+	token.INC:                POSTFIX,
+	token.DEC:                POSTFIX,
+	token.AND:                AND_PREC,
+	token.OR:                 OR_PREC,
+	token.AND_AND:            AND_PREC,
+	token.OR_OR:              OR_PREC,
+	token.QUESTION:           TERNARY,
+	token.COALESCE:           COALESCE,
+	token.QUESTION_DOT:       DOT,
+	token.PIPE:               PIPE_PREC,
+	token.RANGE:              RANGE_PREC,
+	token.RANGE_INCL:         RANGE_PREC,
 }
 
 type (
@@ -78,6 +104,22 @@ type Parser struct {
 	peekToken2 token.Token
 	peekToken3 token.Token
 
+	// funcDepth counts the function bodies being parsed and yieldSeen records
+	// whether the innermost one contains a yield, making it a generator
+	funcDepth int
+	yieldSeen bool
+
+	// loopLabels holds the labels of the loops enclosing the statement
+	// being parsed, innermost last, so break and continue can check theirs
+	loopLabels []string
+
+	// notes are suggestions that do not stop the program from running
+	notes []*errors.VictoriaError
+
+	// blockDepth counts the blocks enclosing the statement being parsed;
+	// test blocks are only allowed where it is zero
+	blockDepth int
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -96,6 +138,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.NULL_KW, p.parseNull)
@@ -103,6 +146,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.SET_LBRACE, p.parseSetLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral) // Can be hash or block, but in expression context usually hash or struct init? No, struct init starts with IDENT.
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
 	p.registerPrefix(token.FOR, p.parseForExpression)
@@ -131,6 +175,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.DIV, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parsePowerExpression)
 	p.registerInfix(token.MODULO, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
@@ -145,8 +191,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.PLUS_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.MINUS_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.POWER_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.SLASH_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.MODULO_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.INC, p.parsePostfixExpression)
 	p.registerInfix(token.DEC, p.parsePostfixExpression)
 	p.registerInfix(token.AND, p.parseInfixExpression)
@@ -154,7 +211,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.AND_AND, p.parseInfixExpression)
 	p.registerInfix(token.OR_OR, p.parseInfixExpression)
 	p.registerInfix(token.QUESTION, p.parseTernaryExpression)
+	p.registerInfix(token.QUESTION_DOT, p.parseOptionalChain)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
 	p.registerInfix(token.RANGE, p.parseRangeExpression)
+	p.registerInfix(token.RANGE_INCL, p.parseRangeExpression)
 	p.registerInfix(token.ARROW, p.parseArrowFunction)
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -199,6 +260,12 @@ func (p *Parser) RichErrors() []*errors.VictoriaError {
 	return p.richErrors
 }
 
+// Notes returns suggestions found while parsing, such as functions that
+// would benefit from @memo. They are informational and never block a run.
+func (p *Parser) Notes() []*errors.VictoriaError {
+	return p.notes
+}
+
 // SetSource sets the source code for error reporting
 func (p *Parser) SetSource(source string, filename string) {
 	p.sourceCode = source
@@ -266,9 +333,35 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	p.collectDirectiveErrors()
+	if !p.HasErrors() {
+		p.suggestMemoization(program)
+		p.warnNegativeModulo(program)
+	}
+
 	return program
 }
 
+// collectDirectiveErrors reports errors found by the lexer's preprocessor
+func (p *Parser) collectDirectiveErrors() {
+	for _, de := range p.l.DirectiveErrors() {
+		loc := errors.SourceLocation{
+			Line:      de.Line,
+			Column:    de.Column,
+			EndColumn: de.EndColumn,
+			Filename:  p.filename,
+		}
+		var richErr *errors.VictoriaError
+		if de.Directive == "#make" {
+			richErr = errors.MakeDirectiveError(de.Message, loc, p.sourceCode)
+		} else {
+			richErr = errors.ConditionalDirectiveError(de.Message, loc, p.sourceCode)
+		}
+		p.errors = append(p.errors, fmt.Sprintf("%s: %s", de.Directive, de.Message))
+		p.richErrors = append(p.richErrors, richErr)
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
@@ -291,6 +384,27 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseBreakStatement()
 	case token.CONTINUE:
 		return p.parseContinueStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
+	case token.ASSERT:
+		return p.parseAssertStatement()
+	case token.AT:
+		return p.parseDecoratedDeclaration()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) && (p.peekToken2.Type == token.FOR || p.peekToken2.Type == token.WHILE) {
+			return p.parseLabeledLoop()
+		}
+		// test and bench are not keywords, so they stay usable as names
+		// outside of test "name" { ... } and bench "name" { ... }
+		if p.peekTokenIs(token.STRING) && p.peekToken2.Type == token.LBRACE {
+			switch p.curToken.Literal {
+			case "test":
+				return p.parseTestBlock()
+			case "bench":
+				return p.parseBenchBlock()
+			}
+		}
+		return p.parseExpressionStatement()
 	case token.FUNCTION:
 		// Check if it is a method definition: def Struct.Method()
 		if p.peekTokenIs(token.IDENT) {
@@ -604,7 +718,7 @@ func (p *Parser) parseFunctionOrMethodDeclaration() ast.Statement {
 			return nil
 		}
 
-		methodDef.Body = p.parseBlockStatement()
+		methodDef.Body, methodDef.IsGenerator = p.parseFunctionBody()
 		return methodDef
 
 	} else {
@@ -634,7 +748,7 @@ func (p *Parser) parseFunctionOrMethodDeclaration() ast.Statement {
 			return nil
 		}
 
-		defineLit.Body = p.parseBlockStatement()
+		defineLit.Body, defineLit.IsGenerator = p.parseFunctionBody()
 
 		// Wrap in LetStatement
 		letStmt := &ast.LetStatement{
@@ -777,6 +891,13 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		// Too large for int64: keep it as an arbitrary-precision literal
+		if bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = bigValue
+			return lit
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -789,7 +910,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 		}
 		richErr := errors.ParseError(fmt.Sprintf("invalid integer literal '%s'", p.curToken.Literal), loc, p.sourceCode).
 			WithCode("E0103").
-			WithHelp("integers must be valid numeric values within the supported range")
+			WithHelp("integers are decimal (1_000_000), hex (0xFF), binary (0b1010) or octal (0o755); `_` may only separate digits")
 		p.richErrors = append(p.richErrors, richErr)
 		return nil
 	}
@@ -872,6 +993,20 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parsePowerExpression parses ** as right-associative: 2 ** 3 ** 2 == 2 ** 9
+func (p *Parser) parsePowerExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(POWER_PREC - 1)
+
+	return expression
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	startToken := p.curToken
 	p.nextToken()
@@ -998,10 +1133,11 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		if p.peekTokenIs(token.IF) {
 			// else if
 			p.nextToken() // consume 'if'
+			ifToken := p.curToken
 			// Recursively parse the if expression
 			expression.Alternative = &ast.BlockStatement{
 				Statements: []ast.Statement{
-					&ast.ExpressionStatement{Expression: p.parseIfExpression()},
+					&ast.ExpressionStatement{Token: ifToken, Expression: p.parseIfExpression()},
 				},
 			}
 		} else {
@@ -1018,6 +1154,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.blockDepth++
 
 	p.nextToken()
 
@@ -1029,6 +1166,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	p.blockDepth--
 	return block
 }
 
@@ -1062,11 +1200,70 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body, lit.IsGenerator = p.parseFunctionBody()
 
 	return lit
 }
 
+// parseDecoratedDeclaration parses one or more decorators and the function
+// declaration they apply to: @memo define fib(n) { ... }
+func (p *Parser) parseDecoratedDeclaration() ast.Statement {
+	atToken := p.curToken
+	decorators := []ast.Expression{}
+
+	for p.curTokenIs(token.AT) {
+		p.nextToken()
+		decorator := p.parseExpression(LOWEST)
+		if decorator == nil {
+			return nil
+		}
+		decorators = append(decorators, decorator)
+		p.nextToken()
+	}
+
+	if p.curTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT) {
+		stmt := p.parseFunctionOrMethodDeclaration()
+		if stmt == nil {
+			return nil
+		}
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			let.Value.(*ast.FunctionLiteral).Decorators = decorators
+			return let
+		}
+	}
+
+	msg := "a decorator must be followed by a function declaration"
+	p.errors = append(p.errors, msg)
+
+	loc := errors.SourceLocation{
+		Line:      atToken.Line,
+		Column:    atToken.Column,
+		EndColumn: atToken.EndColumn,
+		Filename:  p.filename,
+	}
+	richErr := errors.ParseError(msg, loc, p.sourceCode).
+		WithCode("E0107").
+		WithNote("decorators wrap named functions; struct methods and other statements cannot be decorated").
+		WithHelp("write the decorator on the line before `define name(...) { ... }`")
+	p.richErrors = append(p.richErrors, richErr)
+	return nil
+}
+
+// parseFunctionBody parses the block of a function and reports whether it
+// yields, in which case the function is a generator
+func (p *Parser) parseFunctionBody() (*ast.BlockStatement, bool) {
+	outerYieldSeen, outerLabels := p.yieldSeen, p.loopLabels
+	p.yieldSeen, p.loopLabels = false, nil
+	p.funcDepth++
+
+	body := p.parseBlockStatement()
+	isGenerator := p.yieldSeen
+
+	p.funcDepth--
+	p.yieldSeen, p.loopLabels = outerYieldSeen, outerLabels
+	return body, isGenerator
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -1158,6 +1355,24 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
 	// Handle basic types or custom type names (IDENT)
 	if token.IsTypeKeyword(p.curToken.Type) {
 		typeAnn.TypeName = token.TypeKeywordToString(p.curToken.Type)
+	} else if p.curTokenIs(token.IDENT) && p.curToken.Literal == "set" && p.peekTokenIs(token.LBRACKET) {
+		// Set type: set[elementType]
+		p.nextToken()
+		p.nextToken() // move to element type
+		typeAnn.ElementType = &ast.TypeAnnotation{Token: p.curToken}
+		if token.IsTypeKeyword(p.curToken.Type) {
+			typeAnn.ElementType.TypeName = token.TypeKeywordToString(p.curToken.Type)
+		} else if p.curTokenIs(token.IDENT) {
+			typeAnn.ElementType.TypeName = p.curToken.Literal
+		} else {
+			msg := fmt.Sprintf("expected type in set element, got %s", p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		typeAnn.TypeName = "set"
 	} else if p.curTokenIs(token.IDENT) {
 		// Custom type like a struct name
 		typeAnn.TypeName = p.curToken.Literal
@@ -1295,21 +1510,34 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseArrayElements()
-	return array
-}
-
-// parseArrayElements parses array elements including spread expressions
-func (p *Parser) parseArrayElements() []ast.Expression {
-	list := []ast.Expression{}
 
 	if p.peekTokenIs(token.RBRACKET) {
 		p.nextToken()
-		return list
+		array.Elements = []ast.Expression{}
+		return array
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	first := p.parseExpression(LOWEST)
+
+	// [x * x for x in xs]
+	if p.peekTokenIs(token.FOR) {
+		comp := &ast.ListComprehension{Token: array.Token, Element: first}
+		comp.Clauses = p.parseComprehensionClauses()
+		if comp.Clauses == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return comp
+	}
+
+	array.Elements = p.parseArrayElements(first)
+	return array
+}
+
+// parseArrayElements parses the elements after first, including spread
+// expressions, up to the closing bracket
+func (p *Parser) parseArrayElements(first ast.Expression) []ast.Expression {
+	list := []ast.Expression{first}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
@@ -1324,24 +1552,21 @@ func (p *Parser) parseArrayElements() []ast.Expression {
 	return list
 }
 
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken}
+	set.Elements = p.parseExpressionList(token.RBRACE)
+	return set
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	bracketToken := p.curToken
 
 	p.nextToken()
 
-	// Check for slice expression: arr[start:end], arr[:end], arr[start:]
-	// If current token is COLON, it's [:end]
+	// Check for slice expression: arr[start:end], arr[:end], arr[start:],
+	// optionally with a step: arr[::-1], arr[1:10:2]
 	if p.curTokenIs(token.COLON) {
-		// [:end] case
-		sliceExp := &ast.SliceExpression{Token: bracketToken, Left: left, Start: nil}
-		p.nextToken()
-		if !p.curTokenIs(token.RBRACKET) {
-			sliceExp.End = p.parseExpression(LOWEST)
-			if !p.expectPeek(token.RBRACKET) {
-				return nil
-			}
-		}
-		return sliceExp
+		return p.parseSliceTail(&ast.SliceExpression{Token: bracketToken, Left: left})
 	}
 
 	// Parse the first expression
@@ -1349,18 +1574,8 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	// Check if next token is COLON (slice) or RBRACKET (index)
 	if p.peekTokenIs(token.COLON) {
-		// Slice expression: arr[start:end] or arr[start:]
-		sliceExp := &ast.SliceExpression{Token: bracketToken, Left: left, Start: firstExpr}
-		p.nextToken() // consume COLON
-		p.nextToken() // move to end expression or RBRACKET
-
-		if !p.curTokenIs(token.RBRACKET) {
-			sliceExp.End = p.parseExpression(LOWEST)
-			if !p.expectPeek(token.RBRACKET) {
-				return nil
-			}
-		}
-		return sliceExp
+		p.nextToken() // move to COLON
+		return p.parseSliceTail(&ast.SliceExpression{Token: bracketToken, Left: left, Start: firstExpr})
 	}
 
 	// Regular index expression
@@ -1373,6 +1588,28 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseSliceTail parses the optional end and step of a slice, starting at
+// the ':' after the start index, through the closing bracket
+func (p *Parser) parseSliceTail(sliceExp *ast.SliceExpression) ast.Expression {
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		sliceExp.End = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			sliceExp.Step = p.parseExpression(LOWEST)
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return sliceExp
+}
+
 // parseSpreadExpression parses ...expression
 func (p *Parser) parseSpreadExpression() ast.Expression {
 	spreadToken := p.curToken
@@ -1397,6 +1634,17 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
+		// {k: v for k in xs}
+		if len(hash.Keys) == 0 && p.peekTokenIs(token.FOR) {
+			comp := &ast.HashComprehension{Token: hash.Token, Key: key, Value: value}
+			comp.Clauses = p.parseComprehensionClauses()
+			if comp.Clauses == nil || !p.expectPeek(token.RBRACE) {
+				return nil
+			}
+			return comp
+		}
+
+		hash.Keys = append(hash.Keys, key)
 		hash.Pairs[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
@@ -1411,6 +1659,47 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// parseComprehensionClauses parses one or more `for x in xs if cond`
+// clauses, starting with the peek token at the first 'for'
+func (p *Parser) parseComprehensionClauses() []*ast.ComprehensionClause {
+	clauses := []*ast.ComprehensionClause{}
+
+	for p.peekTokenIs(token.FOR) {
+		p.nextToken()
+		clause := &ast.ComprehensionClause{Token: p.curToken}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		clause.Item = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			clause.Index = clause.Item
+			clause.Item = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+
+		if !p.expectPeek(token.IN) {
+			return nil
+		}
+		p.nextToken()
+		clause.Iterable = p.parseExpression(LOWEST)
+
+		for p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			clause.Conditions = append(clause.Conditions, p.parseExpression(LOWEST))
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	return clauses
+}
+
 func (p *Parser) parseWhileExpression() ast.Expression {
 	// while (condition) { body }
 	expr := &ast.WhileExpression{Token: p.curToken}
@@ -1572,6 +1861,54 @@ func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
 	}
 }
 
+// parsePipeExpression parses value |> stage. The stage is usually a call,
+// which receives value as its first argument, but may be anything that
+// evaluates to a function, including an arrow function.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	expr := &ast.PipeExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	expr.Right = p.parseExpression(PIPE_PREC)
+
+	// x => body binds looser than |>, so take it here rather than letting
+	// it wrap the whole pipeline
+	if ident, ok := expr.Right.(*ast.Identifier); ok && p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		expr.Right = p.parseArrowFunction(ident)
+	}
+
+	return expr
+}
+
+// parseOptionalChain parses a?.b and a?.[i], which evaluate to null instead
+// of failing when a is null or the property or index is absent
+func (p *Parser) parseOptionalChain(left ast.Expression) ast.Expression {
+	if p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+		switch exp := p.parseIndexExpression(left).(type) {
+		case *ast.IndexExpression:
+			exp.Optional = true
+			return exp
+		case *ast.SliceExpression:
+			exp.Optional = true
+			return exp
+		}
+		return nil
+	}
+
+	tok := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	return &ast.InfixExpression{
+		Token:    tok,
+		Left:     left,
+		Operator: "?.",
+		Right:    &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+}
+
 func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
 	return &ast.PostfixExpression{
 		Token:    p.curToken,
@@ -1591,8 +1928,73 @@ func (p *Parser) parsePrefixIncDec() ast.Expression {
 	}
 }
 
+// parseLabeledLoop parses "name: for ..." or "name: while ...". The label is
+// in scope for break and continue inside the loop's body.
+func (p *Parser) parseLabeledLoop() ast.Statement {
+	label := p.curToken.Literal
+	p.nextToken() // :
+	p.nextToken() // for or while
+
+	p.loopLabels = append(p.loopLabels, label)
+	stmt := p.parseExpressionStatement()
+	p.loopLabels = p.loopLabels[:len(p.loopLabels)-1]
+
+	if stmt == nil {
+		return nil
+	}
+	switch loop := stmt.Expression.(type) {
+	case *ast.WhileExpression:
+		loop.Label = label
+	case *ast.ForExpression:
+		loop.Label = label
+	case *ast.ForInIndexExpression:
+		loop.Label = label
+	case *ast.CForExpression:
+		loop.Label = label
+	}
+	return stmt
+}
+
+// parseLoopLabel parses the optional label after break or continue, which
+// must be on the same line and name an enclosing loop
+func (p *Parser) parseLoopLabel() string {
+	if !p.peekTokenIs(token.IDENT) || p.peekToken.Line != p.curToken.Line {
+		return ""
+	}
+	keyword := p.curToken.Literal
+	p.nextToken()
+	label := p.curToken.Literal
+
+	for _, known := range p.loopLabels {
+		if known == label {
+			return label
+		}
+	}
+
+	msg := fmt.Sprintf("unknown loop label '%s' in %s", label, keyword)
+	p.errors = append(p.errors, msg)
+
+	loc := errors.SourceLocation{
+		Line:      p.curToken.Line,
+		Column:    p.curToken.Column,
+		EndColumn: p.curToken.EndColumn,
+		Filename:  p.filename,
+	}
+	help := fmt.Sprintf("label the loop to %s with `%s: for ...` or `%s: while ...`", keyword, label, label)
+	if len(p.loopLabels) > 0 {
+		help = fmt.Sprintf("the enclosing loops are labeled %s", strings.Join(p.loopLabels, ", "))
+	}
+	richErr := errors.ParseError(msg, loc, p.sourceCode).
+		WithCode("E0106").
+		WithNote("a label can only be used inside the loop it names, and not from a function defined in that loop").
+		WithHelp(help)
+	p.richErrors = append(p.richErrors, richErr)
+	return label
+}
+
 func (p *Parser) parseBreakStatement() *ast.BreakStatement {
 	stmt := &ast.BreakStatement{Token: p.curToken}
+	stmt.Label = p.parseLoopLabel()
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -1601,9 +2003,116 @@ func (p *Parser) parseBreakStatement() *ast.BreakStatement {
 
 func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
 	stmt := &ast.ContinueStatement{Token: p.curToken}
+	stmt.Label = p.parseLoopLabel()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+
+	if p.funcDepth == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+
+		loc := errors.SourceLocation{
+			Line:      p.curToken.Line,
+			Column:    p.curToken.Column,
+			EndColumn: p.curToken.EndColumn,
+			Filename:  p.filename,
+		}
+		richErr := errors.ParseError("yield outside of a function", loc, p.sourceCode).
+			WithCode("E0105").
+			WithHelp("yield turns the enclosing function into a generator; move it into a `define` body")
+		p.richErrors = append(p.richErrors, richErr)
+	}
+	p.yieldSeen = true
+
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTestBlock() *ast.TestBlock {
+	block := &ast.TestBlock{Token: p.curToken}
+	p.checkTopLevelBlock("test", "each test runs on its own")
+
+	p.nextToken()
+	block.Name = lexer.Unescape(p.curToken.Literal)
+	p.nextToken()
+	block.Body = p.parseBlockStatement()
+
+	return block
+}
+
+func (p *Parser) parseBenchBlock() *ast.BenchBlock {
+	block := &ast.BenchBlock{Token: p.curToken}
+	p.checkTopLevelBlock("bench", "each benchmark is run and measured on its own")
+
+	p.nextToken()
+	block.Name = lexer.Unescape(p.curToken.Literal)
+	p.nextToken()
+	block.Body = p.parseBlockStatement()
+
+	return block
+}
+
+// checkTopLevelBlock reports a test or bench block, at the current token,
+// that is nested inside another block
+func (p *Parser) checkTopLevelBlock(kind, reason string) {
+	if p.blockDepth == 0 {
+		return
+	}
+	msg := kind + " blocks must be at the top level of a file"
+	p.errors = append(p.errors, msg)
+
+	loc := errors.SourceLocation{
+		Line:      p.curToken.Line,
+		Column:    p.curToken.Column,
+		EndColumn: p.curToken.EndColumn,
+		Filename:  p.filename,
+	}
+	richErr := errors.ParseError(msg, loc, p.sourceCode).
+		WithCode("E0108").
+		WithNote(reason + ", so it cannot sit inside a function, loop or other block").
+		WithHelp("move the " + kind + " block out to the top level")
+	p.richErrors = append(p.richErrors, richErr)
+}
+
+func (p *Parser) parseAssertStatement() *ast.AssertStatement {
+	stmt := &ast.AssertStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Start = p.curToken
+	stmt.Condition = p.parseExpression(LOWEST)
+	if stmt.Condition == nil {
+		return nil
+	}
+	stmt.End = p.curToken
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Message = p.parseExpression(LOWEST)
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+
 	return stmt
 }
 
@@ -1678,13 +2187,22 @@ func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression
 
 func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
 	expr := &ast.RangeExpression{
-		Token: p.curToken,
-		Start: start,
+		Token:     p.curToken,
+		Start:     start,
+		Inclusive: p.curTokenIs(token.RANGE_INCL),
 	}
 
 	p.nextToken()
 	expr.End = p.parseExpression(RANGE_PREC)
 
+	// step is only a keyword right after a range on the same line, so it
+	// stays usable as a name, including at the start of the next statement
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "step" && p.peekToken.Line == p.curToken.Line {
+		p.nextToken()
+		p.nextToken()
+		expr.Step = p.parseExpression(RANGE_PREC)
+	}
+
 	return expr
 }
 
@@ -1743,3 +2261,137 @@ func (p *Parser) parseArrowFunction(left ast.Expression) ast.Expression {
 		Body:       body,
 	}
 }
+
+// suggestMemoization adds an N0001 note for every named function that calls
+// itself at least twice with shrinking arguments, like fib(n - 1) + fib(n - 2).
+// Such functions recompute the same calls exponentially often and are the
+// ones @memo is for; functions that are already decorated are left alone.
+func (p *Parser) suggestMemoization(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		let, ok := node.(*ast.LetStatement)
+		if !ok {
+			return true
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok || fn.Name == "" || len(fn.Decorators) > 0 || !hasOverlappingRecursion(fn) {
+			return true
+		}
+		loc := errors.SourceLocation{
+			Line:      let.Name.Token.Line,
+			Column:    let.Name.Token.Column,
+			EndColumn: let.Name.Token.EndColumn,
+			Filename:  p.filename,
+		}
+		p.notes = append(p.notes, errors.MemoizationSuggestion(fn.Name, loc, p.sourceCode))
+		return true
+	})
+}
+
+// warnNegativeModulo adds a W0005 warning for every % with a negative
+// literal operand, since % truncates like C and Go and gives a negative
+// remainder where Python would not
+func (p *Parser) warnNegativeModulo(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || infix.Operator != "%" || !isNegativeLiteral(infix.Left) && !isNegativeLiteral(infix.Right) {
+			return true
+		}
+		loc := errors.SourceLocation{
+			Line:      infix.Token.Line,
+			Column:    infix.Token.Column,
+			EndColumn: infix.Token.EndColumn,
+			Filename:  p.filename,
+		}
+		p.notes = append(p.notes, errors.ModuloWithNegativeError(loc, p.sourceCode))
+		return true
+	})
+}
+
+// isNegativeLiteral reports whether expr is a minus sign on a number literal
+func isNegativeLiteral(expr ast.Expression) bool {
+	prefix, ok := expr.(*ast.PrefixExpression)
+	if !ok || prefix.Operator != "-" {
+		return false
+	}
+	switch prefix.Right.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return true
+	}
+	return false
+}
+
+// hasOverlappingRecursion reports whether fn makes two or more different
+// calls to itself that pass the same parameter in each position, each
+// possibly plus or minus a constant, with at least one of them counting
+// down. fib(n - 1) + fib(n - 2) qualifies; hanoi(n - 1, a, c, b) +
+// hanoi(n - 1, c, b, a) does not, since its calls reorder the other
+// parameters and so never repeat one another.
+func hasOverlappingRecursion(fn *ast.FunctionLiteral) bool {
+	params := map[string]bool{}
+	for _, param := range fn.Parameters {
+		params[param.Value] = true
+	}
+	for _, param := range fn.TypedParameters {
+		params[param.Name.Value] = true
+	}
+
+	// calls groups the distinct calls by the parameter in each position
+	calls := map[string]map[string]bool{}
+	shrinking := map[string]bool{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		if inner, ok := node.(*ast.FunctionLiteral); ok && inner != fn {
+			return false
+		}
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		callee, ok := call.Function.(*ast.Identifier)
+		if !ok || callee.Value != fn.Name || len(call.Arguments) == 0 {
+			return true
+		}
+		bases := make([]string, len(call.Arguments))
+		shrinks := false
+		for i, arg := range call.Arguments {
+			base, step, ok := parameterStep(arg, params)
+			if !ok {
+				return true
+			}
+			bases[i] = base
+			shrinks = shrinks || step
+		}
+		key := strings.Join(bases, ",")
+		if calls[key] == nil {
+			calls[key] = map[string]bool{}
+		}
+		calls[key][call.String()] = true
+		shrinking[key] = shrinking[key] || shrinks
+		return true
+	})
+	for key, group := range calls {
+		if shrinking[key] && len(group) >= 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// parameterStep reports which parameter arg is, alone or plus or minus an
+// integer literal, and whether it is the minus form
+func parameterStep(arg ast.Expression, params map[string]bool) (param string, shrinks bool, ok bool) {
+	switch arg := arg.(type) {
+	case *ast.Identifier:
+		return arg.Value, false, params[arg.Value]
+	case *ast.InfixExpression:
+		if arg.Operator != "-" && arg.Operator != "+" {
+			return "", false, false
+		}
+		ident, isIdent := arg.Left.(*ast.Identifier)
+		_, isInt := arg.Right.(*ast.IntegerLiteral)
+		if !isIdent || !isInt || !params[ident.Value] {
+			return "", false, false
+		}
+		return ident.Value, arg.Operator == "-", true
+	}
+	return "", false, false
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 	"victoria/ast"
 	"victoria/lexer"
@@ -302,6 +303,17 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"2 / (5 + 5)", "(2 / (5 + 5))"},
 		{"-(5 + 5)", "(-(5 + 5))"},
 		{"!(true == true)", "(!(true == true))"},
+		{"a & b == c", "(a & (b == c))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"1 + 2 << 3", "((1 + 2) << 3)"},
+		{"a << 1 < b >> 1", "((a << 1) < (b >> 1))"},
+		{"~a & b", "((~a) & b)"},
+		{"a & b && c | d", "((a & b) && (c | d))"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"2 ** -1", "(2 ** (-1))"},
+		{"a + b div c % d", "(a + ((b div c) % d))"},
 	}
 
 	for _, tt := range tests {
@@ -619,6 +631,32 @@ func TestTernaryExpressionParsing(t *testing.T) {
 	}
 }
 
+func TestRangeForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0..=n", "0..=n"},
+		{"10..0 step -2", "10..0 step (-2)"},
+		{"'a'..='z' step 2", "'a'..='z' step 2"},
+		{"0..n + 1 step k * 2", "0..(n + 1) step (k * 2)"},
+		{"let step = 2; step", "let step = 2;step"},
+		{"let step = 1\nlet r = 0..10\nstep = 3", "let step = 1;let r = 0..10;(step = 3)"},
+		{"let r = 0..10 step\n2", "let r = 0..10 step 2;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
 func TestRangeExpressionParsing(t *testing.T) {
 	input := `1..10`
 
@@ -742,6 +780,9 @@ func TestSliceExpression(t *testing.T) {
 		{"arr[1:3]"},
 		{"arr[:3]"},
 		{"arr[1:]"},
+		{"arr[::-1]"},
+		{"arr[1:10:2]"},
+		{"arr[:]"},
 	}
 
 	for _, tt := range tests {
@@ -833,6 +874,65 @@ func TestIncludeStatement(t *testing.T) {
 	}
 }
 
+func TestConditionalCompilation(t *testing.T) {
+	input := `#make DEBUG 0
+#make LOG(x) print(x)
+#if DEBUG
+LOG("debug")
+#endif
+LOG("always")`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	if _, ok := program.Statements[0].(*ast.MakeStatement); !ok {
+		t.Fatalf("program.Statements[0] is not ast.MakeStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if program.Statements[1].String() != "print(always)" {
+		t.Errorf("macro not expanded. got=%s", program.Statements[1].String())
+	}
+}
+
+func TestDirectiveErrorsReported(t *testing.T) {
+	l := lexer.New("#if 1\nlet x = 1;")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.RichErrors()) != 1 {
+		t.Fatalf("expected 1 rich error. got=%d", len(p.RichErrors()))
+	}
+	if p.RichErrors()[0].Code != "E0051" {
+		t.Errorf("wrong error code. got=%s", p.RichErrors()[0].Code)
+	}
+}
+
+func TestInvalidNumericLiteralKeepsSpelling(t *testing.T) {
+	tests := []string{"0b102", "1__0", "0x"}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.RichErrors()) != 1 {
+			t.Fatalf("expected 1 rich error for %q. got=%d", input, len(p.RichErrors()))
+		}
+		expected := "invalid integer literal '" + input + "'"
+		if p.RichErrors()[0].Message != expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected, p.RichErrors()[0].Message)
+		}
+	}
+}
+
 // Helper functions
 
 func checkParserErrors(t *testing.T, p *Parser) {
@@ -873,3 +973,480 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 
 	return true
 }
+
+func TestSetLiteralParsing(t *testing.T) {
+	input := "let s: set[int] = #{1, 2 + 3, ...rest}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if stmt.Type.String() != "set[int]" {
+		t.Errorf("type annotation wrong. expected=set[int], got=%s", stmt.Type.String())
+	}
+
+	set, ok := stmt.Value.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.SetLiteral. got=%T", stmt.Value)
+	}
+
+	if set.String() != "#{1, (2 + 3), ...rest}" {
+		t.Errorf("set.String() wrong. got=%s", set.String())
+	}
+}
+
+func TestYieldMakesGenerator(t *testing.T) {
+	input := `
+define count(n) {
+	let outer = define() { return 1 }
+	yield n
+	yield
+}
+define plain() { return define() { yield 1 } }
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	count := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if !count.IsGenerator {
+		t.Errorf("count should be a generator")
+	}
+	inner := count.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if inner.IsGenerator {
+		t.Errorf("a function without yield should not be a generator")
+	}
+	if got := count.Body.Statements[1].String(); got != "yield n" {
+		t.Errorf("wrong yield statement. got=%s", got)
+	}
+	if bare := count.Body.Statements[2].(*ast.YieldStatement); bare.Value != nil {
+		t.Errorf("bare yield should have no value. got=%s", bare.Value.String())
+	}
+
+	plain := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if plain.IsGenerator {
+		t.Errorf("a yield in a nested function should not make the outer one a generator")
+	}
+}
+
+func TestYieldOutsideFunction(t *testing.T) {
+	l := lexer.New("yield 1")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.RichErrors()) != 1 {
+		t.Fatalf("expected 1 rich error. got=%d", len(p.RichErrors()))
+	}
+	if p.RichErrors()[0].Code != "E0105" {
+		t.Errorf("wrong error code. got=%s", p.RichErrors()[0].Code)
+	}
+}
+
+func TestComprehensionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * x for x in xs if x % 2 == 0]", "[(x * x) for x in xs if ((x % 2) == 0)]"},
+		{"[[0 for j in 0..m] for i in 0..n]", "[[0 for j in 0..m] for i in 0..n]"},
+		{"[[i, j] for i in a for j in b if i < j if j > 0]", "[[i, j] for i in a for j in b if (i < j) if (j > 0)]"},
+		{"{k: len(k) for k in words}", "{k:len(k) for k in words}"},
+		{"{v: k for k, v in h}", "{v:k for k, v in h}"},
+		{"[1, 2]", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestSliceStepParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[::-1]", "(a[::(-1)])"},
+		{"a[1:10:2]", "(a[1:10:2])"},
+		{"a[:5:2]", "(a[:5:2])"},
+		{"a[1::2]", "(a[1::2])"},
+		{"a[1::]", "(a[1:])"},
+		{"a[2:4] = [9, 9]", "((a[2:4]) = [9, 9])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptionalChainingParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.b?.c", "((a ?. b) ?. c)"},
+		{"a?.[0]", "(a?.[0])"},
+		{"a?.b?.[i + 1]", "((a ?. b)?.[(i + 1)])"},
+		{"a?.[1:]", "(a?.[1:])"},
+		{"a?.b()", "(a ?. b)()"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"a || b ?? c", "((a || b) ?? c)"},
+		{"a ?? b + 1", "(a ?? (b + 1))"},
+		{"a ?? b ? c : d", "((a ?? b) ? c : d)"},
+		{"x ? a?.b : c ?? d", "(x ? (a ?. b) : (c ?? d))"},
+		{"x ?.5 : 1", "(x ? .5 : 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestPipeParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs |> map(f) |> filter(g)", "((xs |> map(f)) |> filter(g))"},
+		{"xs |> len", "(xs |> len)"},
+		{"a + 1 |> f()", "((a + 1) |> f())"},
+		{"xs |> len() > 3", "((xs |> len()) > 3)"},
+		{"0..5 |> f()", "(0..5 |> f())"},
+		{"let r = xs |> f(1, 2)", "let r = (xs |> f(1, 2));"},
+		{"x |> (n) => n * 2", "(x |> n => (n * 2))"},
+		{"x |> n => n * 2", "(x |> n => (n * 2))"},
+		{"x ?? y |> f()", "(x ?? (y |> f()))"},
+		{"xs\n  |> map(f)\n  |> len()", "((xs |> map(f)) |> len())"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"outer: for i in xs { for j in ys { break outer } }", "outer: for i in xs for j in ys break outer"},
+		{"rows: for i, row in grid { continue rows }", "rows: for i, row in grid continue rows"},
+		{"w: while (x) { break w }", "w: while x break w"},
+		{"c: for (let i = 0; i < 3; i++) { continue c }", "c: for (let i = 0;; (i < 3); (i++)) continue c"},
+		{"a: for x in xs { b: for y in ys { continue a } }", "a: for x in xs b: for y in ys continue a"},
+		{"for x in xs { break\nlabel = 1 }", "for x in xs break(label = 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestUnknownLoopLabel(t *testing.T) {
+	tests := []string{
+		"for x in xs { break outer }",
+		"outer: for x in xs { }; for y in ys { continue outer }",
+		"outer: for x in xs { define f() { break outer } }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.RichErrors()) != 1 {
+			t.Errorf("expected 1 rich error for %q. got=%d", input, len(p.RichErrors()))
+			continue
+		}
+		if p.RichErrors()[0].Code != "E0106" {
+			t.Errorf("wrong error code for %q. got=%s", input, p.RichErrors()[0].Code)
+		}
+	}
+}
+
+func TestDecoratorParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@memo\ndefine f(n) { n }", "let f = @memo define f(n) n;"},
+		{"@trace(\"f\") @memo define f(n) { n }", "let f = @trace(f) @memo define f(n) n;"},
+		{"@lib.wrap define f() { 1 }", "let f = @(lib . wrap) define f() 1;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestDecoratorWithoutFunction(t *testing.T) {
+	tests := []string{
+		"@memo let x = 1",
+		"@memo 42",
+		"@memo define Point.norm() { 1 }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.RichErrors()) == 0 {
+			t.Errorf("expected a rich error for %q", input)
+			continue
+		}
+		if p.RichErrors()[0].Code != "E0107" {
+			t.Errorf("wrong error code for %q. got=%s", input, p.RichErrors()[0].Code)
+		}
+	}
+}
+
+func TestMemoizationNote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"define fib(n) { if (n < 2) { return n }; return fib(n - 1) + fib(n - 2) }", []string{"fib"}},
+		{"define paths(r, c) { if (r == 0) { return 1 }; paths(r - 1, c) + paths(r, c - 1) }", []string{"paths"}},
+		{"@memo define fib(n) { if (n < 2) { return n }; return fib(n - 1) + fib(n - 2) }", nil},
+		{"define sort(a) { sort(a[:1]) + sort(a[1:]) }", nil},
+		{"define fact(n) { if (n < 2) { return 1 }; n * fact(n - 1) }", nil},
+		{"define up(n) { up(n + 1) + up(n + 2) }", nil},
+		{"define hanoi(n, a, b, c) { if (n == 0) { return 0 }; hanoi(n - 1, a, c, b) + 1 + hanoi(n - 1, c, b, a) }", nil},
+		{"define walk(n, a, b) { walk(n - 1, a, b) + walk(n - 2, b, a) }", nil},
+		{"define knap(i, w) { if (i == 0) { return 0 }; max(knap(i - 1, w), knap(i - 1, w - 3)) }", []string{"knap"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var got []string
+		for _, note := range p.Notes() {
+			if note.Code != "N0001" {
+				t.Errorf("unexpected note code %s for %q", note.Code, tt.input)
+			}
+			got = append(got, note.Message)
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("wrong notes for %q. expected=%v, got=%v", tt.input, tt.expected, got)
+			continue
+		}
+		for i, name := range tt.expected {
+			if !strings.Contains(got[i], "'"+name+"'") {
+				t.Errorf("note %d for %q should name %s, got %q", i, tt.input, name, got[i])
+			}
+		}
+	}
+}
+
+func TestNegativeModuloWarning(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let r = -7 % 3", 1},
+		{"let r = x % -3", 1},
+		{"let r = -7.5 % 2; let s = 7 % 3", 1},
+		{"let r = 7 % 3", 0},
+		{"let r = -x % 3", 0},
+		{"let r = -7 div 3", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		got := 0
+		for _, note := range p.Notes() {
+			if note.Code != "W0005" {
+				t.Errorf("unexpected note code %s for %q", note.Code, tt.input)
+			}
+			got++
+		}
+		if got != tt.expected {
+			t.Errorf("wrong number of W0005 warnings for %q. expected=%d, got=%d", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestAssertStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert x == 1", "assert (x == 1)"},
+		{`assert len(xs) > 0, "not empty"`, "assert (len(xs) > 0), not empty"},
+		{"assert ok; let y = 2", "assert oklet y = 2;"},
+		{`assert f(a, b), "m" + name`, "assert f(a, b), (m + name)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("assert a < b, \"m\"")).ParseProgram()
+	stmt, ok := program.Statements[0].(*ast.AssertStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.AssertStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Start.Column != 8 || stmt.End.Column != 12 {
+		t.Errorf("wrong condition span. got columns %d to %d", stmt.Start.Column, stmt.End.Column)
+	}
+}
+
+func TestTestBlock(t *testing.T) {
+	input := `let test = 1
+test "adds numbers" { assert 1 + 1 == 2 }
+test(2)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements. got=%d", len(program.Statements))
+	}
+	block, ok := program.Statements[1].(*ast.TestBlock)
+	if !ok {
+		t.Fatalf("statement is not *ast.TestBlock. got=%T", program.Statements[1])
+	}
+	if block.Name != "adds numbers" {
+		t.Errorf("wrong test name. got=%q", block.Name)
+	}
+	if block.String() != `test "adds numbers" assert ((1 + 1) == 2)` {
+		t.Errorf("wrong String(). got=%q", block.String())
+	}
+	if _, ok := program.Statements[2].(*ast.ExpressionStatement); !ok {
+		t.Errorf("test(2) should stay a call. got=%T", program.Statements[2])
+	}
+
+	// The name is unescaped like any other string literal
+	p = New(lexer.New(`test "say \"hi\"\tnow \\o/" { }`))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	block = program.Statements[0].(*ast.TestBlock)
+	if block.Name != "say \"hi\"\tnow \\o/" {
+		t.Errorf("escapes in the test name should be resolved. got=%q", block.Name)
+	}
+}
+
+func TestBenchBlock(t *testing.T) {
+	input := `let bench = 1
+bench "sum 1k" { let total = 0 }
+bench + 1`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements. got=%d", len(program.Statements))
+	}
+	block, ok := program.Statements[1].(*ast.BenchBlock)
+	if !ok {
+		t.Fatalf("statement is not *ast.BenchBlock. got=%T", program.Statements[1])
+	}
+	if block.Name != "sum 1k" {
+		t.Errorf("wrong bench name. got=%q", block.Name)
+	}
+	if block.String() != `bench "sum 1k" let total = 0;` {
+		t.Errorf("wrong String(). got=%q", block.String())
+	}
+	if _, ok := program.Statements[2].(*ast.ExpressionStatement); !ok {
+		t.Errorf("bench + 1 should stay an expression. got=%T", program.Statements[2])
+	}
+
+	p = New(lexer.New(`bench "join \"a\" \\ \"b\"" { }`))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	block = program.Statements[0].(*ast.BenchBlock)
+	if block.Name != `join "a" \ "b"` {
+		t.Errorf("escapes in the bench name should be resolved. got=%q", block.Name)
+	}
+}
+
+func TestNestedTestBlock(t *testing.T) {
+	tests := []string{
+		`define f() { test "inner" { } }`,
+		`if (true) { test "inner" { } }`,
+		`for x in [1] { bench "inner" { } }`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.RichErrors()) != 1 {
+			t.Errorf("expected 1 rich error for %q. got=%d", input, len(p.RichErrors()))
+			continue
+		}
+		if p.RichErrors()[0].Code != "E0108" {
+			t.Errorf("wrong error code for %q. got=%s", input, p.RichErrors()[0].Code)
+		}
+	}
+}
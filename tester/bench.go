@@ -0,0 +1,372 @@
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"time"
+
+	"victoria/ast"
+	"victoria/errors"
+	"victoria/evaluator"
+	"victoria/object"
+)
+
+// BenchOptions configures a benchmark run
+type BenchOptions struct {
+	// Filter selects benchmarks by name; nil runs every benchmark
+	Filter *regexp.Regexp
+	// Defines are preprocessor constants, as given with -D NAME=value
+	Defines map[string]string
+	// Out receives the results and the summary
+	Out io.Writer
+	// Time is how long each benchmark should run for; one second when zero
+	Time time.Duration
+	// Iterations, when above zero, runs each body exactly that many times
+	// instead of scaling the count to fill Time
+	Iterations int
+	// Baseline holds earlier results to compare against, if any
+	Baseline *Baseline
+}
+
+// Benchmark is the measurement of one bench block. The per-op figures are
+// averages over Iterations runs of the body.
+type Benchmark struct {
+	Name        string        `json:"name"`
+	File        string        `json:"file"`
+	Iterations  int           `json:"iterations"`
+	NsPerOp     float64       `json:"ns_per_op"`
+	AllocsPerOp int64         `json:"allocs_per_op"`
+	BytesPerOp  int64         `json:"bytes_per_op"`
+	Err         *object.Error `json:"-"` // nil when every run succeeded
+	Report      string        `json:"-"` // the rich error report, empty when passed
+}
+
+// BenchSuite holds the benchmarks of one file
+type BenchSuite struct {
+	File       string
+	Benchmarks []Benchmark
+	Skipped    int // benchmarks left out by the filter
+	// Error is set when the file could not be read or parsed
+	Error string
+}
+
+// Failed reports whether the file could not run or any benchmark failed
+func (s *BenchSuite) Failed() bool {
+	if s.Error != "" {
+		return true
+	}
+	for _, b := range s.Benchmarks {
+		if b.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Baseline is the JSON file written by `victoria bench --save` and read by
+// --baseline. Its benchmarks are matched to new results by name.
+type Baseline struct {
+	Benchmarks []Benchmark `json:"benchmarks"`
+}
+
+// NewBaseline returns a baseline of the benchmarks in suites that ran
+// without an error
+func NewBaseline(suites []*BenchSuite) *Baseline {
+	baseline := &Baseline{Benchmarks: []Benchmark{}}
+	for _, suite := range suites {
+		for _, b := range suite.Benchmarks {
+			if b.Err == nil {
+				baseline.Benchmarks = append(baseline.Benchmarks, b)
+			}
+		}
+	}
+	return baseline
+}
+
+// ReadBaseline reads a baseline written by Write
+func ReadBaseline(r io.Reader) (*Baseline, error) {
+	baseline := &Baseline{}
+	if err := json.NewDecoder(r).Decode(baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline: %v", err)
+	}
+	return baseline, nil
+}
+
+// Write writes the baseline as indented JSON
+func (b *Baseline) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// lookup returns the first benchmark named name, or nil
+func (b *Baseline) lookup(name string) *Benchmark {
+	if b == nil {
+		return nil
+	}
+	for i := range b.Benchmarks {
+		if b.Benchmarks[i].Name == name {
+			return &b.Benchmarks[i]
+		}
+	}
+	return nil
+}
+
+// RunBenchmarks runs the benchmarks in files, reporting to opts.Out as it
+// goes, and ends with a summary line
+func RunBenchmarks(files []string, opts BenchOptions) []*BenchSuite {
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	evaluator.RegisterBuiltinModules()
+
+	start := time.Now()
+	suites := make([]*BenchSuite, 0, len(files))
+	for _, file := range files {
+		suites = append(suites, RunBenchFile(file, opts))
+	}
+	printBenchSummary(opts.Out, suites, time.Since(start))
+	return suites
+}
+
+// RunBenchFile runs the benchmarks in one file. Files without bench blocks
+// are skipped silently, since the test files searched may hold none.
+func RunBenchFile(file string, opts BenchOptions) *BenchSuite {
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	suite := &BenchSuite{File: file}
+
+	source, absPath, program, problem := load(file, opts.Defines)
+	if problem != "" {
+		suite.Error = problem
+		fmt.Fprintf(opts.Out, "%s%s%s\n", errors.Bold, file, errors.Reset)
+		fmt.Fprint(opts.Out, problemLine(problem))
+		return suite
+	}
+
+	evaluator.SetEvalContext(source, absPath)
+	defer evaluator.ClearEvalContext()
+	evaluator.SetDefines(opts.Defines)
+	defer evaluator.SetDefines(nil)
+
+	prelude := preludeOf(program)
+	var benches []*ast.BenchBlock
+	for _, stmt := range program.Statements {
+		bench, ok := stmt.(*ast.BenchBlock)
+		if !ok {
+			continue
+		}
+		if opts.Filter != nil && !opts.Filter.MatchString(bench.Name) {
+			suite.Skipped++
+			continue
+		}
+		benches = append(benches, bench)
+	}
+	if len(benches) == 0 {
+		return suite
+	}
+
+	fmt.Fprintf(opts.Out, "%s%s%s\n", errors.Bold, file, errors.Reset)
+	width := 0
+	for _, bench := range benches {
+		if len(bench.Name) > width {
+			width = len(bench.Name)
+		}
+	}
+
+	for _, bench := range benches {
+		result := runBenchmark(bench, prelude, opts)
+		result.File = file
+		suite.Benchmarks = append(suite.Benchmarks, result)
+
+		if result.Err != nil {
+			fmt.Fprintf(opts.Out, "  %s%sFAIL%s %s\n", errors.Bold, errors.BrightRed, errors.Reset, bench.Name)
+			fmt.Fprint(opts.Out, result.Report)
+			fmt.Fprintln(opts.Out)
+			continue
+		}
+		fmt.Fprintf(opts.Out, "  %-*s %10d %14s ns/op %10d allocs/op %12d B/op%s\n",
+			width, result.Name, result.Iterations, formatNs(result.NsPerOp),
+			result.AllocsPerOp, result.BytesPerOp, compareLine(result, opts.Baseline.lookup(result.Name)))
+	}
+
+	return suite
+}
+
+// maxIterations caps the scaled iteration count, as the Go benchmark
+// runner does
+const maxIterations = 1_000_000_000
+
+// runBenchmark measures bench in a fresh environment. The rest of the file
+// and setup() run once; the body then runs 1, then more and more times,
+// each round predicting from the last how many runs fill opts.Time, until a
+// round takes at least that long. teardown() runs at the end.
+func runBenchmark(bench *ast.BenchBlock, prelude []ast.Statement, opts BenchOptions) Benchmark {
+	result := Benchmark{Name: bench.Name}
+	env := object.NewEnvironment()
+
+	err := errorOf(evaluator.Eval(&ast.Program{Statements: prelude}, env))
+	if err == nil {
+		err = callHook(env, "setup")
+	}
+	if err == nil {
+		err = measure(bench, env, opts, &result)
+		if teardownErr := callHook(env, "teardown"); err == nil {
+			err = teardownErr
+		}
+	}
+
+	if err != nil {
+		result.Err = err
+		result.Report = evaluator.FormatRichError(err)
+	}
+	return result
+}
+
+// measure runs the body of bench until the timing is stable and records the
+// per-op figures in result
+func measure(bench *ast.BenchBlock, env *object.Environment, opts BenchOptions, result *Benchmark) *object.Error {
+	goal := opts.Time
+	if goal <= 0 {
+		goal = time.Second
+	}
+
+	n := 1
+	if opts.Iterations > 0 {
+		n = opts.Iterations
+	}
+	for {
+		elapsed, allocs, bytes, err := runIterations(bench.Body, env, n)
+		if err != nil {
+			return err
+		}
+		if opts.Iterations > 0 || elapsed >= goal || n >= maxIterations {
+			result.Iterations = n
+			result.NsPerOp = float64(elapsed.Nanoseconds()) / float64(n)
+			result.AllocsPerOp = int64(allocs / uint64(n))
+			result.BytesPerOp = int64(bytes / uint64(n))
+			return nil
+		}
+		n = nextIterations(n, elapsed, goal)
+	}
+}
+
+// runIterations runs body n times, each in its own scope, and returns the
+// time taken and the Go heap allocations made
+func runIterations(body *ast.BlockStatement, env *object.Environment, n int) (time.Duration, uint64, uint64, *object.Error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := errorOf(evaluator.Eval(body, object.NewEnclosedEnvironment(env))); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	return elapsed, after.Mallocs - before.Mallocs, after.TotalAlloc - before.TotalAlloc, nil
+}
+
+// nextIterations predicts how many runs fill goal from a round of n runs
+// that took elapsed, overshooting a little, growing at most 100-fold and at
+// least by one
+func nextIterations(n int, elapsed, goal time.Duration) int {
+	ns := elapsed.Nanoseconds()
+	if ns <= 0 {
+		ns = 1
+	}
+	next := int64(n) * goal.Nanoseconds() / ns
+	next += next / 5
+	if limit := 100 * int64(n); next > limit {
+		next = limit
+	}
+	if next <= int64(n) {
+		next = int64(n) + 1
+	}
+	if next > maxIterations {
+		next = maxIterations
+	}
+	return int(next)
+}
+
+// noiseThreshold is the change, in percent, below which a difference from
+// the baseline is shown as noise rather than as faster or slower
+const noiseThreshold = 5.0
+
+// compareLine describes how result differs from its baseline, or returns ""
+// when there is none
+func compareLine(result Benchmark, base *Benchmark) string {
+	if base == nil {
+		return ""
+	}
+	return fmt.Sprintf("  %s ns/op %s allocs/op",
+		change(base.NsPerOp, result.NsPerOp), change(float64(base.AllocsPerOp), float64(result.AllocsPerOp)))
+}
+
+// change formats the change from was to now as a percentage, green when it
+// went down and red when it went up by more than noiseThreshold
+func change(was, now float64) string {
+	if was == 0 {
+		if now == 0 {
+			return errors.Dim + "~" + errors.Reset
+		}
+		return errors.BrightRed + "+inf%" + errors.Reset
+	}
+	delta := (now - was) / was * 100
+	color := errors.Dim
+	switch {
+	case delta <= -noiseThreshold:
+		color = errors.BrightGreen
+	case delta >= noiseThreshold:
+		color = errors.BrightRed
+	}
+	return fmt.Sprintf("%s%+.1f%%%s", color, delta, errors.Reset)
+}
+
+// formatNs shows whole nanoseconds, with decimals only for very fast bodies
+func formatNs(ns float64) string {
+	if ns < 100 {
+		return fmt.Sprintf("%.2f", ns)
+	}
+	return fmt.Sprintf("%.0f", ns)
+}
+
+func printBenchSummary(out io.Writer, suites []*BenchSuite, elapsed time.Duration) {
+	ran, failed, skipped, broken := 0, 0, 0, 0
+	for _, suite := range suites {
+		if suite.Error != "" {
+			broken++
+		}
+		skipped += suite.Skipped
+		for _, b := range suite.Benchmarks {
+			if b.Err != nil {
+				failed++
+			} else {
+				ran++
+			}
+		}
+	}
+
+	status := errors.BrightGreen + "ok" + errors.Reset
+	if failed > 0 || broken > 0 {
+		status = errors.Bold + errors.BrightRed + "FAIL" + errors.Reset
+	}
+	fmt.Fprintf(out, "\n%s  %d benchmark(s) ran, %d failed", status, ran, failed)
+	if skipped > 0 {
+		fmt.Fprintf(out, ", %d skipped", skipped)
+	}
+	if broken > 0 {
+		fmt.Fprintf(out, ", %d file(s) did not compile", broken)
+	}
+	fmt.Fprintf(out, " in %d file(s) (%s)\n", len(suites), formatDuration(elapsed))
+}
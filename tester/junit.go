@@ -0,0 +1,157 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",cdata"`
+}
+
+var (
+	ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	errorCode  = regexp.MustCompile(`^\w+\[(\w+)\]`)
+)
+
+// WriteJUnit writes suites as JUnit XML, the format CI servers and grading
+// pipelines read. Each file is a <testsuite> and each test a <testcase>. A
+// failed assert is a <failure> and any other runtime error an <error>; tests
+// the filter left out are cases with <skipped/>. A file that did not
+// compile is reported as a single case with an <error>.
+func WriteJUnit(w io.Writer, suites []*Suite) error {
+	report := junitTestSuites{}
+	var total time.Duration
+
+	for _, suite := range suites {
+		js := junitTestSuite{
+			Name: suite.File,
+			Time: junitTime(suite.Duration),
+		}
+
+		if suite.Error != "" {
+			text := plainText(suite.Error)
+			js.Errors = 1
+			js.Tests = 1
+			js.Cases = append(js.Cases, junitTestCase{
+				Name:      suite.File,
+				Classname: suite.File,
+				Time:      junitTime(0),
+				Error:     &junitProblem{Message: firstLine(text), Type: codeOf(text), Body: text},
+			})
+		}
+
+		for _, r := range suite.Results {
+			tc := junitTestCase{
+				Name:      r.Name,
+				Classname: suite.File,
+				Time:      junitTime(r.Duration),
+			}
+			if !r.Passed() {
+				text := plainText(r.Report)
+				problem := &junitProblem{Message: r.Err.Message, Type: codeOf(text), Body: text}
+				if strings.HasPrefix(r.Err.Message, "assertion failed: ") {
+					tc.Failure = problem
+					js.Failures++
+				} else {
+					tc.Error = problem
+					js.Errors++
+				}
+			}
+			js.Tests++
+			js.Cases = append(js.Cases, tc)
+		}
+
+		for _, name := range suite.Skipped {
+			js.Cases = append(js.Cases, junitTestCase{
+				Name:      name,
+				Classname: suite.File,
+				Time:      junitTime(0),
+				Skipped:   &junitSkipped{Message: "left out by --run"},
+			})
+			js.Tests++
+			js.Skipped++
+		}
+
+		report.Tests += js.Tests
+		report.Failures += js.Failures
+		report.Errors += js.Errors
+		report.Skipped += js.Skipped
+		report.Suites = append(report.Suites, js)
+		total += suite.Duration
+	}
+	report.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// plainText strips the terminal colors from a rich error report
+func plainText(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// codeOf returns the error code from the header of a plain report, such as
+// E0056 from "error[E0056]: assertion failed"
+func codeOf(text string) string {
+	if m := errorCode.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
@@ -0,0 +1,352 @@
+// Package tester runs the tests of Victoria programs for `victoria test`,
+// and their benchmarks for `victoria bench`.
+//
+// A test is a top-level test "name" { ... } block. A file named *_test.vc
+// without any test blocks is run as a single test. Every test gets a fresh
+// environment: the file's other top-level statements run first, then the
+// file's setup() function if it defines one, the test body, and teardown().
+// Benchmarks are bench "name" { ... } blocks and are set up the same way,
+// once per benchmark rather than once per run of the body.
+package tester
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"victoria/ast"
+	"victoria/errors"
+	"victoria/evaluator"
+	"victoria/lexer"
+	"victoria/object"
+	"victoria/parser"
+)
+
+// Options configures a test run
+type Options struct {
+	// Filter selects tests by name; nil runs every test
+	Filter *regexp.Regexp
+	// Defines are preprocessor constants, as given with -D NAME=value
+	Defines map[string]string
+	// Out receives progress, failure reports and the summary
+	Out io.Writer
+	// Tracer, when set, follows the tests as they run, as --cover does
+	Tracer evaluator.Tracer
+}
+
+// Result is the outcome of a single test
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      *object.Error // nil when the test passed
+	Report   string        // the rich failure report, empty when passed
+}
+
+// Passed reports whether the test ran without an error
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Suite holds the results of the tests in one file
+type Suite struct {
+	File     string
+	Results  []Result
+	Skipped  []string // names of the tests left out by the filter
+	Duration time.Duration
+	// Error is set when the file could not be read or parsed, in which
+	// case none of its tests ran
+	Error string
+}
+
+// Failed reports whether the file could not run or any of its tests failed
+func (s *Suite) Failed() bool {
+	if s.Error != "" {
+		return true
+	}
+	for _, r := range s.Results {
+		if !r.Passed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover returns the test files under paths. Directories are searched
+// recursively for *_test.vc files; files named directly are always included.
+func Discover(paths []string) ([]string, error) {
+	return discover(paths, "_test.vc")
+}
+
+// DiscoverBenchmarks returns the files under paths that may hold benchmarks:
+// *_bench.vc and *_test.vc files, and files named directly
+func DiscoverBenchmarks(paths []string) ([]string, error) {
+	return discover(paths, "_bench.vc", "_test.vc")
+}
+
+func discover(paths []string, suffixes ...string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if d.IsDir() {
+				return nil
+			}
+			for _, suffix := range suffixes {
+				if strings.HasSuffix(d.Name(), suffix) {
+					files = append(files, p)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Run runs the tests in files, reporting to opts.Out as it goes, and ends
+// with a summary line
+func Run(files []string, opts Options) []*Suite {
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	evaluator.RegisterBuiltinModules()
+	if opts.Tracer != nil {
+		evaluator.SetTracer(opts.Tracer)
+		defer evaluator.SetTracer(nil)
+	}
+
+	start := time.Now()
+	suites := make([]*Suite, 0, len(files))
+	for _, file := range files {
+		suites = append(suites, RunFile(file, opts))
+	}
+	printSummary(opts.Out, suites, time.Since(start))
+	return suites
+}
+
+// RunFile runs the tests in one file
+func RunFile(file string, opts Options) *Suite {
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	suite := &Suite{File: file}
+	start := time.Now()
+	defer func() { suite.Duration = time.Since(start) }()
+
+	// The file name heads its results, and is left out when the filter
+	// skips every test in it
+	headed := false
+	header := func() {
+		if !headed {
+			fmt.Fprintf(opts.Out, "%s%s%s\n", errors.Bold, file, errors.Reset)
+			headed = true
+		}
+	}
+
+	source, absPath, program, err := load(file, opts.Defines)
+	if err != "" {
+		suite.Error = err
+		header()
+		fmt.Fprint(opts.Out, problemLine(err))
+		return suite
+	}
+
+	evaluator.SetEvalContext(source, absPath)
+	defer evaluator.ClearEvalContext()
+	evaluator.SetDefines(opts.Defines)
+	defer evaluator.SetDefines(nil)
+	if opts.Tracer != nil {
+		opts.Tracer.Program(absPath, source, program)
+	}
+
+	prelude := preludeOf(program)
+	var tests []*ast.TestBlock
+	for _, stmt := range program.Statements {
+		if test, ok := stmt.(*ast.TestBlock); ok {
+			tests = append(tests, test)
+		}
+	}
+
+	// A *_test.vc file without test or bench blocks is a test in itself
+	if len(tests) == 0 && len(prelude) == len(program.Statements) && strings.HasSuffix(file, "_test.vc") {
+		tests = append(tests, &ast.TestBlock{
+			Name: filepath.Base(file),
+			Body: &ast.BlockStatement{},
+		})
+	}
+
+	for _, test := range tests {
+		if opts.Filter != nil && !opts.Filter.MatchString(test.Name) {
+			suite.Skipped = append(suite.Skipped, test.Name)
+			continue
+		}
+		header()
+		result := runTest(test, prelude)
+		suite.Results = append(suite.Results, result)
+
+		duration := formatDuration(result.Duration)
+		if result.Passed() {
+			fmt.Fprintf(opts.Out, "  %sPASS%s %s %s(%s)%s\n", errors.BrightGreen, errors.Reset, test.Name, errors.Dim, duration, errors.Reset)
+		} else {
+			fmt.Fprintf(opts.Out, "  %s%sFAIL%s %s %s(%s)%s\n", errors.Bold, errors.BrightRed, errors.Reset, test.Name, errors.Dim, duration, errors.Reset)
+			fmt.Fprint(opts.Out, result.Report)
+			fmt.Fprintln(opts.Out)
+		}
+	}
+
+	return suite
+}
+
+// load reads and parses file. When it cannot, it returns the reason as a
+// report instead.
+func load(file string, defines map[string]string) (source, absPath string, program *ast.Program, problem string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", nil, fmt.Sprintf("could not read file: %v", err)
+	}
+	source = string(data)
+	absPath, _ = filepath.Abs(file)
+
+	l := lexer.New(source)
+	for name, value := range defines {
+		l.Define(name, value)
+	}
+	p := parser.New(l)
+	p.SetSource(source, absPath)
+	program = p.ParseProgram()
+	if p.HasErrors() {
+		var report strings.Builder
+		for _, richErr := range p.RichErrors() {
+			report.WriteString(richErr.Format())
+			report.WriteString("\n")
+		}
+		if len(p.RichErrors()) == 0 {
+			report.WriteString(strings.Join(p.Errors(), "\n"))
+		}
+		return source, absPath, nil, report.String()
+	}
+	return source, absPath, program, ""
+}
+
+// problemLine formats a report from load for the progress output
+func problemLine(problem string) string {
+	if strings.HasPrefix(problem, "could not read file") {
+		return fmt.Sprintf("  %s%sERROR%s %s\n", errors.Bold, errors.BrightRed, errors.Reset, problem)
+	}
+	return fmt.Sprintf("  %s%sERROR%s could not compile\n%s", errors.Bold, errors.BrightRed, errors.Reset, problem)
+}
+
+// preludeOf returns the top-level statements of program that are not tests
+// or benchmarks, which set up every test and benchmark in the file
+func preludeOf(program *ast.Program) []ast.Statement {
+	var prelude []ast.Statement
+	for _, stmt := range program.Statements {
+		switch stmt.(type) {
+		case *ast.TestBlock, *ast.BenchBlock:
+		default:
+			prelude = append(prelude, stmt)
+		}
+	}
+	return prelude
+}
+
+// runTest runs test in a fresh environment: the rest of the file first,
+// then setup(), the body and teardown(). Teardown runs even when the body
+// fails, but its own error is only reported for an otherwise passing test.
+func runTest(test *ast.TestBlock, prelude []ast.Statement) Result {
+	start := time.Now()
+	env := object.NewEnvironment()
+
+	err := errorOf(evaluator.Eval(&ast.Program{Statements: prelude}, env))
+	if err == nil {
+		err = callHook(env, "setup")
+	}
+	if err == nil {
+		err = errorOf(evaluator.Eval(test.Body, object.NewEnclosedEnvironment(env)))
+		if teardownErr := callHook(env, "teardown"); err == nil {
+			err = teardownErr
+		}
+	}
+
+	result := Result{Name: test.Name, Duration: time.Since(start), Err: err}
+	if err != nil {
+		result.Report = evaluator.FormatRichError(err)
+	}
+	return result
+}
+
+// callHook calls the function name from env, if the file defines it
+func callHook(env *object.Environment, name string) *object.Error {
+	hook, ok := env.Get(name)
+	if !ok {
+		return nil
+	}
+	return errorOf(evaluator.CallFunction(hook))
+}
+
+func errorOf(obj object.Object) *object.Error {
+	if err, ok := obj.(*object.Error); ok {
+		return err
+	}
+	return nil
+}
+
+func printSummary(out io.Writer, suites []*Suite, elapsed time.Duration) {
+	passed, failed, skipped, broken := 0, 0, 0, 0
+	for _, suite := range suites {
+		if suite.Error != "" {
+			broken++
+		}
+		skipped += len(suite.Skipped)
+		for _, r := range suite.Results {
+			if r.Passed() {
+				passed++
+			} else {
+				failed++
+			}
+		}
+	}
+
+	status := errors.BrightGreen + "ok" + errors.Reset
+	if failed > 0 || broken > 0 {
+		status = errors.Bold + errors.BrightRed + "FAIL" + errors.Reset
+	}
+	fmt.Fprintf(out, "\n%s  %d passed, %d failed", status, passed, failed)
+	if skipped > 0 {
+		fmt.Fprintf(out, ", %d skipped", skipped)
+	}
+	if broken > 0 {
+		fmt.Fprintf(out, ", %d file(s) did not compile", broken)
+	}
+	fmt.Fprintf(out, " in %d file(s) (%s)\n", len(suites), formatDuration(elapsed))
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,390 @@
+package tester
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const sortTests = `
+let log = []
+
+define setup() {
+    log = push(log, "setup")
+}
+
+define teardown() {
+    log = push(log, "teardown")
+}
+
+test "sees only its own setup" {
+    assert log == ["setup"]
+    log = push(log, "body")
+}
+
+test "fails with a diff" {
+    assert [1, 2] == [1, 3], "lists differ"
+}
+
+test "starts fresh" {
+    assert log == ["setup"]
+}
+`
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "sort_test.vc", sortTests)
+
+	var out bytes.Buffer
+	suite := RunFile(path, Options{Out: &out})
+
+	if suite.Error != "" {
+		t.Fatalf("unexpected file error: %s", suite.Error)
+	}
+	expected := []struct {
+		name   string
+		passed bool
+	}{
+		{"sees only its own setup", true},
+		{"fails with a diff", false},
+		{"starts fresh", true},
+	}
+	if len(suite.Results) != len(expected) {
+		t.Fatalf("expected %d results. got=%d", len(expected), len(suite.Results))
+	}
+	for i, tt := range expected {
+		r := suite.Results[i]
+		if r.Name != tt.name || r.Passed() != tt.passed {
+			t.Errorf("result %d: expected %q passed=%t, got %q passed=%t (%v)", i, tt.name, tt.passed, r.Name, r.Passed(), r.Err)
+		}
+	}
+	if msg := suite.Results[1].Err.Message; msg != "assertion failed: lists differ" {
+		t.Errorf("wrong failure message. got=%q", msg)
+	}
+	if !suite.Failed() {
+		t.Errorf("suite with a failing test should report Failed()")
+	}
+	if !strings.Contains(out.String(), "at [1]: left has 2, right has 3") {
+		t.Errorf("output should include the assertion diff. got=\n%s", out.String())
+	}
+}
+
+func TestRunFileTeardownAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "hooks_test.vc", `
+define teardown() {
+    assert false, "teardown ran"
+}
+
+test "body fails first" {
+    assert 1 == 2, "body failed"
+}
+
+test "teardown fails" {
+    let x = 1
+}
+`)
+
+	suite := RunFile(path, Options{})
+	if len(suite.Results) != 2 {
+		t.Fatalf("expected 2 results. got=%d", len(suite.Results))
+	}
+	if msg := suite.Results[0].Err.Message; msg != "assertion failed: body failed" {
+		t.Errorf("the body's failure should win. got=%q", msg)
+	}
+	if msg := suite.Results[1].Err.Message; msg != "assertion failed: teardown ran" {
+		t.Errorf("teardown failure should be reported. got=%q", msg)
+	}
+}
+
+func TestRunFileFilterAndWholeFile(t *testing.T) {
+	dir := t.TempDir()
+	blocks := writeFile(t, dir, "blocks_test.vc", sortTests)
+	whole := writeFile(t, dir, "whole_test.vc", "let x = 2\nassert x * x == 4\n")
+	broken := writeFile(t, dir, "broken_test.vc", "let = 1\n")
+
+	filter := regexp.MustCompile("fresh|whole")
+	suite := RunFile(blocks, Options{Filter: filter})
+	if len(suite.Results) != 1 || suite.Results[0].Name != "starts fresh" || len(suite.Skipped) != 2 {
+		t.Errorf("filter should run only 'starts fresh'. got results=%v skipped=%v", suite.Results, suite.Skipped)
+	}
+
+	suite = RunFile(whole, Options{Filter: filter})
+	if len(suite.Results) != 1 || suite.Results[0].Name != "whole_test.vc" || !suite.Results[0].Passed() {
+		t.Errorf("a file without test blocks should run as one passing test. got=%v", suite.Results)
+	}
+
+	suite = RunFile(broken, Options{})
+	if suite.Error == "" || !suite.Failed() || len(suite.Results) != 0 {
+		t.Errorf("a file that does not parse should be a suite error. got=%+v", suite)
+	}
+}
+
+func TestRunFileDefinesReachIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "helper.vc", `
+#if DEBUG
+let mode = "debug"
+#else
+let mode = "release"
+#endif
+`)
+	path := writeFile(t, dir, "mode_test.vc", `include "`+filepath.Join(dir, "helper")+`"
+test "helper sees the define" {
+    assert helper.mode == "debug"
+}
+`)
+
+	suite := RunFile(path, Options{Defines: map[string]string{"DEBUG": "1"}})
+	if len(suite.Results) != 1 || !suite.Results[0].Passed() {
+		t.Fatalf("-D should reach an included file. got error=%q results=%v", suite.Error, suite.Results)
+	}
+
+	suite = RunFile(path, Options{})
+	if len(suite.Results) != 1 || suite.Results[0].Passed() {
+		t.Errorf("without -D the included file should take its #else branch. got=%v", suite.Results)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a_test.vc", "")
+	writeFile(t, dir, "solution.vc", "")
+	writeFile(t, dir, "sub/b_test.vc", "")
+	writeFile(t, dir, ".hidden/c_test.vc", "")
+	named := writeFile(t, dir, "other/solution.vc", "")
+
+	files, err := Discover([]string{dir, named})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "a_test.vc"),
+		filepath.Join(dir, "sub", "b_test.vc"),
+		named,
+	}
+	if strings.Join(files, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong files.\nexpected=%v\ngot=%v", expected, files)
+	}
+
+	writeFile(t, dir, "sort_bench.vc", "")
+	benchFiles, err := DiscoverBenchmarks([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		filepath.Join(dir, "a_test.vc"),
+		filepath.Join(dir, "sort_bench.vc"),
+		filepath.Join(dir, "sub", "b_test.vc"),
+	}
+	if strings.Join(benchFiles, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong benchmark files.\nexpected=%v\ngot=%v", expected, benchFiles)
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "sort_test.vc", sortTests)
+	broken := writeFile(t, dir, "broken_test.vc", "let = 1\n")
+	suites := Run([]string{path, broken}, Options{})
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, suites); err != nil {
+		t.Fatal(err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if report.Tests != 4 || report.Failures != 1 || report.Errors != 1 {
+		t.Errorf("wrong totals: tests=%d failures=%d errors=%d", report.Tests, report.Failures, report.Errors)
+	}
+	failure := report.Suites[0].Cases[1].Failure
+	if failure == nil {
+		t.Fatalf("expected a failure on the second case")
+	}
+	if failure.Message != "assertion failed: lists differ" || failure.Type != "E0056" {
+		t.Errorf("wrong failure: message=%q type=%q", failure.Message, failure.Type)
+	}
+	if strings.Contains(failure.Body, "\x1b[") {
+		t.Errorf("failure body should not contain terminal colors")
+	}
+	if report.Suites[1].Cases[0].Error == nil {
+		t.Errorf("a file that does not parse should be reported as an <error>")
+	}
+
+	// A runtime error is an <error>, and filtered tests are skipped cases
+	// that count towards tests
+	crash := writeFile(t, dir, "crash_test.vc", "test \"divides\" { let x = 1 / 0 }\n")
+	suites = Run([]string{path, crash}, Options{Filter: regexp.MustCompile("fresh|divides")})
+	buf.Reset()
+	if err := WriteJUnit(&buf, suites); err != nil {
+		t.Fatal(err)
+	}
+	report = junitTestSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if report.Tests != 4 || report.Skipped != 2 || report.Failures != 0 || report.Errors != 1 {
+		t.Errorf("wrong totals: tests=%d skipped=%d failures=%d errors=%d", report.Tests, report.Skipped, report.Failures, report.Errors)
+	}
+	cases := report.Suites[0].Cases
+	if len(cases) != 3 || cases[1].Skipped == nil || cases[1].Name != "sees only its own setup" || cases[2].Skipped == nil {
+		t.Errorf("filtered tests should be <skipped/> cases. got=%+v", cases)
+	}
+	crashed := report.Suites[1].Cases[0]
+	if crashed.Error == nil || crashed.Failure != nil || crashed.Error.Message != "division by zero" {
+		t.Errorf("a runtime error should be reported as an <error>. got=%+v", crashed)
+	}
+}
+
+const sumBenches = `
+let runs = 0
+let ready = false
+
+define setup() {
+    ready = true
+}
+
+define teardown() {
+    assert runs >= 1, "the body ran"
+}
+
+bench "sum 100" {
+    assert ready
+    runs++
+    let total = 0
+    for i in 0..100 { total += i }
+}
+
+bench "fails" {
+    assert 1 == 2, "bench failed"
+}
+
+test "not a benchmark" {
+    assert false
+}
+`
+
+func TestRunBenchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "sum_bench.vc", sumBenches)
+
+	var out bytes.Buffer
+	suite := RunBenchFile(path, BenchOptions{Out: &out, Iterations: 7})
+	if suite.Error != "" {
+		t.Fatalf("unexpected file error: %s", suite.Error)
+	}
+	if len(suite.Benchmarks) != 2 {
+		t.Fatalf("expected 2 benchmarks. got=%d", len(suite.Benchmarks))
+	}
+
+	sum := suite.Benchmarks[0]
+	if sum.Err != nil {
+		t.Fatalf("sum 100 failed: %s", sum.Err.Message)
+	}
+	if sum.Name != "sum 100" || sum.File != path || sum.Iterations != 7 {
+		t.Errorf("wrong benchmark: %+v", sum)
+	}
+	if sum.NsPerOp <= 0 || sum.AllocsPerOp <= 0 || sum.BytesPerOp <= 0 {
+		t.Errorf("expected positive measurements. got ns=%f allocs=%d bytes=%d", sum.NsPerOp, sum.AllocsPerOp, sum.BytesPerOp)
+	}
+
+	if err := suite.Benchmarks[1].Err; err == nil || err.Message != "assertion failed: bench failed" {
+		t.Errorf("expected the second benchmark to fail. got=%v", err)
+	}
+	if !suite.Failed() {
+		t.Errorf("suite with a failing benchmark should report Failed()")
+	}
+	if !strings.Contains(out.String(), "ns/op") || !strings.Contains(out.String(), "FAIL") {
+		t.Errorf("output should show the results and the failure. got=\n%s", out.String())
+	}
+}
+
+func TestBenchmarkScaling(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "sum_bench.vc", sumBenches)
+
+	suite := RunBenchFile(path, BenchOptions{Filter: regexp.MustCompile("sum"), Time: 20 * time.Millisecond})
+	if len(suite.Benchmarks) != 1 || suite.Skipped != 1 {
+		t.Fatalf("filter should run only 'sum 100'. got=%d skipped=%d", len(suite.Benchmarks), suite.Skipped)
+	}
+	if b := suite.Benchmarks[0]; b.Err != nil || b.Iterations <= 1 {
+		t.Errorf("iterations should scale up to fill the bench time. got=%d (%v)", b.Iterations, b.Err)
+	}
+
+	tests := []struct {
+		n       int
+		elapsed time.Duration
+		goal    time.Duration
+		want    int
+	}{
+		{1, time.Millisecond, time.Second, 100},
+		{100, 10 * time.Millisecond, time.Second, 10000},
+		{1000, 500 * time.Millisecond, time.Second, 2400},
+		{10, 2 * time.Second, time.Second, 11},
+		{1, 0, time.Second, 100},
+	}
+	for _, tt := range tests {
+		if got := nextIterations(tt.n, tt.elapsed, tt.goal); got != tt.want {
+			t.Errorf("nextIterations(%d, %s, %s) = %d, want %d", tt.n, tt.elapsed, tt.goal, got, tt.want)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "sum_bench.vc", sumBenches)
+	suites := RunBenchmarks([]string{path}, BenchOptions{Iterations: 3})
+
+	var buf bytes.Buffer
+	if err := NewBaseline(suites).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseline.Benchmarks) != 1 || baseline.Benchmarks[0].Name != "sum 100" || baseline.Benchmarks[0].Iterations != 3 {
+		t.Fatalf("the baseline should hold only the passing benchmark. got=%+v", baseline.Benchmarks)
+	}
+
+	var out bytes.Buffer
+	RunBenchmarks([]string{path}, BenchOptions{Out: &out, Iterations: 3, Baseline: baseline, Filter: regexp.MustCompile("sum")})
+	if !strings.Contains(out.String(), "allocs/op") || !strings.Contains(out.String(), "%") {
+		t.Errorf("output should compare against the baseline. got=\n%s", out.String())
+	}
+
+	if _, err := ReadBaseline(strings.NewReader("not json")); err == nil {
+		t.Errorf("expected an error for an invalid baseline")
+	}
+
+	if got := change(100, 80); !strings.Contains(got, "-20.0%") {
+		t.Errorf("change(100, 80) = %q", got)
+	}
+	if got := change(100, 102); !strings.Contains(got, "+2.0%") {
+		t.Errorf("change(100, 102) = %q", got)
+	}
+}
@@ -28,12 +28,29 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 	MODULO   = "%"
+	POWER    = "**"
+	DIV      = "div"
 
 	PLUS_ASSIGN     = "+="
 	MINUS_ASSIGN    = "-="
 	ASTERISK_ASSIGN = "*="
 	SLASH_ASSIGN    = "/="
 	MODULO_ASSIGN   = "%="
+	POWER_ASSIGN    = "**="
+
+	// Bitwise operators
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	BIT_NOT     = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
+	BIT_AND_ASSIGN     = "&="
+	BIT_OR_ASSIGN      = "|="
+	BIT_XOR_ASSIGN     = "^="
+	SHIFT_LEFT_ASSIGN  = "<<="
+	SHIFT_RIGHT_ASSIGN = ">>="
 
 	INC = "++"
 	DEC = "--"
@@ -52,7 +69,12 @@ const (
 	OR_OR   = "||"
 
 	QUESTION     = "?"
+	QUESTION_DOT = "?."
+	COALESCE     = "??"
+	PIPE         = "|>"
+	AT           = "@" // Decorator: @memo define f() {}
 	RANGE        = ".."
+	RANGE_INCL   = "..="
 	ARROW        = "=>"
 	ARROW_RETURN = "->" // For function return type annotation
 
@@ -62,12 +84,13 @@ const (
 	COLON     = ":"
 	DOT       = "."
 
-	LPAREN   = "("
-	RPAREN   = ")"
-	LBRACE   = "{"
-	RBRACE   = "}"
-	LBRACKET = "["
-	RBRACKET = "]"
+	LPAREN     = "("
+	RPAREN     = ")"
+	LBRACE     = "{"
+	RBRACE     = "}"
+	SET_LBRACE = "#{"
+	LBRACKET   = "["
+	RBRACKET   = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -91,6 +114,8 @@ const (
 	CASE     = "CASE"
 	DEFAULT  = "DEFAULT"
 	CONST    = "CONST"
+	YIELD    = "YIELD"
+	ASSERT   = "ASSERT"
 
 	// Type keywords
 	TYPE_INT    = "TYPE_INT"
@@ -109,7 +134,10 @@ const (
 	ENUM = "ENUM"
 
 	// Preprocessor directives
-	MAKE = "MAKE" // #make directive (like C's #define)
+	MAKE     = "MAKE"     // #make directive (like C's #define)
+	PP_IF    = "PP_IF"    // #if directive
+	PP_ELSE  = "PP_ELSE"  // #else directive
+	PP_ENDIF = "PP_ENDIF" // #endif directive
 
 	// Literals
 	CHAR = "CHAR" // Character literal 'a'
@@ -133,12 +161,15 @@ var keywords = map[string]TokenType{
 	"in":       IN,
 	"and":      AND,
 	"or":       OR,
+	"div":      DIV,
 	"not":      NOT,
 	"include":  INCLUDE,
 	"try":      TRY,
 	"catch":    CATCH,
 	"break":    BREAK,
 	"continue": CONTINUE,
+	"yield":    YIELD,
+	"assert":   ASSERT,
 	"switch":   SWITCH,
 	"case":     CASE,
 	"default":  DEFAULT,